@@ -0,0 +1,63 @@
+package asm
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/asm"
+	"github.com/genkami/watson/pkg/lexer"
+)
+
+type Runner struct {
+	mode   util.Mode
+	opener util.Opener
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson asm", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the unlexer")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		r.opener = util.NewRWCOpener("<stdin>", os.Stdin)
+	} else if len(files) == 1 {
+		r.opener = util.NewFileOpener(files[0], os.O_RDONLY, 0)
+	} else {
+		fmt.Fprintf(os.Stderr, "too many arguments")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	file, err := r.opener.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't open %s: %s\n", r.opener.Name(), err.Error())
+		os.Exit(1)
+	}
+	defer file.Close()
+	unl := lexer.NewUnlexer(os.Stdout, lexer.WithInitialUnlexerMode(lexer.Mode(r.mode)))
+	err = asm.NewAssembler(unl).Assemble(file)
+	if err == nil {
+		err = unl.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error assembling %s: %s\n", r.opener.Name(), err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,103 @@
+package check
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/typecheck"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+type Runner struct {
+	mode          util.Mode
+	stackSize     int
+	expect        string
+	multiDocument bool
+	want          typecheck.Signature
+	openers       []util.Opener
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson check", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.IntVar(&r.stackSize, "stack-size", vm.DefaultStackSize, "stack size of the VM that is supposed to execute the files")
+	fs.StringVar(&r.expect, "expect", "", "fail unless the files leave values of the given kinds on the stack (e.g. \"[Object]\")")
+	fs.BoolVar(&r.multiDocument, "multi-document", false, "read multi-document streams")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if r.expect != "" {
+		r.want, err = typecheck.ParseSignature(r.expect)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			fs.PrintDefaults()
+			os.Exit(1)
+		}
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		r.openers = append(r.openers, util.NewRWCOpener("<stdin>", os.Stdin))
+	}
+	for _, f := range files {
+		r.openers = append(r.openers, util.NewFileOpener(f, os.O_RDONLY, 0))
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	ok := true
+	for _, o := range r.openers {
+		sigs, err := r.check(o)
+		var cerr *typecheck.CheckError
+		if errors.As(err, &cerr) {
+			// It already tells the file name.
+			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			ok = false
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "error checking %s: %s\n", o.Name(), err.Error())
+			ok = false
+			continue
+		}
+		for _, sig := range sigs {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", o.Name(), sig)
+			if r.want != nil && !sig.Equal(r.want) {
+				fmt.Fprintf(os.Stderr, "%s: expected %s but got %s\n", o.Name(), r.want, sig)
+				ok = false
+			}
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) check(o util.Opener) ([]typecheck.Signature, error) {
+	file, err := o.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	opts := []typecheck.CheckerOption{
+		typecheck.WithInitialMode(lexer.Mode(r.mode)),
+		typecheck.WithFileName(o.Name()),
+		typecheck.WithStackSize(r.stackSize),
+	}
+	if r.multiDocument {
+		opts = append(opts, typecheck.WithMultiDocument())
+	}
+	return typecheck.NewChecker(opts...).CheckDocuments(file)
+}
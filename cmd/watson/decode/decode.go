@@ -1,11 +1,13 @@
 package decode
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/genkami/watson/cmd/watson/util"
 	"github.com/genkami/watson/pkg/converter/cbor"
@@ -18,11 +20,18 @@ import (
 )
 
 type Runner struct {
-	outType   util.Type
-	mode      util.Mode
-	files     []string
-	m         *vm.VM
-	stackSize int
+	outType           util.Type
+	mode              util.Mode
+	files             []string
+	m                 *vm.VM
+	stackSize         int
+	maxInstructions   int64
+	maxStringLength   int
+	maxCollectionSize int
+	maxNestingDepth   int
+	maxAllocatedBytes int64
+	all               bool
+	timeout           time.Duration
 }
 
 func NewRunner() *Runner {
@@ -34,6 +43,13 @@ func (r *Runner) parseArgs(args []string) {
 	fs.Var(&r.outType, "t", "input type")
 	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
 	fs.IntVar(&r.stackSize, "stack-size", vm.DefaultStackSize, "stack size of the Watson VM")
+	fs.Int64Var(&r.maxInstructions, "max-instructions", 0, "maximum number of instructions to execute (0 means unlimited)")
+	fs.IntVar(&r.maxStringLength, "max-string-length", 0, "maximum length of strings (0 means unlimited)")
+	fs.IntVar(&r.maxCollectionSize, "max-collection-size", 0, "maximum number of elements in arrays and objects (0 means unlimited)")
+	fs.IntVar(&r.maxNestingDepth, "max-nesting-depth", 0, "maximum depth of nested arrays and objects (0 means unlimited)")
+	fs.Int64Var(&r.maxAllocatedBytes, "max-allocated-bytes", 0, "maximum number of bytes to allocate (0 means unlimited)")
+	fs.BoolVar(&r.all, "all", false, "output all values in the stack from the bottom to the top")
+	fs.DurationVar(&r.timeout, "timeout", 0, "give up reading and executing Watson after the given duration (0 means no timeout)")
 	err := fs.Parse(args)
 	if errors.Is(err, flag.ErrHelp) {
 		os.Exit(0)
@@ -42,7 +58,14 @@ func (r *Runner) parseArgs(args []string) {
 		fs.PrintDefaults()
 		os.Exit(1)
 	}
-	r.m = vm.NewVM(vm.WithStackSize(r.stackSize))
+	r.m = vm.NewVM(
+		vm.WithStackSize(r.stackSize),
+		vm.WithMaxInstructions(r.maxInstructions),
+		vm.WithMaxStringLength(r.maxStringLength),
+		vm.WithMaxCollectionSize(r.maxCollectionSize),
+		vm.WithMaxNestingDepth(r.maxNestingDepth),
+		vm.WithMaxAllocatedBytes(r.maxAllocatedBytes),
+	)
 	r.files = fs.Args()
 }
 
@@ -50,11 +73,25 @@ func (r *Runner) Run(args []string) {
 	var err error
 	r.parseArgs(args)
 
-	err = r.parseAllFiles()
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	err = r.parseAllFiles(ctx)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "parse error: %s\n", err)
 		os.Exit(1)
 	}
+	if r.all {
+		err = r.decodeAll(os.Stdout, r.m.Stack())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can't write Watson: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	v, err := r.m.Top()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "result is empty")
@@ -99,14 +136,18 @@ func (p *parseError) Error() string {
 		p.err, p.tok.FileName, p.tok.Line+1, p.tok.Column+1)
 }
 
-func (r *Runner) parseAllFiles() error {
+func (r *Runner) parseAllFiles(ctx context.Context) error {
 	for _, o := range r.openers() {
 		file, err := o.Open()
 		if err != nil {
 			return err
 		}
-		lex := r.buildLexer(file, o.Name())
-		err = r.parseWatson(lex)
+		var in io.Reader = file
+		if r.timeout > 0 {
+			in = &contextReader{ctx: ctx, r: file}
+		}
+		lex := r.buildLexer(in, o.Name())
+		err = r.parseWatson(ctx, lex)
 		file.Close()
 		if err != nil {
 			return err
@@ -116,22 +157,60 @@ func (r *Runner) parseAllFiles() error {
 	return nil
 }
 
-func (r *Runner) parseWatson(lex *lexer.Lexer) error {
+func (r *Runner) parseWatson(ctx context.Context, lex *lexer.Lexer) error {
 	for {
-		tok, err := lex.Next()
+		op, err := lex.NextOp()
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return &parseError{tok: tok, err: err}
+			return fmt.Errorf("can't read %s: %w", lex.FileName(), err)
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		default:
+			err = r.m.Feed(op)
 		}
-		err = r.m.Feed(tok.Op)
 		if err != nil {
+			line, column := lex.Position()
+			tok := &lexer.Token{Op: op, FileName: lex.FileName(), Line: line, Column: column}
 			return &parseError{tok: tok, err: err}
 		}
 	}
 	return nil
 }
 
+// contextReader gives up reading once ctx is done, even if the underlying reader is blocked (e.g. stdin that is waiting for input).
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+type readResult struct {
+	n   int
+	err error
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	// It reads into its own buffer since the underlying reader may still write to it after giving up.
+	buf := make([]byte, len(p))
+	done := make(chan readResult, 1)
+	go func() {
+		n, err := cr.r.Read(buf)
+		done <- readResult{n: n, err: err}
+	}()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-cr.ctx.Done():
+		// The goroutine is left blocked, which is fine since the command exits soon.
+		return 0, cr.ctx.Err()
+	}
+}
+
 func (r *Runner) decode(w io.Writer, v *types.Value) error {
 	switch r.outType {
 	case util.Yaml:
@@ -146,3 +225,18 @@ func (r *Runner) decode(w io.Writer, v *types.Value) error {
 		panic("unknown output type")
 	}
 }
+
+func (r *Runner) decodeAll(w io.Writer, vals []*types.Value) error {
+	switch r.outType {
+	case util.Yaml:
+		return yaml.DecodeAll(w, vals)
+	case util.Json:
+		return json.DecodeAll(w, vals)
+	case util.Msgpack:
+		return msgpack.DecodeAll(w, vals)
+	case util.Cbor:
+		return cbor.DecodeAll(w, vals)
+	default:
+		panic("unknown output type")
+	}
+}
@@ -0,0 +1,187 @@
+package diff
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/converter/json"
+	"github.com/genkami/watson/pkg/diff"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+const (
+	formatText = "text"
+	formatJson = "json"
+)
+
+// Exit statuses, which follow diff(1).
+const (
+	exitSame    = 0
+	exitDiffer  = 1
+	exitTrouble = 2
+)
+
+type Runner struct {
+	mode    util.Mode
+	format  string
+	numeric bool
+	utf8    bool
+	files   []string
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson diff", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.StringVar(&r.format, "format", formatText, "output format (text or json)")
+	fs.BoolVar(&r.numeric, "numeric", false, "compare numbers by their values regardless of their types")
+	fs.BoolVar(&r.utf8, "utf8", false, "compare strings as UTF-8")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitSame)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(exitTrouble)
+	}
+	if r.format != formatText && r.format != formatJson {
+		fmt.Fprintf(os.Stderr, "unknown format: %s\n", r.format)
+		os.Exit(exitTrouble)
+	}
+	r.files = fs.Args()
+	if len(r.files) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: watson diff [flags] FILE1 FILE2\n")
+		fs.PrintDefaults()
+		os.Exit(exitTrouble)
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+
+	from, err := r.load(r.files[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read %s: %s\n", r.files[0], err)
+		os.Exit(exitTrouble)
+	}
+	to, err := r.load(r.files[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't read %s: %s\n", r.files[1], err)
+		os.Exit(exitTrouble)
+	}
+
+	changes := diff.Diff(from, to, r.compareOptions()...)
+	switch r.format {
+	case formatJson:
+		err = writeJson(os.Stdout, changes)
+	default:
+		err = writeText(os.Stdout, changes)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't write diff: %s\n", err)
+		os.Exit(exitTrouble)
+	}
+	if len(changes) > 0 {
+		os.Exit(exitDiffer)
+	}
+}
+
+func (r *Runner) compareOptions() []types.CompareOption {
+	var opts []types.CompareOption
+	if r.numeric {
+		opts = append(opts, types.WithNumericEquality())
+	}
+	if r.utf8 {
+		opts = append(opts, types.WithUTF8Strings())
+	}
+	return opts
+}
+
+// load executes the file at path and returns the value at the top of the stack.
+func (r *Runner) load(path string) (*types.Value, error) {
+	o := util.NewFileOpener(path, os.O_RDONLY, 0)
+	file, err := o.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	lex := lexer.NewLexer(
+		file,
+		lexer.WithFileName(o.Name()),
+		lexer.WithInitialLexerMode(lexer.Mode(r.mode)),
+	)
+	m := vm.NewVM()
+	for {
+		op, err := lex.NextOp()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			line, column := lex.Position()
+			return nil, fmt.Errorf("%w at line %d, column %d", err, line+1, column+1)
+		}
+	}
+	return m.Top()
+}
+
+func writeText(w io.Writer, changes []diff.Change) error {
+	for _, c := range changes {
+		var err error
+		switch c.Kind {
+		case diff.Added:
+			_, err = fmt.Fprintf(w, "+ %s: %s\n", c.Path, util.Render(c.New))
+		case diff.Removed:
+			_, err = fmt.Fprintf(w, "- %s: %s\n", c.Path, util.Render(c.Old))
+		default:
+			old, new := util.Render(c.Old), util.Render(c.New)
+			if old == new {
+				// Values of different kinds such as Int 1 and Float 1 look the same.
+				old = fmt.Sprintf("%s (%#v)", old, c.Old.Kind)
+				new = fmt.Sprintf("%s (%#v)", new, c.New.Kind)
+			}
+			_, err = fmt.Fprintf(w, "~ %s: %s -> %s\n", c.Path, old, new)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJson(w io.Writer, changes []diff.Change) error {
+	arr := make([]*types.Value, 0, len(changes))
+	for _, c := range changes {
+		obj := types.NewObjectValue(map[string]*types.Value{})
+		obj.Set("kind", types.NewStringValue([]byte(c.Kind.String())))
+		obj.Set("path", types.NewStringValue([]byte(c.Path.String())))
+		if c.Old != nil {
+			obj.Set("old", renderJson(c.Old))
+		}
+		if c.New != nil {
+			obj.Set("new", renderJson(c.New))
+		}
+		arr = append(arr, obj)
+	}
+	return json.Decode(w, types.NewArrayValue(arr))
+}
+
+// renderJson returns an Object that has the kind of v and its rendered string,
+// since not all values (e.g. NaN, Inf and strings that are not valid UTF-8) can be written in JSON as they are.
+func renderJson(v *types.Value) *types.Value {
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("kind", types.NewStringValue([]byte(fmt.Sprintf("%#v", v.Kind))))
+	obj.Set("value", types.NewStringValue([]byte(util.Render(v))))
+	return obj
+}
@@ -0,0 +1,64 @@
+package diff
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/diff"
+	"github.com/genkami/watson/pkg/types"
+)
+
+func TestWriteJsonRendersValuesThatJsonCanNotRepresent(t *testing.T) {
+	changes := diff.Diff(
+		types.NewArrayValue([]*types.Value{
+			types.NewFloatValue(math.NaN()),
+			types.NewFloatValue(math.Inf(1)),
+		}),
+		types.NewArrayValue([]*types.Value{
+			types.NewFloatValue(math.Inf(-1)),
+			types.NewStringValue([]byte{0xff}),
+		}),
+	)
+	var buf bytes.Buffer
+	err := writeJson(&buf, changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type value struct {
+		Kind  string
+		Value string
+	}
+	type change struct {
+		Kind string
+		Path string
+		Old  value
+		New  value
+	}
+	var got []change
+	err = stdjson.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("%v: %s", err, buf.String())
+	}
+	want := []change{
+		{
+			Kind: "changed",
+			Path: "<root>[0]",
+			Old:  value{Kind: "Float", Value: "NaN"},
+			New:  value{Kind: "Float", Value: "-Inf"},
+		},
+		{
+			Kind: "changed",
+			Path: "<root>[1]",
+			Old:  value{Kind: "Float", Value: "+Inf"},
+			New:  value{Kind: "String", Value: `"\xff"`},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
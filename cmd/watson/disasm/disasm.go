@@ -0,0 +1,77 @@
+package disasm
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/disasm"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+type Runner struct {
+	mode      util.Mode
+	stackSize int
+	depth     bool
+	opener    util.Opener
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson disasm", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.IntVar(&r.stackSize, "stack-size", vm.DefaultStackSize, "stack size of the Watson VM")
+	fs.BoolVar(&r.depth, "depth", false, "show the depth of the stack after each instruction")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		r.opener = util.NewRWCOpener("<stdin>", os.Stdin)
+	} else if len(files) == 1 {
+		r.opener = util.NewFileOpener(files[0], os.O_RDONLY, 0)
+	} else {
+		fmt.Fprintf(os.Stderr, "too many arguments")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	file, err := r.opener.Open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't open %s: %s\n", r.opener.Name(), err.Error())
+		os.Exit(1)
+	}
+	defer file.Close()
+	lex := lexer.NewLexer(
+		file,
+		lexer.WithFileName(r.opener.Name()),
+		lexer.WithInitialLexerMode(lexer.Mode(r.mode)),
+	)
+	err = disasm.NewDisassembler(os.Stdout, r.disassemblerOptions()...).Disassemble(lex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error disassembling %s: %s\n", r.opener.Name(), err.Error())
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) disassemblerOptions() []disasm.DisassemblerOption {
+	opts := []disasm.DisassemblerOption{disasm.WithStackSize(r.stackSize)}
+	if r.depth {
+		opts = append(opts, disasm.WithDepth())
+	}
+	return opts
+}
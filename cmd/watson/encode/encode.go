@@ -1,11 +1,14 @@
 package encode
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/genkami/watson/cmd/watson/util"
 	"github.com/genkami/watson/pkg/converter/cbor"
@@ -13,15 +16,26 @@ import (
 	"github.com/genkami/watson/pkg/converter/msgpack"
 	"github.com/genkami/watson/pkg/converter/yaml"
 	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/layout"
 	"github.com/genkami/watson/pkg/lexer"
 	"github.com/genkami/watson/pkg/prettifier"
 	"github.com/genkami/watson/pkg/types"
 )
 
 type Runner struct {
-	inType util.Type
-	mode   util.Mode
-	opener util.Opener
+	inType       util.Type
+	mode         util.Mode
+	canonical    bool
+	optimization util.Optimization
+	opener       util.Opener
+	timeout      time.Duration
+	layout       util.Layout
+	width        int
+	indent       int
+	styleName    string
+	seed         int64
+	words        string
+	style        prettifier.Style
 }
 
 func NewRunner() *Runner {
@@ -32,6 +46,15 @@ func (r *Runner) parseArgs(args []string) {
 	fs := flag.NewFlagSet("watson encode", flag.ExitOnError)
 	fs.Var(&r.inType, "t", "input type")
 	fs.Var(&r.mode, "initial-mode", "initial mode of the unlexer")
+	fs.BoolVar(&r.canonical, "canonical", false, "emit the canonical encoding without any decoration")
+	fs.Var(&r.optimization, "optimize", "optimize the output for (none or size)")
+	fs.DurationVar(&r.timeout, "timeout", 0, "give up writing Watson after the given duration (0 means no timeout)")
+	fs.Var(&r.layout, "layout", "insert line breaks and indentation into the output (none, wrap or indent)")
+	fs.IntVar(&r.width, "width", layout.DefaultWidth, "width of lines used by -layout")
+	fs.IntVar(&r.indent, "indent", layout.DefaultIndent, "number of spaces per nesting level used by -layout=indent")
+	fs.StringVar(&r.styleName, "style", "classic", "decoration style ("+strings.Join(prettifier.Styles(), ", ")+")")
+	fs.Int64Var(&r.seed, "seed", 0, "seed of the random number generator used by -style=random")
+	fs.StringVar(&r.words, "words", "", "comma-separated words used by -style=words")
 	err := fs.Parse(args)
 	if errors.Is(err, flag.ErrHelp) {
 		os.Exit(0)
@@ -40,6 +63,30 @@ func (r *Runner) parseArgs(args []string) {
 		fs.PrintDefaults()
 		os.Exit(1)
 	}
+	if r.canonical && dumper.Optimization(r.optimization) != dumper.OptimizeNone {
+		fmt.Fprintf(os.Stderr, "-canonical and -optimize can't be used at the same time\n")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if r.canonical || dumper.Optimization(r.optimization) != dumper.OptimizeNone {
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "style" || f.Name == "seed" || f.Name == "words" {
+				fmt.Fprintf(os.Stderr, "-%s can't be used with -canonical or -optimize\n", f.Name)
+				fs.PrintDefaults()
+				os.Exit(1)
+			}
+		})
+	}
+	cfg := &prettifier.Config{Seed: r.seed}
+	if r.words != "" {
+		cfg.Words = strings.Split(r.words, ",")
+	}
+	r.style, err = prettifier.NewStyle(r.styleName, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
 	files := fs.Args()
 	if len(files) == 0 {
 		r.opener = util.NewRWCOpener("<stdin>", os.Stdin)
@@ -55,6 +102,12 @@ func (r *Runner) parseArgs(args []string) {
 func (r *Runner) Run(args []string) {
 	var err error
 	r.parseArgs(args)
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
 	file, err := r.opener.Open()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "can't open %s: %s\n", r.opener.Name(), err.Error())
@@ -66,7 +119,7 @@ func (r *Runner) Run(args []string) {
 		fmt.Fprintf(os.Stderr, "error loading %s: %s\n", r.opener.Name(), err.Error())
 		os.Exit(1)
 	}
-	err = r.dump(os.Stdout, val)
+	err = r.dump(ctx, os.Stdout, val)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error writing output: %s\n", err.Error())
 		os.Exit(1)
@@ -88,8 +141,39 @@ func (rn *Runner) encode(r io.Reader) (*types.Value, error) {
 	}
 }
 
-func (r *Runner) dump(w io.Writer, v *types.Value) error {
-	unl := prettifier.NewPrettifier(lexer.NewUnlexer(w, lexer.WithInitialUnlexerMode(lexer.Mode(r.mode))))
-	d := dumper.NewDumper(unl)
-	return d.Dump(v)
+func (r *Runner) dump(ctx context.Context, w io.Writer, v *types.Value) error {
+	style := layout.Style(r.layout)
+	if style != layout.None {
+		w = layout.NewWriter(
+			w,
+			layout.WithStyle(style),
+			layout.WithWidth(r.width),
+			layout.WithIndent(r.indent),
+			layout.WithInitialMode(lexer.Mode(r.mode)),
+		)
+	}
+	u := lexer.NewUnlexer(w, lexer.WithInitialUnlexerMode(lexer.Mode(r.mode)))
+	var unl lexer.OpWriter = u
+	opts := make([]dumper.DumperOption, 0, 2)
+	opts = append(opts, dumper.WithContext(ctx))
+	if r.canonical {
+		opts = append(opts, dumper.WithCanonical())
+	} else if opt := dumper.Optimization(r.optimization); opt != dumper.OptimizeNone {
+		opts = append(opts, dumper.WithOptimization(opt))
+	} else {
+		unl = prettifier.NewPrettifier(unl, prettifier.WithStyle(r.style))
+	}
+	d := dumper.NewDumper(unl, opts...)
+	err := d.Dump(v)
+	if err != nil {
+		return err
+	}
+	err = u.Flush()
+	if err != nil {
+		return err
+	}
+	if style != layout.None {
+		_, err = io.WriteString(w, "\n")
+	}
+	return err
 }
@@ -0,0 +1,205 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/format"
+	"github.com/genkami/watson/pkg/layout"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/prettifier"
+)
+
+// ext is the extension of files that are formatted when a directory is given.
+const ext = ".watson"
+
+type Runner struct {
+	write         bool
+	list          bool
+	showDiff      bool
+	mode          util.Mode
+	inputMode     util.Mode
+	styleName     string
+	seed          int64
+	words         string
+	layout        util.Layout
+	width         int
+	indent        int
+	multiDocument bool
+	paths         []string
+	formatter     *format.Formatter
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson fmt", flag.ExitOnError)
+	fs.BoolVar(&r.write, "w", false, "write the result to the file instead of the standard output")
+	fs.BoolVar(&r.list, "l", false, "list files whose formatting differs from the result")
+	fs.BoolVar(&r.showDiff, "d", false, "show the differences between files and the results")
+	fs.Var(&r.mode, "initial-mode", "initial mode of the output, which is also used to read the input unless -input-mode is given")
+	fs.Var(&r.inputMode, "input-mode", "initial mode of the lexer that reads the input")
+	fs.StringVar(&r.styleName, "style", "classic", "decoration style ("+strings.Join(prettifier.Styles(), ", ")+")")
+	fs.Int64Var(&r.seed, "seed", 0, "seed of the random number generator used by -style=random")
+	fs.StringVar(&r.words, "words", "", "comma-separated words used by -style=words")
+	fs.Var(&r.layout, "layout", "insert line breaks and indentation into the output (none, wrap or indent)")
+	fs.IntVar(&r.width, "width", layout.DefaultWidth, "width of lines used by -layout")
+	fs.IntVar(&r.indent, "indent", layout.DefaultIndent, "number of spaces per nesting level used by -layout=indent")
+	fs.BoolVar(&r.multiDocument, "multi-document", false, "read and write multi-document streams")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	inputModeSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "input-mode" {
+			inputModeSet = true
+		}
+	})
+	if !inputModeSet {
+		r.inputMode = r.mode
+	}
+	cfg := &prettifier.Config{Seed: r.seed}
+	if r.words != "" {
+		cfg.Words = strings.Split(r.words, ",")
+	}
+	// The style is created by the Formatter for each file, but an unknown name should be reported before reading any of them.
+	_, err = prettifier.NewStyle(r.styleName, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	r.paths = fs.Args()
+	if len(r.paths) == 0 && r.write {
+		fmt.Fprintf(os.Stderr, "can't use -w with the standard input\n")
+		os.Exit(1)
+	}
+	opts := []format.FormatterOption{
+		format.WithInputMode(lexer.Mode(r.inputMode)),
+		format.WithOutputMode(lexer.Mode(r.mode)),
+		format.WithStyle(r.styleName, cfg),
+		format.WithLayout(layout.Style(r.layout)),
+		format.WithWidth(r.width),
+		format.WithIndent(r.indent),
+	}
+	if r.multiDocument {
+		opts = append(opts, format.WithMultiDocument())
+	}
+	r.formatter = format.NewFormatter(opts...)
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	if len(r.paths) == 0 {
+		err := r.formatStdin()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error formatting <stdin>: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	ok := true
+	for _, root := range r.paths {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			// Files in directories are formatted only if they look like Watson, while files given explicitly always are.
+			if info.IsDir() || (path != root && !isWatsonFile(info)) {
+				return nil
+			}
+			err = r.formatFile(path, info)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error formatting %s: %s\n", path, err.Error())
+				ok = false
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "can't open %s: %s\n", root, err.Error())
+			ok = false
+		}
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func isWatsonFile(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && filepath.Ext(info.Name()) == ext
+}
+
+func (r *Runner) formatStdin() error {
+	src, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	res, err := r.format(src)
+	if err != nil {
+		return err
+	}
+	return r.report("<stdin>", src, res)
+}
+
+func (r *Runner) formatFile(path string, info os.FileInfo) error {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	res, err := r.format(src)
+	if err != nil {
+		return err
+	}
+	if r.write && !bytes.Equal(src, res) {
+		err = ioutil.WriteFile(path, res, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+	}
+	return r.report(path, src, res)
+}
+
+func (r *Runner) format(src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	err := r.formatter.Format(buf, bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// report tells the result of formatting the file at path in the ways specified by the flags.
+// Like gofmt, it writes the result to the standard output if none of -w, -l and -d is given.
+func (r *Runner) report(path string, src, res []byte) error {
+	if !r.write && !r.list && !r.showDiff {
+		_, err := os.Stdout.Write(res)
+		return err
+	}
+	if bytes.Equal(src, res) {
+		return nil
+	}
+	if r.list {
+		_, err := fmt.Fprintln(os.Stdout, path)
+		if err != nil {
+			return err
+		}
+	}
+	if r.showDiff {
+		return writeUnified(os.Stdout, path+".orig", path, src, res)
+	}
+	return nil
+}
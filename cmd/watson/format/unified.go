@@ -0,0 +1,115 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/genkami/watson/pkg/diff"
+)
+
+// contextLines is the number of unchanged lines around changes in a unified diff.
+const contextLines = 3
+
+// edit is a line of a unified diff. kind is one of ' ', '-' and '+'.
+type edit struct {
+	kind byte
+	line []byte
+}
+
+// writeUnified writes the difference between old and new in the unified format.
+func writeUnified(w io.Writer, oldName, newName string, old, new []byte) error {
+	edits := diffLines(splitLines(old), splitLines(new))
+	buf := bytes.NewBuffer(nil)
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+	oldLine, newLine := 0, 0 // the number of lines before edits[i]
+	for i := 0; i < len(edits); {
+		if edits[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+		// Extend the hunk as long as the next change is close enough to share the context.
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(edits) && j < end+2*contextLines+1; j++ {
+			if edits[j].kind != ' ' {
+				end = j + 1
+			}
+		}
+		end += contextLines
+		if end > len(edits) {
+			end = len(edits)
+		}
+		oldStart, newStart := oldLine-(i-start), newLine-(i-start)
+		oldLen, newLen := 0, 0
+		for _, e := range edits[start:end] {
+			if e.kind != '+' {
+				oldLen++
+			}
+			if e.kind != '-' {
+				newLen++
+			}
+		}
+		fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(oldStart, oldLen), hunkRange(newStart, newLen))
+		for _, e := range edits[start:end] {
+			buf.WriteByte(e.kind)
+			buf.Write(e.line)
+			if !bytes.HasSuffix(e.line, []byte("\n")) {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		oldLine, newLine = oldStart+oldLen, newStart+newLen
+		i = end
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// hunkRange formats the range of lines in a hunk header, where start is the number of lines before the hunk.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits s into lines, each of which ends with a newline except for the last one.
+func splitLines(s []byte) [][]byte {
+	var lines [][]byte
+	for len(s) > 0 {
+		i := bytes.IndexByte(s, '\n') + 1
+		if i == 0 {
+			i = len(s)
+		}
+		lines = append(lines, s[:i])
+		s = s[i:]
+	}
+	return lines
+}
+
+// diffLines returns the edits that turn a into b, which consist of the longest common subsequence of them and the rest.
+// See diff.Match for details.
+func diffLines(a, b [][]byte) []edit {
+	edits := make([]edit, 0, len(a)+len(b))
+	i, j := 0, 0
+	pairs := diff.Match(len(a), len(b), func(i, j int) bool { return bytes.Equal(a[i], b[j]) })
+	for _, p := range append(pairs, diff.Pair{From: len(a), To: len(b)}) {
+		for ; i < p.From; i++ {
+			edits = append(edits, edit{'-', a[i]})
+		}
+		for ; j < p.To; j++ {
+			edits = append(edits, edit{'+', b[j]})
+		}
+		if i < len(a) {
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		}
+	}
+	return edits
+}
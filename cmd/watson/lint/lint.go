@@ -0,0 +1,111 @@
+package lint
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/lint"
+)
+
+// Exit statuses, which are the same as the ones of `watson diff`.
+const (
+	exitClean   = 0
+	exitFound   = 1
+	exitTrouble = 2
+)
+
+type Runner struct {
+	mode          util.Mode
+	disable       string
+	multiDocument bool
+	disabled      []lint.Rule
+	openers       []util.Opener
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson lint", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.StringVar(&r.disable, "disable", "", "comma-separated rules that are not reported ("+strings.Join(ruleNames(), ", ")+")")
+	fs.BoolVar(&r.multiDocument, "multi-document", false, "read multi-document streams")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(exitClean)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(exitTrouble)
+	}
+	if r.disable != "" {
+		for _, name := range strings.Split(r.disable, ",") {
+			rule, err := lint.ParseRule(name)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+				fs.PrintDefaults()
+				os.Exit(exitTrouble)
+			}
+			r.disabled = append(r.disabled, rule)
+		}
+	}
+	files := fs.Args()
+	if len(files) == 0 {
+		r.openers = append(r.openers, util.NewRWCOpener("<stdin>", os.Stdin))
+	}
+	for _, f := range files {
+		r.openers = append(r.openers, util.NewFileOpener(f, os.O_RDONLY, 0))
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	status := exitClean
+	for _, o := range r.openers {
+		found, err := r.lint(o)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error linting %s: %s\n", o.Name(), err.Error())
+			status = exitTrouble
+		} else if found && status == exitClean {
+			status = exitFound
+		}
+	}
+	os.Exit(status)
+}
+
+// lint prints the findings in the file and reports whether there are any.
+func (r *Runner) lint(o util.Opener) (bool, error) {
+	file, err := o.Open()
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	opts := []lint.LinterOption{
+		lint.WithInitialMode(lexer.Mode(r.mode)),
+		lint.WithFileName(o.Name()),
+		lint.WithDisabledRules(r.disabled...),
+	}
+	if r.multiDocument {
+		opts = append(opts, lint.WithMultiDocument())
+	}
+	// Findings before an instruction that fails are still worth printing, since they may tell why it fails.
+	findings, err := lint.NewLinter(opts...).Lint(file)
+	for _, f := range findings {
+		fmt.Fprintln(os.Stdout, f.String())
+	}
+	return len(findings) > 0, err
+}
+
+func ruleNames() []string {
+	var names []string
+	for _, rule := range lint.Rules() {
+		names = append(names, string(rule))
+	}
+	return names
+}
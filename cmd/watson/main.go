@@ -4,8 +4,16 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/genkami/watson/cmd/watson/asm"
+	"github.com/genkami/watson/cmd/watson/check"
 	"github.com/genkami/watson/cmd/watson/decode"
+	"github.com/genkami/watson/cmd/watson/diff"
+	"github.com/genkami/watson/cmd/watson/disasm"
 	"github.com/genkami/watson/cmd/watson/encode"
+	"github.com/genkami/watson/cmd/watson/format"
+	"github.com/genkami/watson/cmd/watson/lint"
+	"github.com/genkami/watson/cmd/watson/repl"
+	"github.com/genkami/watson/cmd/watson/trace"
 )
 
 type Runner interface {
@@ -13,8 +21,16 @@ type Runner interface {
 }
 
 var allCmds = map[string]Runner{
+	"asm":    asm.NewRunner(),
+	"check":  check.NewRunner(),
 	"decode": decode.NewRunner(),
+	"diff":   diff.NewRunner(),
+	"disasm": disasm.NewRunner(),
 	"encode": encode.NewRunner(),
+	"fmt":    format.NewRunner(),
+	"lint":   lint.NewRunner(),
+	"repl":   repl.NewRunner(),
+	"trace":  trace.NewRunner(),
 }
 
 func main() {
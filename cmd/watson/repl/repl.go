@@ -0,0 +1,239 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/converter/json"
+	"github.com/genkami/watson/pkg/converter/yaml"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+const helpMessage = `Type Watson Representation to execute it. Each line is executed as soon as it is entered.
+
+Commands:
+  \undo           undo the last instruction
+  \reset          clear the stack and reset the mode to the initial one
+  \mode A|S       switch the mode of the lexer
+  \dump json|yaml dump the stack as JSON Lines or YAML documents
+  \help           show this message
+  \quit           exit the REPL
+`
+
+type Runner struct {
+	mode      util.Mode
+	stackSize int
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson repl", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.IntVar(&r.stackSize, "stack-size", vm.DefaultStackSize, "stack size of the Watson VM")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if fs.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "too many arguments")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	s := newSession(lexer.Mode(r.mode), r.stackSize, os.Stdout)
+	err := s.run(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading input: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+// step is an instruction that has been executed successfully.
+type step struct {
+	op   vm.Op
+	mode lexer.Mode // the mode of the lexer before reading op
+}
+
+// session holds the state of the REPL.
+type session struct {
+	initialMode lexer.Mode
+	mode        lexer.Mode
+	stackSize   int
+	m           *vm.VM
+	history     []step
+	out         io.Writer
+}
+
+func newSession(mode lexer.Mode, stackSize int, out io.Writer) *session {
+	return &session{
+		initialMode: mode,
+		mode:        mode,
+		stackSize:   stackSize,
+		m:           vm.NewVM(vm.WithStackSize(stackSize)),
+		history:     make([]step, 0),
+		out:         out,
+	}
+}
+
+func (s *session) run(in io.Reader) error {
+	sc := bufio.NewScanner(in)
+	sc.Buffer(make([]byte, 0, 4096), 1024*1024)
+	s.prompt()
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			quit := s.command(strings.Fields(strings.TrimSpace(line)))
+			if quit {
+				return nil
+			}
+		} else {
+			s.execute(line)
+			s.show()
+		}
+		s.prompt()
+	}
+	fmt.Fprintln(s.out)
+	return sc.Err()
+}
+
+func (s *session) prompt() {
+	fmt.Fprintf(s.out, "%s> ", modeName(s.mode))
+}
+
+// execute executes line instruction by instruction. It stops at the first instruction that fails.
+func (s *session) execute(line string) {
+	l := lexer.NewLexer(strings.NewReader(line), lexer.WithInitialLexerMode(s.mode))
+	for {
+		before := l.Mode()
+		tok, err := l.Next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err.Error())
+			return
+		}
+		err = s.m.Feed(tok.Op)
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %s at column %d (%#v)\n", err.Error(), tok.Column+1, tok.Op)
+			return
+		}
+		s.history = append(s.history, step{op: tok.Op, mode: before})
+		s.mode = l.Mode()
+	}
+}
+
+// command executes a command and reports whether the REPL should exit.
+func (s *session) command(args []string) bool {
+	switch args[0] {
+	case `\undo`:
+		s.undo()
+	case `\reset`:
+		s.reset()
+		s.show()
+	case `\mode`:
+		if len(args) != 2 {
+			fmt.Fprintf(s.out, "usage: \\mode A|S\n")
+			return false
+		}
+		var m util.Mode
+		err := m.Set(args[1])
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %s\n", err.Error())
+			return false
+		}
+		s.mode = lexer.Mode(m)
+		s.show()
+	case `\dump`:
+		format := "yaml"
+		if len(args) >= 2 {
+			format = args[1]
+		}
+		s.dump(format)
+	case `\help`:
+		fmt.Fprint(s.out, helpMessage)
+	case `\quit`:
+		return true
+	default:
+		fmt.Fprintf(s.out, "unknown command: %s (type \\help for help)\n", args[0])
+	}
+	return false
+}
+
+// undo cancels the last instruction in the history.
+func (s *session) undo() {
+	if len(s.history) == 0 {
+		fmt.Fprintf(s.out, "nothing to undo\n")
+		return
+	}
+	last := s.history[len(s.history)-1]
+	s.history = s.history[:len(s.history)-1]
+	s.replay()
+	s.mode = last.mode
+	fmt.Fprintf(s.out, "undo %#v\n", last.op)
+	s.show()
+}
+
+// replay rebuilds the stack by executing all instructions in the history on a new VM.
+func (s *session) replay() {
+	s.m = vm.NewVM(vm.WithStackSize(s.stackSize))
+	for _, st := range s.history {
+		err := s.m.Feed(st.op)
+		if err != nil {
+			// This can't happen since every instruction in the history has succeeded before.
+			panic(err)
+		}
+	}
+}
+
+func (s *session) reset() {
+	s.m = vm.NewVM(vm.WithStackSize(s.stackSize))
+	s.history = s.history[:0]
+	s.mode = s.initialMode
+}
+
+func (s *session) dump(format string) {
+	var err error
+	switch format {
+	case "json":
+		err = json.DecodeAll(s.out, s.m.Stack())
+	case "yaml":
+		err = yaml.DecodeAll(s.out, s.m.Stack())
+	default:
+		fmt.Fprintf(s.out, "usage: \\dump json|yaml\n")
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(s.out, "error: %s\n", err.Error())
+	}
+}
+
+// show shows the current mode and the stack from the bottom to the top.
+func (s *session) show() {
+	stack := s.m.Stack()
+	fmt.Fprintf(s.out, "mode: %s, stack size: %d\n", modeName(s.mode), len(stack))
+	for i, v := range stack {
+		fmt.Fprintf(s.out, "  [%d] %#v %s\n", i, v.Kind, util.Render(v))
+	}
+}
+
+func modeName(m lexer.Mode) string {
+	um := util.Mode(m)
+	return um.String()
+}
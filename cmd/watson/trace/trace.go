@@ -0,0 +1,264 @@
+package trace
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/genkami/watson/cmd/watson/util"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+const helpMessage = `Commands:
+  c, continue  continue execution until the next breakpoint
+  s, step      execute the next instruction and stop again
+  q, quit      abort execution
+`
+
+type Runner struct {
+	mode      util.Mode
+	stackSize int
+	files     []string
+	positions positions
+	ops       ops
+	m         *vm.VM
+	out       io.Writer
+	commands  *bufio.Scanner
+	stepping  bool
+	tok       *lexer.Token
+	tokenMode lexer.Mode
+}
+
+func NewRunner() *Runner {
+	return &Runner{
+		out: os.Stdout,
+	}
+}
+
+func (r *Runner) parseArgs(args []string) {
+	fs := flag.NewFlagSet("watson trace", flag.ExitOnError)
+	fs.Var(&r.mode, "initial-mode", "initial mode of the lexer")
+	fs.IntVar(&r.stackSize, "stack-size", vm.DefaultStackSize, "stack size of the Watson VM")
+	fs.Var(&r.positions, "break", "stop before executing the instruction at LINE:COLUMN (can be repeated)")
+	fs.Var(&r.ops, "break-op", "stop before executing the given instruction, e.g. Iinc (can be repeated)")
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s", err.Error())
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	r.files = fs.Args()
+	if len(r.files) == 0 && r.hasBreakpoints() {
+		fmt.Fprintf(os.Stderr, "breakpoints require FILES since commands are read from the standard input\n")
+		os.Exit(1)
+	}
+	r.m = vm.NewVM(vm.WithStackSize(r.stackSize), vm.WithTracer(r.trace))
+	r.commands = bufio.NewScanner(os.Stdin)
+}
+
+func (r *Runner) Run(args []string) {
+	r.parseArgs(args)
+	err := r.traceAllFiles()
+	if errors.Is(err, errAborted) {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+func (r *Runner) openers() []util.Opener {
+	if len(r.files) == 0 {
+		return []util.Opener{
+			util.NewRWCOpener("<stdin>", os.Stdin),
+		}
+	}
+	openers := make([]util.Opener, 0, len(r.files))
+	for _, path := range r.files {
+		o := util.NewFileOpener(path, os.O_RDONLY, 0)
+		openers = append(openers, o)
+	}
+	return openers
+}
+
+var errAborted = errors.New("aborted")
+
+func (r *Runner) traceAllFiles() error {
+	for _, o := range r.openers() {
+		file, err := o.Open()
+		if err != nil {
+			return err
+		}
+		lex := lexer.NewLexer(
+			file,
+			lexer.WithFileName(o.Name()),
+			lexer.WithInitialLexerMode(lexer.Mode(r.mode)),
+		)
+		err = r.traceWatson(lex)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		r.mode = util.Mode(lex.Mode())
+	}
+	return nil
+}
+
+func (r *Runner) traceWatson(lex *lexer.Lexer) error {
+	for {
+		r.tokenMode = lex.Mode()
+		tok, err := lex.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		r.tok = tok
+		if r.stepping || r.isBreakpoint(tok) {
+			err = r.pause()
+			if err != nil {
+				return err
+			}
+		}
+		err = r.m.Feed(tok.Op)
+		if err != nil {
+			return fmt.Errorf("error %+v\n at %#v line %d, column %d", err, tok.FileName, tok.Line+1, tok.Column+1)
+		}
+	}
+}
+
+// trace is called by the VM each time it executes an instruction.
+func (r *Runner) trace(op vm.Op, before, after []*types.Value) {
+	fmt.Fprintf(r.out, "%s:%d:%d\t%s\t%#v\n",
+		r.tok.FileName, r.tok.Line+1, r.tok.Column+1, modeName(r.tokenMode), op)
+	r.showStack("before", before)
+	r.showStack("after", after)
+}
+
+func (r *Runner) showStack(label string, stack []*types.Value) {
+	if len(stack) == 0 {
+		fmt.Fprintf(r.out, "  %s: (empty)\n", label)
+		return
+	}
+	fmt.Fprintf(r.out, "  %s:\n", label)
+	for i, v := range stack {
+		fmt.Fprintf(r.out, "    [%d] %#v %s\n", i, v.Kind, util.Render(v))
+	}
+}
+
+func (r *Runner) hasBreakpoints() bool {
+	return len(r.positions) > 0 || len(r.ops) > 0
+}
+
+func (r *Runner) isBreakpoint(tok *lexer.Token) bool {
+	for _, p := range r.positions {
+		if p.line == tok.Line+1 && p.column == tok.Column+1 {
+			return true
+		}
+	}
+	for _, op := range r.ops {
+		if op == tok.Op {
+			return true
+		}
+	}
+	return false
+}
+
+// pause stops execution before the current token and waits for a command.
+func (r *Runner) pause() error {
+	fmt.Fprintf(r.out, "stopped before %#v at %s:%d:%d\n", r.tok.Op, r.tok.FileName, r.tok.Line+1, r.tok.Column+1)
+	for {
+		fmt.Fprintf(r.out, "(trace) ")
+		if !r.commands.Scan() {
+			fmt.Fprintln(r.out)
+			if err := r.commands.Err(); err != nil {
+				return err
+			}
+			return errAborted
+		}
+		switch strings.TrimSpace(r.commands.Text()) {
+		case "c", "continue":
+			r.stepping = false
+			return nil
+		case "s", "step":
+			r.stepping = true
+			return nil
+		case "q", "quit":
+			return errAborted
+		default:
+			fmt.Fprint(r.out, helpMessage)
+		}
+	}
+}
+
+func modeName(m lexer.Mode) string {
+	um := util.Mode(m)
+	return um.String()
+}
+
+type position struct {
+	line, column int
+}
+
+// positions is a list of breakpoints given as LINE:COLUMN.
+type positions []position
+
+func (ps *positions) String() string {
+	if ps == nil {
+		return ""
+	}
+	strs := make([]string, 0, len(*ps))
+	for _, p := range *ps {
+		strs = append(strs, fmt.Sprintf("%d:%d", p.line, p.column))
+	}
+	return strings.Join(strs, ",")
+}
+
+func (ps *positions) Set(s string) error {
+	i := strings.IndexByte(s, ':')
+	if i < 0 {
+		return fmt.Errorf("invalid breakpoint: %s (expected LINE:COLUMN)", s)
+	}
+	line, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return fmt.Errorf("invalid line: %s", s[:i])
+	}
+	column, err := strconv.Atoi(s[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid column: %s", s[i+1:])
+	}
+	*ps = append(*ps, position{line: line, column: column})
+	return nil
+}
+
+// ops is a list of breakpoints given as names of instructions.
+type ops []vm.Op
+
+func (o *ops) String() string {
+	if o == nil {
+		return ""
+	}
+	strs := make([]string, 0, len(*o))
+	for _, op := range *o {
+		strs = append(strs, fmt.Sprintf("%#v", op))
+	}
+	return strings.Join(strs, ",")
+}
+
+func (o *ops) Set(s string) error {
+	op, err := vm.ParseOp(s)
+	if err != nil {
+		return err
+	}
+	*o = append(*o, op)
+	return nil
+}
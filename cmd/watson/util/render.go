@@ -0,0 +1,43 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+// Render returns a short human-readable representation of v.
+func Render(v *types.Value) string {
+	switch v.Kind {
+	case types.Int:
+		return strconv.FormatInt(v.Int, 10)
+	case types.Uint:
+		return strconv.FormatUint(v.Uint, 10)
+	case types.Float:
+		if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+			return fmt.Sprintf("%v", v.Float)
+		}
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case types.String:
+		return strconv.Quote(string(v.String))
+	case types.Object:
+		elems := make([]string, 0, len(v.Object))
+		for _, k := range v.OrderedKeys() {
+			elems = append(elems, fmt.Sprintf("%s: %s", strconv.Quote(k), Render(v.Object[k])))
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	case types.Array:
+		elems := make([]string, 0, len(v.Array))
+		for _, e := range v.Array {
+			elems = append(elems, Render(e))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case types.Bool:
+		return strconv.FormatBool(v.Bool)
+	default:
+		return "nil"
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"io"
 	"os"
 
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/layout"
 	"github.com/genkami/watson/pkg/lexer"
 )
 
@@ -96,6 +98,81 @@ func (t *Type) Set(s string) error {
 var assertTypeIsValue = Type(0)
 var _ flag.Value = &assertTypeIsValue
 
+type Optimization dumper.Optimization
+
+const (
+	optimizationNameNone = "none"
+	optimizationNameSize = "size"
+)
+
+func (o *Optimization) String() string {
+	switch dumper.Optimization(*o) {
+	case dumper.OptimizeNone:
+		return optimizationNameNone
+	case dumper.OptimizeSize:
+		return optimizationNameSize
+	default:
+		panic("unknown optimization")
+	}
+}
+
+func (o *Optimization) Set(s string) error {
+	switch s {
+	case "":
+		*o = Optimization(dumper.OptimizeNone)
+	case optimizationNameNone:
+		*o = Optimization(dumper.OptimizeNone)
+	case optimizationNameSize:
+		*o = Optimization(dumper.OptimizeSize)
+	default:
+		return fmt.Errorf("unknown optimization: %s", s)
+	}
+	return nil
+}
+
+var assertOptimizationIsValue = Optimization(0)
+var _ flag.Value = &assertOptimizationIsValue
+
+type Layout layout.Style
+
+const (
+	layoutNameNone   = "none"
+	layoutNameWrap   = "wrap"
+	layoutNameIndent = "indent"
+)
+
+func (l *Layout) String() string {
+	switch layout.Style(*l) {
+	case layout.None:
+		return layoutNameNone
+	case layout.Wrap:
+		return layoutNameWrap
+	case layout.Indent:
+		return layoutNameIndent
+	default:
+		panic("unknown layout")
+	}
+}
+
+func (l *Layout) Set(s string) error {
+	switch s {
+	case "":
+		*l = Layout(layout.None)
+	case layoutNameNone:
+		*l = Layout(layout.None)
+	case layoutNameWrap:
+		*l = Layout(layout.Wrap)
+	case layoutNameIndent:
+		*l = Layout(layout.Indent)
+	default:
+		return fmt.Errorf("unknown layout: %s", s)
+	}
+	return nil
+}
+
+var assertLayoutIsValue = Layout(0)
+var _ flag.Value = &assertLayoutIsValue
+
 type Opener interface {
 	Name() string
 	Open() (io.ReadWriteCloser, error)
@@ -0,0 +1,29 @@
+package watson_test
+
+import (
+	"fmt"
+
+	"github.com/genkami/watson"
+)
+
+func ExampleParser() {
+	p := watson.NewParser()
+	// A Watson Representation can be split at any position.
+	for _, chunk := range []string{"~?SShkSha", "aaaakShaaaaaak-SS", "hkShaakg"} {
+		_, err := p.Write([]byte(chunk))
+		if err != nil {
+			panic(err)
+		}
+	}
+	v, err := p.Pop()
+	if err != nil {
+		panic(err)
+	}
+	var obj map[string]int
+	err = v.Bind(&obj)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(obj)
+	// Output: map[a:5]
+}
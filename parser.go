@@ -0,0 +1,110 @@
+package watson
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Parser is a push-style counterpart of Decoder.
+// Instead of reading from an io.Reader, it executes Watson Representation that is written to it by Write, which can be split into arbitrary chunks.
+// The mode of the lexer and the stack of the VM are kept across chunks.
+//
+// Values on the stack can be taken out at any time by Top or Pop.
+type Parser struct {
+	stackSize int
+	l         *lexer.Lexer
+	chunk     bytes.Reader
+	m         *vm.VM
+	err       error
+}
+
+// NewParser creates a new Parser.
+func NewParser() *Parser {
+	p := &Parser{}
+	p.l = lexer.NewLexer(&p.chunk)
+	return p
+}
+
+// SetStackSize sets the stack size of underlying Watson VM.
+// It must be called before the first call of Write.
+//
+// See watson/pkg/vm for more details.
+func (p *Parser) SetStackSize(size int) {
+	p.stackSize = size
+}
+
+// Write executes all instructions in b.
+// It implements io.Writer, so a Parser can be the destination of io.Copy.
+//
+// If the VM fails to execute an instruction, it returns a *DecodeError that tells where the instruction is, and the number of bytes in b before the instruction.
+// The instructions before it are executed, and the stack is left as it was just before it.
+// After that, the Parser is broken and all subsequent calls of Write return the same error.
+func (p *Parser) Write(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	m := p.vm()
+	p.chunk.Reset(b)
+	p.l.Resume(&p.chunk)
+	for {
+		op, err := p.l.NextOp()
+		if err == io.EOF {
+			return len(b), nil
+		} else if err != nil {
+			// This never happens since bytes.Reader returns no error other than io.EOF.
+			p.err = err
+			return p.consumed(b), err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			line, column := p.l.Position()
+			tok := &lexer.Token{Op: op, Line: line, Column: column}
+			p.err = &DecodeError{Token: tok, Err: err}
+			// Each instruction consists of exactly one byte.
+			return p.consumed(b) - 1, p.err
+		}
+	}
+}
+
+// consumed returns the number of bytes in b that are read by the lexer.
+func (p *Parser) consumed(b []byte) int {
+	return len(b) - p.chunk.Len() - p.l.Buffered()
+}
+
+// Mode returns the current mode of the lexer.
+func (p *Parser) Mode() lexer.Mode {
+	return p.l.Mode()
+}
+
+// Depth returns the number of values on the stack.
+func (p *Parser) Depth() int {
+	return p.vm().Depth()
+}
+
+// Top returns a copy of the value on the top of the stack.
+// It returns vm.ErrStackEmpty if the stack is empty.
+//
+// Note that the value may be incomplete if the rest of it has not been written yet.
+func (p *Parser) Top() (*types.Value, error) {
+	v, err := p.vm().Top()
+	if err != nil {
+		return nil, err
+	}
+	return v.DeepCopy(), nil
+}
+
+// Pop is the same as Top, but it also removes the value from the stack.
+func (p *Parser) Pop() (*types.Value, error) {
+	return p.vm().Pop()
+}
+
+func (p *Parser) vm() *vm.VM {
+	if p.m == nil {
+		p.m = vm.NewVM(vm.WithStackSize(p.stackSize))
+	}
+	return p.m
+}
@@ -0,0 +1,143 @@
+package watson_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestParserExecutesChunksOfAnySize(t *testing.T) {
+	want := &User{FullName: "Tako Ika", Age: 42}
+	buf, err := watson.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{1, 2, 3, 7, len(buf)} {
+		p := watson.NewParser()
+		for i := 0; i < len(buf); i += size {
+			end := i + size
+			if end > len(buf) {
+				end = len(buf)
+			}
+			n, err := p.Write(buf[i:end])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != end-i {
+				t.Errorf("expected %d bytes to be written but got %d", end-i, n)
+			}
+		}
+		top, err := p.Top()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &User{}
+		err = top.Bind(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("chunk size %d: mismatch (-want +got):\n%s", size, diff)
+		}
+	}
+}
+
+func TestParserKeepsModeAcrossChunks(t *testing.T) {
+	p := watson.NewParser()
+	// Snew Inew Iinc | Sadd
+	_, err := p.Write([]byte("?Sh"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Mode() != lexer.S {
+		t.Errorf("expected mode S but got %d", p.Mode())
+	}
+	_, err = p.Write([]byte("-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := p.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(types.NewStringValue([]byte{1}), top, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParserReportsErrorWithPositionImmediately(t *testing.T) {
+	p := watson.NewParser()
+	_, err := p.Write([]byte("Bu\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Bnew Bneg Bneg Iinc; Iinc fails since the top is a Bool.
+	n, err := p.Write([]byte("zoou"))
+	var decErr *watson.DecodeError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("expected *watson.DecodeError but got %#v", err)
+	}
+	if decErr.Token.Op != vm.Iinc || decErr.Token.Line != 1 || decErr.Token.Column != 3 {
+		t.Errorf("unexpected token: %#v", decErr.Token)
+	}
+	if n != 3 {
+		t.Errorf("expected %d bytes to be written but got %d", 3, n)
+	}
+	if p.Depth() != 2 {
+		t.Errorf("expected depth %d but got %d", 2, p.Depth())
+	}
+	_, err2 := p.Write([]byte("B"))
+	if err2 != err {
+		t.Errorf("expected %v but got %v", err, err2)
+	}
+}
+
+func TestParserPopRemovesTheTop(t *testing.T) {
+	p := watson.NewParser()
+	// Inew Iinc Bnew
+	_, err := p.Write([]byte("Buz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []*types.Value{types.NewBoolValue(false), types.NewIntValue(1)} {
+		got, err := p.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+	_, err = p.Pop()
+	if !errors.Is(err, vm.ErrStackEmpty) {
+		t.Errorf("expected %v but got %v", vm.ErrStackEmpty, err)
+	}
+}
+
+func TestParserTopReturnsACopy(t *testing.T) {
+	p := watson.NewParser()
+	// Anew
+	_, err := p.Write([]byte("@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := p.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Inew Aadd
+	_, err = p.Write([]byte("Bs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(top.Array) != 0 {
+		t.Errorf("the value returned by Top is modified: %#v", top)
+	}
+}
@@ -0,0 +1,183 @@
+// Package asm compiles a small assembly language into `vm.Op`s.
+//
+// Each line of the assembly contains at most one statement, which is either a mnemonic of `vm.Op` (e.g. `Inew`)
+// or a `push` statement that pushes a literal:
+//
+//	push int -42
+//	push uint 0xff
+//	push float 1.5
+//	push str "tako"
+//	push bool true
+//	push nil
+//
+// Anything after `;` (outside of string literals) is a comment.
+// Listings written by `disasm.Disassembler` can also be assembled, in which case the positions, modes and depths are ignored.
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Comment is a character that starts a comment.
+const Comment = ';'
+
+// SyntaxError is an error that occurs when an Assembler finds an invalid statement.
+type SyntaxError struct {
+	Line int    // the line number of the statement, starting from 1
+	Msg  string // the description of the error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Assembler reads assembly and writes corresponding `vm.Op`s to its underlying `lexer.OpWriter`.
+type Assembler struct {
+	w lexer.OpWriter
+	d *dumper.Dumper
+}
+
+// NewAssembler creates a new Assembler that writes to w.
+//
+// If w is a `lexer.Unlexer`, the mode of the output is switched automatically whenever it writes Snew.
+// Note that the Unlexer must be flushed after Assemble returns.
+func NewAssembler(w lexer.OpWriter) *Assembler {
+	return &Assembler{w: w, d: dumper.NewDumper(w)}
+}
+
+// Assemble reads all statements from r and writes them to the underlying writer.
+// It returns a *SyntaxError if it finds an invalid statement.
+func (a *Assembler) Assemble(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	line := 0
+	for sc.Scan() {
+		line++
+		err := a.assembleLine(sc.Text())
+		if err != nil {
+			if e, ok := err.(*SyntaxError); ok {
+				e.Line = line
+			}
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// position matches the position of an instruction at the beginning of a line in a listing.
+var position = regexp.MustCompile(`^[0-9]+:[0-9]+$`)
+
+func (a *Assembler) assembleLine(line string) error {
+	stmt := strings.TrimSpace(stripComment(line))
+	if stmt == "" {
+		return nil
+	}
+	fields := strings.Fields(stmt)
+	if fields[0] == "push" {
+		v, err := parseLiteral(strings.TrimSpace(strings.TrimPrefix(stmt, "push")))
+		if err != nil {
+			return err
+		}
+		return a.d.Dump(v)
+	}
+	listing := false
+	if position.MatchString(fields[0]) {
+		// a line in a listing: POSITION MODE MNEMONIC [DEPTH]
+		listing = true
+		fields = fields[1:]
+		if len(fields) > 0 && (fields[0] == "A" || fields[0] == "S") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			return &SyntaxError{Msg: "missing mnemonic"}
+		}
+	}
+	op, err := vm.ParseOp(fields[0])
+	if err != nil {
+		return &SyntaxError{Msg: fmt.Sprintf("unknown mnemonic: %s", fields[0])}
+	}
+	if len(fields) > 2 || (len(fields) == 2 && !listing) {
+		return &SyntaxError{Msg: fmt.Sprintf("unexpected operand: %s", strings.Join(fields[1:], " "))}
+	}
+	return a.w.Write(op)
+}
+
+// stripComment removes a comment from line.
+func stripComment(line string) string {
+	inString := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == Comment:
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// parseLiteral parses the operands of a push statement.
+func parseLiteral(s string) (*types.Value, error) {
+	kind := s
+	arg := ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		kind = s[:i]
+		arg = strings.TrimSpace(s[i+1:])
+	}
+	switch kind {
+	case "int":
+		n, err := strconv.ParseInt(arg, 0, 64)
+		if err != nil {
+			return nil, invalidLiteral(kind, arg)
+		}
+		return types.NewIntValue(n), nil
+	case "uint":
+		n, err := strconv.ParseUint(arg, 0, 64)
+		if err != nil {
+			return nil, invalidLiteral(kind, arg)
+		}
+		return types.NewUintValue(n), nil
+	case "float":
+		x, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, invalidLiteral(kind, arg)
+		}
+		return types.NewFloatValue(x), nil
+	case "str", "string":
+		str, err := strconv.Unquote(arg)
+		if err != nil || !strings.HasPrefix(arg, `"`) {
+			return nil, invalidLiteral(kind, arg)
+		}
+		return types.NewStringValue([]byte(str)), nil
+	case "bool":
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return nil, invalidLiteral(kind, arg)
+		}
+		return types.NewBoolValue(b), nil
+	case "nil":
+		if arg != "" {
+			return nil, &SyntaxError{Msg: fmt.Sprintf("unexpected operand: %s", arg)}
+		}
+		return types.NewNilValue(), nil
+	case "":
+		return nil, &SyntaxError{Msg: "missing literal"}
+	default:
+		return nil, &SyntaxError{Msg: fmt.Sprintf("unknown type of literal: %s", kind)}
+	}
+}
+
+func invalidLiteral(kind, arg string) error {
+	return &SyntaxError{Msg: fmt.Sprintf("invalid %s literal: %s", kind, arg)}
+}
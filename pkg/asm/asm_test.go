@@ -0,0 +1,130 @@
+package asm
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/disasm"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestAssembleMnemonics(t *testing.T) {
+	got := assemble(t, "Inew\n  Iinc\n\nGdup ; duplicate it\nIadd\n")
+	want := []vm.Op{vm.Inew, vm.Iinc, vm.Gdup, vm.Iadd}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssemblePushLiterals(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want *types.Value
+	}{
+		{"push int -42", types.NewIntValue(-42)},
+		{"push int 0x10", types.NewIntValue(16)},
+		{"push uint 18446744073709551615", types.NewUintValue(math.MaxUint64)},
+		{"push float 1.5", types.NewFloatValue(1.5)},
+		{"push float -inf", types.NewFloatValue(math.Inf(-1))},
+		{`push str "tako; \"ika\""`, types.NewStringValue([]byte(`tako; "ika"`))},
+		{`push string ""`, types.NewStringValue([]byte{})},
+		{"push bool true", types.NewBoolValue(true)},
+		{"push nil ; comment", types.NewNilValue()},
+	} {
+		got := execute(t, assemble(t, tc.src))
+		if diff := cmp.Diff(tc.want, got, typestest.CmpOption); diff != "" {
+			t.Errorf("%s: mismatch (-want +got):\n%s", tc.src, diff)
+		}
+	}
+}
+
+func TestAssembleSwitchesModeOfUnlexer(t *testing.T) {
+	var buf bytes.Buffer
+	u := lexer.NewUnlexer(&buf)
+	err := NewAssembler(u).Assemble(strings.NewReader("Snew\nInew\nIinc\nSadd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff("?Sh-", buf.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssembleListing(t *testing.T) {
+	src := "?SShkShaaaaakShaaaaaak-$BBubaiBo"
+	var listing bytes.Buffer
+	err := disasm.NewDisassembler(&listing, disasm.WithDepth()).Disassemble(lexer.NewLexer(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	u := lexer.NewUnlexer(&buf)
+	err = NewAssembler(u).Assemble(&listing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(src, buf.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssembleReportsSyntaxErrors(t *testing.T) {
+	for _, src := range []string{
+		"Inew\ninew",
+		"Inew\nInew Iinc",
+		"Inew\npush int abc",
+		"Inew\npush str tako",
+		"Inew\npush",
+		"Inew\npush map {}",
+	} {
+		err := NewAssembler(lexer.NewSliceWriter()).Assemble(strings.NewReader(src))
+		var synErr *SyntaxError
+		if !errors.As(err, &synErr) {
+			t.Errorf("%q: expected *SyntaxError but got %#v", src, err)
+			continue
+		}
+		if synErr.Line != 2 {
+			t.Errorf("%q: expected line 2 but got %d", src, synErr.Line)
+		}
+	}
+}
+
+func assemble(t *testing.T, src string) []vm.Op {
+	t.Helper()
+	w := lexer.NewSliceWriter()
+	err := NewAssembler(w).Assemble(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Ops()
+}
+
+func execute(t *testing.T, ops []vm.Op) *types.Value {
+	t.Helper()
+	m := vm.NewVM()
+	err := m.FeedMulti(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := m.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return top
+}
@@ -1,7 +1,18 @@
 // Package cbor provides a way to convert CBOR into types.Value and vice versa.
+//
+// Converting a value into CBOR and back restores the value with the following exceptions:
+//   - Non-negative Ints become Uints.
+//   - Strings and keys of Objects must be valid UTF-8, or they can't be read again.
+//   - Values nested more than 32 levels can't be read again.
+//
+// Byte strings in CBOR are read as Arrays of Uints, and tags are read as Objects that have "number" and "content".
 package cbor
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/fxamacker/cbor/v2"
@@ -9,18 +20,291 @@ import (
 	"github.com/genkami/watson/pkg/types"
 )
 
+const (
+	majorTypeBytes byte = 2
+	majorTypeText  byte = 3
+	majorTypeArray byte = 4
+	majorTypeMap   byte = 5
+	majorTypeTag   byte = 6
+
+	infoIndefinite byte = 31
+	breakCode      byte = 0xff
+)
+
+var errMalformed = errors.New("malformed CBOR data item")
+
 func Decode(w io.Writer, val *types.Value) error {
-	obj := val.ToGoObject()
 	enc := cbor.NewEncoder(w)
-	return enc.Encode(obj)
+	return enc.Encode(toCBOR(val))
+}
+
+// DecodeAll converts each of vals into CBOR and writes them as a CBOR Sequence.
+func DecodeAll(w io.Writer, vals []*types.Value) error {
+	enc := cbor.NewEncoder(w)
+	for _, v := range vals {
+		err := enc.Encode(toCBOR(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object is a CBOR map that is marshaled with its keys in the order they were added.
+type object struct {
+	val *types.Value
+}
+
+func (o *object) MarshalCBOR() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	writeHead(buf, majorTypeMap, uint64(len(o.val.Object)))
+	for _, k := range o.val.OrderedKeys() {
+		key, err := cbor.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		elem, err := cbor.Marshal(toCBOR(o.val.Object[k]))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(elem)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeHead writes the initial byte and the argument of a data item in its shortest form.
+func writeHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= 0xff:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(major | 25)
+		var b [2]byte
+		binary.BigEndian.PutUint16(b[:], uint16(n))
+		buf.Write(b[:])
+	case n <= 0xffffffff:
+		buf.WriteByte(major | 26)
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], uint32(n))
+		buf.Write(b[:])
+	default:
+		buf.WriteByte(major | 27)
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], n)
+		buf.Write(b[:])
+	}
+}
+
+// toCBOR is almost the same as val.ToGoObject but it converts objects into *object to keep the order of their keys.
+func toCBOR(val *types.Value) interface{} {
+	switch val.Kind {
+	case types.Object:
+		return &object{val: val}
+	case types.Array:
+		arr := make([]interface{}, 0, len(val.Array))
+		for _, v := range val.Array {
+			arr = append(arr, toCBOR(v))
+		}
+		return arr
+	default:
+		return val.ToGoObject()
+	}
 }
 
 func Encode(r io.Reader) (*types.Value, error) {
-	var any interface{}
+	var raw cbor.RawMessage
 	dec := cbor.NewDecoder(r)
-	err := dec.Decode(&any)
+	err := dec.Decode(&raw)
+	if err != nil {
+		return nil, err
+	}
+	w := &walker{data: raw}
+	return w.value()
+}
+
+// walker converts a CBOR data item into a Value in a single pass, remembering the order of keys in maps.
+// The data item must have been read by cbor.Decoder, which checks that it is well-formed.
+type walker struct {
+	data []byte
+	pos  int
+}
+
+func (w *walker) value() (*types.Value, error) {
+	if w.pos >= len(w.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch w.data[w.pos] >> 5 {
+	case majorTypeArray:
+		return w.array()
+	case majorTypeMap:
+		return w.object()
+	default:
+		return w.leaf()
+	}
+}
+
+func (w *walker) array() (*types.Value, error) {
+	n, indefinite, err := w.head()
+	if err != nil {
+		return nil, err
+	}
+	vals := make([]*types.Value, 0, n)
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && w.atBreak() {
+			w.pos++
+			break
+		}
+		v, err := w.value()
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return types.NewArrayValue(vals), nil
+}
+
+func (w *walker) object() (*types.Value, error) {
+	n, indefinite, err := w.head()
+	if err != nil {
+		return nil, err
+	}
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	for i := uint64(0); indefinite || i < n; i++ {
+		if indefinite && w.atBreak() {
+			w.pos++
+			break
+		}
+		k, err := w.key()
+		if err != nil {
+			return nil, err
+		}
+		v, err := w.value()
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(k, v)
+	}
+	return obj, nil
+}
+
+func (w *walker) key() (string, error) {
+	var key interface{}
+	err := w.decode(&key)
+	if err != nil {
+		return "", err
+	}
+	k, ok := key.(string)
+	if !ok {
+		return "", fmt.Errorf("can't convert %T to string", key)
+	}
+	return k, nil
+}
+
+// leaf converts a data item that is neither an array nor a map, e.g. a number, a string or a tag.
+// Maps inside tags are converted by ToValue, so the order of their keys is not kept.
+func (w *walker) leaf() (*types.Value, error) {
+	var any interface{}
+	err := w.decode(&any)
 	if err != nil {
 		return nil, err
 	}
 	return types.ToValue(any)
 }
+
+// decode decodes the data item at w.pos into v and moves w.pos to the next one.
+func (w *walker) decode(v interface{}) error {
+	start := w.pos
+	err := w.skip()
+	if err != nil {
+		return err
+	}
+	return cbor.Unmarshal(w.data[start:w.pos], v)
+}
+
+// skip moves w.pos to the next data item.
+func (w *walker) skip() error {
+	if w.pos >= len(w.data) {
+		return io.ErrUnexpectedEOF
+	}
+	major := w.data[w.pos] >> 5
+	n, indefinite, err := w.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorTypeBytes, majorTypeText:
+		if !indefinite {
+			w.pos += int(n)
+			return nil
+		}
+		// Indefinite-length strings consist of definite-length chunks.
+		for !w.atBreak() {
+			err = w.skip()
+			if err != nil {
+				return err
+			}
+		}
+		w.pos++
+	case majorTypeArray, majorTypeMap:
+		if major == majorTypeMap {
+			n *= 2
+		}
+		for i := uint64(0); indefinite || i < n; i++ {
+			if indefinite && w.atBreak() {
+				w.pos++
+				break
+			}
+			err = w.skip()
+			if err != nil {
+				return err
+			}
+		}
+	case majorTypeTag:
+		return w.skip()
+	}
+	// Other data items have nothing after their heads.
+	return nil
+}
+
+// head reads the head of the data item at w.pos and returns its argument and whether it has an indefinite length.
+func (w *walker) head() (uint64, bool, error) {
+	if w.pos >= len(w.data) {
+		return 0, false, io.ErrUnexpectedEOF
+	}
+	n, indefinite, headLen, err := readHead(w.data[w.pos:])
+	if err != nil {
+		return 0, false, err
+	}
+	w.pos += headLen
+	return n, indefinite, nil
+}
+
+func (w *walker) atBreak() bool {
+	return w.pos < len(w.data) && w.data[w.pos] == breakCode
+}
+
+// readHead reads the head of a data item and returns its argument, whether it has an indefinite length, and the length of the head.
+func readHead(data []byte) (n uint64, indefinite bool, headLen int, err error) {
+	info := data[0] & 0x1f
+	switch {
+	case info < 24:
+		return uint64(info), false, 1, nil
+	case info == infoIndefinite:
+		return 0, true, 1, nil
+	case info > 27:
+		return 0, false, 0, errMalformed
+	}
+	size := 1 << (info - 24)
+	if len(data) < 1+size {
+		return 0, false, 0, io.ErrUnexpectedEOF
+	}
+	for _, b := range data[1 : 1+size] {
+		n = n<<8 | uint64(b)
+	}
+	return n, false, 1 + size, nil
+}
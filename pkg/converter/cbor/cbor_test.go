@@ -0,0 +1,108 @@
+package cbor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		testRoundTrip(t, seed)
+	}
+}
+
+// testRoundTrip asserts that every value that CBOR can represent is restored by converting it into CBOR and back.
+//
+// Strings and keys of Objects must be valid UTF-8 since they are converted into text strings.
+// CBOR distinguishes integers only by their signs, so non-negative Ints become Uints.
+func testRoundTrip(t *testing.T, seed int64) {
+	t.Helper()
+	val := typestest.NewGenerator(seed, typestest.WithValidUTF8()).Value()
+	want := normalize(val)
+	got := roundTrip(t, val)
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+	}
+}
+
+// normalize converts val into the value that is expected to be restored from CBOR.
+func normalize(val *types.Value) *types.Value {
+	return typestest.MapScalars(val, func(v *types.Value) *types.Value {
+		if v.Kind == types.Int && v.Int >= 0 {
+			return types.NewUintValue(uint64(v.Int))
+		}
+		return v
+	})
+}
+
+func roundTrip(t *testing.T, val *types.Value) *types.Value {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	err := Decode(buf, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(buf)
+	if err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	return got
+}
+
+func TestEncodeIndefiniteLengthItems(t *testing.T) {
+	// {_ "b": 1, "a": [_ 2, (_ "x", "y")], "c": null}
+	src := []byte{
+		0xbf,
+		0x61, 'b', 0x01,
+		0x61, 'a', 0x9f, 0x02, 0x7f, 0x61, 'x', 0x61, 'y', 0xff, 0xff,
+		0x61, 'c', 0xf6,
+		0xff,
+	}
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("b", types.NewUintValue(1))
+	want.Set("a", types.NewArrayValue([]*types.Value{
+		types.NewUintValue(2),
+		types.NewStringValue([]byte("xy")),
+	}))
+	want.Set("c", types.NewNilValue())
+	got, err := Encode(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodeTag(t *testing.T) {
+	// [100([1, 2]), {"a": 3}]
+	src := []byte{0x82, 0xd8, 0x64, 0x82, 0x01, 0x02, 0xa1, 0x61, 'a', 0x03}
+	tag := types.NewObjectValue(map[string]*types.Value{})
+	tag.Set("number", types.NewUintValue(100))
+	tag.Set("content", types.NewArrayValue([]*types.Value{types.NewUintValue(1), types.NewUintValue(2)}))
+	want := types.NewArrayValue([]*types.Value{
+		tag,
+		types.NewObjectValue(map[string]*types.Value{"a": types.NewUintValue(3)}),
+	})
+	got, err := Encode(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEncodeFailsWhenKeyIsNotString(t *testing.T) {
+	// {1: 2}
+	_, err := Encode(bytes.NewReader([]byte{0xa1, 0x01, 0x02}))
+	if err == nil {
+		t.Errorf("expected an error but got nil")
+	}
+}
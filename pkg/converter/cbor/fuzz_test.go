@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package cbor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		testRoundTrip(t, seed)
+	})
+}
+
+// FuzzEncode asserts that any value converted from CBOR is restored by converting it into CBOR and back, except for the conversions described in testRoundTrip.
+func FuzzEncode(f *testing.F) {
+	for _, src := range []string{
+		"\xf6", "\xf5", "\x20", "\xfb\x3f\xf8\x00\x00\x00\x00\x00\x00", "\x65hello", "\x83\x01\x61a\x80", "\xa2\x61b\x01\x61a\xa1\x61c\xf6", "\xbf\x61a\x01\xff",
+	} {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		val, err := Encode(bytes.NewReader(src))
+		if err != nil {
+			return
+		}
+		// Byte strings become Arrays and tags become Objects, which can make val nested too deeply to be decoded again.
+		if depth(val) > maxNestedLevels {
+			return
+		}
+		got := roundTrip(t, val)
+		if diff := cmp.Diff(normalize(val), got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// maxNestedLevels is the default maximum nesting level of the CBOR decoder.
+const maxNestedLevels = 32
+
+func depth(v *types.Value) int {
+	d := 0
+	switch v.Kind {
+	case types.Object:
+		for _, elem := range v.Object {
+			if n := depth(elem); n > d {
+				d = n
+			}
+		}
+	case types.Array:
+		for _, elem := range v.Array {
+			if n := depth(elem); n > d {
+				d = n
+			}
+		}
+	default:
+		return 0
+	}
+	return d + 1
+}
@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package json
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		testRoundTrip(t, seed)
+	})
+}
+
+// FuzzEncode asserts that any value converted from JSON is restored by converting it into JSON and back.
+func FuzzEncode(f *testing.F) {
+	for _, src := range []string{
+		`null`, `true`, `-1.5e10`, `"hello\u0000"`, `[1, "a", [], {}]`, `{"b": 1, "a": {"c": null}}`,
+	} {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		val, err := Encode(bytes.NewReader(src))
+		if err != nil {
+			return
+		}
+		got := roundTrip(t, val)
+		if diff := cmp.Diff(val, got, cmpopts.EquateEmpty(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
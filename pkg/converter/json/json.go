@@ -1,25 +1,140 @@
 // Package json provides a way to convert JSON into types.Value and vice versa.
+//
+// Converting a value into JSON and back restores the value with the following exceptions:
+//   - Ints and Uints become Floats since all numbers in JSON are read as float64. Large ones lose their precision.
+//   - NaN and infinities can't be converted into JSON.
+//   - Invalid UTF-8 sequences in Strings and keys of Objects are replaced with U+FFFD.
 package json
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 
 	"github.com/genkami/watson/pkg/types"
 )
 
 func Decode(w io.Writer, val *types.Value) error {
-	obj := val.ToGoObject()
 	enc := json.NewEncoder(w)
-	return enc.Encode(obj)
+	return enc.Encode(toJSON(val))
+}
+
+// DecodeAll converts each of vals into JSON and writes them as JSON Lines.
+func DecodeAll(w io.Writer, vals []*types.Value) error {
+	enc := json.NewEncoder(w)
+	for _, v := range vals {
+		err := enc.Encode(toJSON(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object is a JSON object that is marshaled with its keys in the order they were added.
+type object struct {
+	val *types.Value
+}
+
+func (o *object) MarshalJSON() ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	for i, k := range o.val.OrderedKeys() {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		elem, err := json.Marshal(toJSON(o.val.Object[k]))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(elem)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// toJSON is almost the same as val.ToGoObject but it converts objects into *object to keep the order of their keys.
+func toJSON(val *types.Value) interface{} {
+	switch val.Kind {
+	case types.Object:
+		return &object{val: val}
+	case types.Array:
+		arr := make([]interface{}, 0, len(val.Array))
+		for _, v := range val.Array {
+			arr = append(arr, toJSON(v))
+		}
+		return arr
+	default:
+		return val.ToGoObject()
+	}
 }
 
 func Encode(r io.Reader) (*types.Value, error) {
-	var any interface{}
 	dec := json.NewDecoder(r)
-	err := dec.Decode(&any)
+	return decodeValue(dec)
+}
+
+// decodeValue reads a JSON value token by token so that the order of keys in objects is not lost.
+func decodeValue(dec *json.Decoder) (*types.Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		return decodeObject(dec)
+	case json.Delim('['):
+		return decodeArray(dec)
+	default:
+		return types.ToValue(tok)
+	}
+}
+
+func decodeObject(dec *json.Decoder) (*types.Value, error) {
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("can't convert %T to string", tok)
+		}
+		v, err := decodeValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(k, v)
+	}
+	// consumes '}'
+	_, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func decodeArray(dec *json.Decoder) (*types.Value, error) {
+	arr := make([]*types.Value, 0)
+	for dec.More() {
+		v, err := decodeValue(dec)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+	}
+	// consumes ']'
+	_, err := dec.Token()
 	if err != nil {
 		return nil, err
 	}
-	return types.ToValue(any)
+	return types.NewArrayValue(arr), nil
 }
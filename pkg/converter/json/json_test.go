@@ -0,0 +1,55 @@
+package json
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		testRoundTrip(t, seed)
+	}
+}
+
+// testRoundTrip asserts that every value that JSON can represent is restored by converting it into JSON and back.
+//
+// JSON can't represent NaN nor infinity, and invalid UTF-8 sequences are replaced with U+FFFD.
+// Since all numbers are converted into Floats, Ints and Uints can't be restored and large ones lose their precision.
+func testRoundTrip(t *testing.T, seed int64) {
+	t.Helper()
+	val := typestest.NewGenerator(seed, typestest.WithFiniteFloats(), typestest.WithValidUTF8()).Value()
+	want := typestest.MapScalars(val, func(v *types.Value) *types.Value {
+		switch v.Kind {
+		case types.Int:
+			return types.NewFloatValue(float64(v.Int))
+		case types.Uint:
+			return types.NewFloatValue(float64(v.Uint))
+		default:
+			return v
+		}
+	})
+	got := roundTrip(t, val)
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), typestest.CmpOption); diff != "" {
+		t.Errorf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+	}
+}
+
+func roundTrip(t *testing.T, val *types.Value) *types.Value {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	err := Decode(buf, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(buf)
+	if err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	return got
+}
@@ -0,0 +1,42 @@
+//go:build go1.18
+// +build go1.18
+
+package msgpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		testRoundTrip(t, seed)
+	})
+}
+
+// FuzzEncode asserts that any value converted from MessagePack is restored by converting it into MessagePack and back.
+func FuzzEncode(f *testing.F) {
+	for _, src := range []string{
+		"\xc0", "\xc3", "\xff", "\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00", "\xa5hello", "\x93\x01\xa1a\x90", "\x82\xa1b\x01\xa1a\x81\xa1c\xc0",
+	} {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		val, err := Encode(bytes.NewReader(src))
+		if err != nil {
+			return
+		}
+		got := roundTrip(t, val)
+		if diff := cmp.Diff(val, got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 // Package msgpack provides a way to convert MessagePack into types.Value and vice versa.
+//
+// Converting a value into MessagePack and back always restores the value.
 package msgpack
 
 import (
+	"fmt"
 	"io"
 
 	"github.com/vmihailenco/msgpack"
@@ -10,17 +13,123 @@ import (
 )
 
 func Decode(w io.Writer, val *types.Value) error {
-	obj := val.ToGoObject()
 	enc := msgpack.NewEncoder(w)
-	return enc.Encode(obj)
+	return enc.Encode(toMsgpack(val))
+}
+
+// DecodeAll converts each of vals into MessagePack and writes them in sequence.
+func DecodeAll(w io.Writer, vals []*types.Value) error {
+	enc := msgpack.NewEncoder(w)
+	for _, v := range vals {
+		err := enc.Encode(toMsgpack(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// object is a MessagePack map that is encoded with its keys in the order they were added.
+type object struct {
+	val *types.Value
+}
+
+func (o *object) EncodeMsgpack(enc *msgpack.Encoder) error {
+	err := enc.EncodeMapLen(len(o.val.Object))
+	if err != nil {
+		return err
+	}
+	for _, k := range o.val.OrderedKeys() {
+		err = enc.EncodeString(k)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(toMsgpack(o.val.Object[k]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toMsgpack is almost the same as val.ToGoObject but it converts objects into *object to keep the order of their keys.
+func toMsgpack(val *types.Value) interface{} {
+	switch val.Kind {
+	case types.Object:
+		return &object{val: val}
+	case types.Array:
+		arr := make([]interface{}, 0, len(val.Array))
+		for _, v := range val.Array {
+			arr = append(arr, toMsgpack(v))
+		}
+		return arr
+	default:
+		return val.ToGoObject()
+	}
 }
 
 func Encode(r io.Reader) (*types.Value, error) {
-	var any interface{}
 	dec := msgpack.NewDecoder(r)
-	err := dec.Decode(&any)
+	dec.SetDecodeMapFunc(decodeMap)
+	any, err := dec.DecodeInterface()
+	if err != nil {
+		return nil, err
+	}
+	return fromMsgpack(any)
+}
+
+// decodeMap decodes a map into *types.Value so that the order of its keys is not lost.
+func decodeMap(dec *msgpack.Decoder) (interface{}, error) {
+	size, err := dec.DecodeMapLen()
 	if err != nil {
 		return nil, err
 	}
-	return types.ToValue(any)
+	if size == -1 {
+		return nil, nil
+	}
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	for i := 0; i < size; i++ {
+		key, err := dec.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		var k string
+		switch key := key.(type) {
+		case string:
+			k = key
+		case []byte:
+			k = string(key)
+		default:
+			return nil, fmt.Errorf("can't convert %T to string", key)
+		}
+		elem, err := dec.DecodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		v, err := fromMsgpack(elem)
+		if err != nil {
+			return nil, err
+		}
+		obj.Set(k, v)
+	}
+	return obj, nil
+}
+
+func fromMsgpack(any interface{}) (*types.Value, error) {
+	switch any := any.(type) {
+	case *types.Value:
+		return any, nil
+	case []interface{}:
+		arr := make([]*types.Value, 0, len(any))
+		for _, elem := range any {
+			v, err := fromMsgpack(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return types.NewArrayValue(arr), nil
+	default:
+		return types.ToValue(any)
+	}
 }
@@ -0,0 +1,42 @@
+package msgpack
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		testRoundTrip(t, seed)
+	}
+}
+
+// testRoundTrip asserts that every value is restored by converting it into MessagePack and back without any loss.
+func testRoundTrip(t *testing.T, seed int64) {
+	t.Helper()
+	want := typestest.NewGenerator(seed).Value()
+	got := roundTrip(t, want)
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+	}
+}
+
+func roundTrip(t *testing.T, val *types.Value) *types.Value {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	err := Decode(buf, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(buf)
+	if err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	return got
+}
@@ -0,0 +1,46 @@
+//go:build go1.18
+// +build go1.18
+
+package yaml
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func FuzzRoundTrip(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		testRoundTrip(t, seed)
+	})
+}
+
+// FuzzEncode asserts that any value converted from YAML is restored by converting it into YAML and back, except for the conversions described in testRoundTrip.
+func FuzzEncode(f *testing.F) {
+	for _, src := range []string{
+		"~", "true", "-1.5e10", "'~'", "- 1\n- a\n- []\n- {}\n", "b: 1\na:\n  c: null\n", "a\n---\nb\n", "!!binary AAE=",
+	} {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		val, err := Encode(bytes.NewReader(src))
+		if err != nil {
+			return
+		}
+		if val.Kind == types.Array && len(val.Array) < 2 {
+			return
+		}
+		got := roundTrip(t, val)
+		if diff := cmp.Diff(normalize(val), got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
@@ -1,8 +1,15 @@
 // Package yaml provides a way to convert YAML into types.Value and vice versa.
+//
+// Converting a value into YAML and back restores the value with the following exceptions:
+//   - Uints that fit in int64 become Ints.
+//   - Floats that are written as integers (e.g. 1.0 and -0.0) become Ints.
+//   - Each element of an Array at the top level is written as a separate document, and multiple documents are read as an Array.
+//     Therefore an Array with only one element becomes the element itself, and an empty Array can't be read again.
 package yaml
 
 import (
 	"errors"
+	"fmt"
 	"io"
 
 	"gopkg.in/yaml.v2"
@@ -11,15 +18,13 @@ import (
 )
 
 func Decode(w io.Writer, val *types.Value) error {
-	obj := val.ToGoObject()
 	enc := yaml.NewEncoder(w)
 	defer enc.Close()
-	arr, ok := obj.([]interface{})
-	if !ok {
-		return enc.Encode(obj)
+	if val.Kind != types.Array {
+		return enc.Encode(toYaml(val))
 	}
-	for _, v := range arr {
-		err := enc.Encode(v)
+	for _, v := range val.Array {
+		err := enc.Encode(toYaml(v))
 		if err != nil {
 			return err
 		}
@@ -27,19 +32,52 @@ func Decode(w io.Writer, val *types.Value) error {
 	return nil
 }
 
+// DecodeAll converts each of vals into a YAML document.
+func DecodeAll(w io.Writer, vals []*types.Value) error {
+	enc := yaml.NewEncoder(w)
+	defer enc.Close()
+	for _, v := range vals {
+		err := enc.Encode(toYaml(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toYaml is almost the same as val.ToGoObject but it converts objects into yaml.MapSlice to keep the order of their keys.
+func toYaml(val *types.Value) interface{} {
+	switch val.Kind {
+	case types.Object:
+		obj := make(yaml.MapSlice, 0, len(val.Object))
+		for _, k := range val.OrderedKeys() {
+			obj = append(obj, yaml.MapItem{Key: k, Value: toYaml(val.Object[k])})
+		}
+		return obj
+	case types.Array:
+		arr := make([]interface{}, 0, len(val.Array))
+		for _, v := range val.Array {
+			arr = append(arr, toYaml(v))
+		}
+		return arr
+	default:
+		return val.ToGoObject()
+	}
+}
+
 func Encode(r io.Reader) (*types.Value, error) {
-	var any interface{}
 	dec := yaml.NewDecoder(r)
 	results := make([]*types.Value, 0)
 	for {
-		err := dec.Decode(&any)
+		var n node
+		err := dec.Decode(&n)
 		if err != nil {
 			if errors.Is(err, io.EOF) && len(results) > 0 {
 				break
 			}
 			return nil, err
 		}
-		v, err := types.ToValue(any)
+		v, err := fromYaml(n.v)
 		if err != nil {
 			return nil, err
 		}
@@ -51,3 +89,79 @@ func Encode(r io.Reader) (*types.Value, error) {
 		return types.NewArrayValue(results), nil
 	}
 }
+
+// node is an arbitrary YAML node that remembers the order of keys in mappings.
+type node struct {
+	v interface{}
+}
+
+func (n *node) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var any interface{}
+	err := unmarshal(&any)
+	if err != nil {
+		return err
+	}
+	switch any.(type) {
+	case map[interface{}]interface{}:
+		// Mappings that are nested in yaml.MapSlice are also decoded as yaml.MapSlice.
+		var obj yaml.MapSlice
+		err = unmarshal(&obj)
+		n.v = obj
+	case []interface{}:
+		// Elements are not pointers so that null elements become empty nodes and quoted strings that look like null are passed to UnmarshalText.
+		var arr []node
+		err = unmarshal(&arr)
+		n.v = arr
+	default:
+		n.v = any
+	}
+	return err
+}
+
+// UnmarshalText is called instead of UnmarshalYAML when the node is a quoted string that looks like null, e.g. "~" and "null",
+// since yaml.v2 does not pass such a node to UnmarshalYAML.
+func (n *node) UnmarshalText(text []byte) error {
+	n.v = string(text)
+	return nil
+}
+
+func fromYaml(any interface{}) (*types.Value, error) {
+	switch any := any.(type) {
+	case yaml.MapSlice:
+		obj := types.NewObjectValue(map[string]*types.Value{})
+		for _, item := range any {
+			k, ok := item.Key.(string)
+			if !ok {
+				return nil, fmt.Errorf("can't convert %T to string", item.Key)
+			}
+			v, err := fromYaml(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(k, v)
+		}
+		return obj, nil
+	case []node:
+		arr := make([]*types.Value, 0, len(any))
+		for _, n := range any {
+			v, err := fromYaml(n.v)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return types.NewArrayValue(arr), nil
+	case []interface{}:
+		arr := make([]*types.Value, 0, len(any))
+		for _, elem := range any {
+			v, err := fromYaml(elem)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return types.NewArrayValue(arr), nil
+	default:
+		return types.ToValue(any)
+	}
+}
@@ -0,0 +1,89 @@
+package yaml
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestRoundTrip(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		testRoundTrip(t, seed)
+	}
+}
+
+func TestRoundTripStringsThatLookLikeNull(t *testing.T) {
+	for _, s := range []string{"~", "null", "Null", "NULL", ""} {
+		want := types.NewArrayValue([]*types.Value{
+			types.NewStringValue([]byte(s)),
+			types.NewArrayValue([]*types.Value{types.NewStringValue([]byte(s))}),
+			types.NewObjectValue(map[string]*types.Value{s: types.NewStringValue([]byte(s))}),
+		})
+		got := roundTrip(t, want)
+		if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), typestest.CmpOption); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", s, diff)
+		}
+	}
+}
+
+// testRoundTrip asserts that every value is restored by converting it into YAML and back.
+//
+// Since Decode writes each element of an Array as a separate document and Encode reads them as an Array,
+// Arrays with less than two elements are not restored unless they are nested in other values.
+// YAML does not distinguish Ints from Uints and integral Floats, so Uints that fit in Ints and Floats that are written as integers become Ints.
+func testRoundTrip(t *testing.T, seed int64) {
+	t.Helper()
+	val := typestest.NewGenerator(seed).Value()
+	if val.Kind == types.Array && len(val.Array) < 2 {
+		return
+	}
+	want := normalize(val)
+	got := roundTrip(t, val)
+	if diff := cmp.Diff(want, got, cmpopts.EquateEmpty(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+	}
+}
+
+// normalize converts val into the value that is expected to be restored from YAML.
+func normalize(val *types.Value) *types.Value {
+	return typestest.MapScalars(val, func(v *types.Value) *types.Value {
+		switch {
+		case v.Kind == types.Uint && v.Uint <= math.MaxInt64:
+			return types.NewIntValue(int64(v.Uint))
+		case v.Kind == types.Float && isIntegral(v.Float):
+			return types.NewIntValue(int64(v.Float))
+		default:
+			return v
+		}
+	})
+}
+
+// isIntegral reports whether x is written as an integer.
+func isIntegral(x float64) bool {
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return false
+	}
+	return !strings.ContainsAny(strconv.FormatFloat(x, 'g', -1, 64), ".e")
+}
+
+func roundTrip(t *testing.T, val *types.Value) *types.Value {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	err := Decode(buf, val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Encode(buf)
+	if err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	return got
+}
@@ -0,0 +1,142 @@
+// Package diff computes structural differences between two values.
+package diff
+
+import (
+	"fmt"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+// Kind is a kind of Change.
+type Kind int
+
+const (
+	Added   Kind = iota // a key or an element that is only in the new value
+	Removed             // a key or an element that is only in the old value
+	Changed             // a value that is replaced by another one
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case Changed:
+		return "changed"
+	default:
+		panic(fmt.Errorf("invalid kind: %d", int(k)))
+	}
+}
+
+// Change is a difference between two values.
+type Change struct {
+	Kind Kind
+	Path types.Path
+	Old  *types.Value // nil if Kind is Added
+	New  *types.Value // nil if Kind is Removed
+}
+
+// Diff returns the changes that turn from into to.
+//
+// Objects are compared key by key, and Arrays are compared element by element after matching equal elements in order,
+// so that inserting or removing an element does not change the following ones.
+// If Arrays differ in too many elements to match them (see Match), they are compared position by position instead.
+// Elements that are replaced by others at the same position are compared recursively.
+// Paths of removed elements are their indices in from, and paths of other elements are their indices in to.
+//
+// Values are compared by types.Value.Equal with the given options.
+func Diff(from, to *types.Value, opts ...types.CompareOption) []Change {
+	d := &differ{opts: opts}
+	d.diff(types.RootPath(), from, to)
+	return d.changes
+}
+
+type differ struct {
+	opts    []types.CompareOption
+	changes []Change
+}
+
+func (d *differ) diff(path types.Path, from, to *types.Value) {
+	if from.Equal(to, d.opts...) {
+		return
+	}
+	switch {
+	case from.Kind == types.Object && to.Kind == types.Object:
+		d.diffObjects(path, from, to)
+	case from.Kind == types.Array && to.Kind == types.Array:
+		d.diffArrays(path, from.Array, to.Array)
+	default:
+		d.add(Change{Kind: Changed, Path: path, Old: from, New: to})
+	}
+}
+
+func (d *differ) diffObjects(path types.Path, from, to *types.Value) {
+	for _, k := range from.OrderedKeys() {
+		if v, ok := to.Object[k]; ok {
+			d.diff(path.Field(k), from.Object[k], v)
+		} else {
+			d.add(Change{Kind: Removed, Path: path.Field(k), Old: from.Object[k]})
+		}
+	}
+	for _, k := range to.OrderedKeys() {
+		if _, ok := from.Object[k]; !ok {
+			d.add(Change{Kind: Added, Path: path.Field(k), New: to.Object[k]})
+		}
+	}
+}
+
+func (d *differ) diffArrays(path types.Path, from, to []*types.Value) {
+	// The common prefix and suffix, which are usually most of the elements, are skipped before matching the rest.
+	start := 0
+	for start < len(from) && start < len(to) && from[start].Equal(to[start], d.opts...) {
+		start++
+	}
+	end := 0
+	for start+end < len(from) && start+end < len(to) && from[len(from)-1-end].Equal(to[len(to)-1-end], d.opts...) {
+		end++
+	}
+	from, to = from[start:len(from)-end], to[start:len(to)-end]
+	i, j := 0, 0
+	for _, m := range d.match(from, to) {
+		d.diffUnmatched(path, from[i:m.From], to[j:m.To], start+i, start+j)
+		i, j = m.From+1, m.To+1
+	}
+	d.diffUnmatched(path, from[i:], to[j:], start+i, start+j)
+}
+
+// diffUnmatched compares elements between two matched ones.
+// Elements at the same position are compared recursively, and the rest are removed or added.
+func (d *differ) diffUnmatched(path types.Path, from, to []*types.Value, fromOffset, toOffset int) {
+	k := 0
+	for ; k < len(from) && k < len(to); k++ {
+		d.diff(path.Index(toOffset+k), from[k], to[k])
+	}
+	for i := k; i < len(from); i++ {
+		d.add(Change{Kind: Removed, Path: path.Index(fromOffset + i), Old: from[i]})
+	}
+	for j := k; j < len(to); j++ {
+		d.add(Change{Kind: Added, Path: path.Index(toOffset + j), New: to[j]})
+	}
+}
+
+// match matches equal elements of from and to. See Match for details.
+func (d *differ) match(from, to []*types.Value) []Pair {
+	// Hashes are compared first since comparing values is expensive.
+	fromHashes, toHashes := d.hashes(from), d.hashes(to)
+	return Match(len(from), len(to), func(i, j int) bool {
+		return fromHashes[i] == toHashes[j] && from[i].Equal(to[j], d.opts...)
+	})
+}
+
+func (d *differ) hashes(vals []*types.Value) []uint64 {
+	hashes := make([]uint64, 0, len(vals))
+	for _, v := range vals {
+		hashes = append(hashes, v.Hash(d.opts...))
+	}
+	return hashes
+}
+
+func (d *differ) add(c Change) {
+	d.changes = append(d.changes, c)
+}
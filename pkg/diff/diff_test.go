@@ -0,0 +1,222 @@
+package diff
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+func TestDiff(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		from, to *types.Value
+		opts     []types.CompareOption
+		want     []string
+	}{
+		{
+			name: "equal values",
+			from: obj("a", arr(i(1), i(2))),
+			to:   obj("a", arr(i(1), i(2))),
+			want: nil,
+		},
+		{
+			name: "scalars",
+			from: i(1),
+			to:   s("one"),
+			want: []string{"changed <root>: 1 -> one"},
+		},
+		{
+			name: "keys",
+			from: obj("a", i(1), "b", i(2), "c", i(3)),
+			to:   obj("d", i(4), "c", i(3), "a", i(10)),
+			want: []string{
+				"changed <root>.a: 1 -> 10",
+				"removed <root>.b: 2",
+				"added <root>.d: 4",
+			},
+		},
+		{
+			name: "nested objects",
+			from: obj("a", obj("b", obj("c", i(1)))),
+			to:   obj("a", obj("b", obj("c", i(2)))),
+			want: []string{"changed <root>.a.b.c: 1 -> 2"},
+		},
+		{
+			name: "insertion into an array",
+			from: arr(i(1), i(2), i(3), i(4)),
+			to:   arr(i(1), i(2), i(5), i(3), i(4)),
+			want: []string{"added <root>[2]: 5"},
+		},
+		{
+			name: "removal from an array",
+			from: arr(i(1), i(2), i(3), i(4)),
+			to:   arr(i(1), i(3), i(4)),
+			want: []string{"removed <root>[1]: 2"},
+		},
+		{
+			name: "replacement in an array",
+			from: arr(i(1), obj("a", i(2)), i(3)),
+			to:   arr(i(1), obj("a", i(20)), i(3)),
+			want: []string{"changed <root>[1].a: 2 -> 20"},
+		},
+		{
+			name: "replacement and insertion in an array",
+			from: arr(i(1), i(2), i(3)),
+			to:   arr(i(1), i(20), i(21), i(3)),
+			want: []string{
+				"changed <root>[1]: 2 -> 20",
+				"added <root>[2]: 21",
+			},
+		},
+		{
+			name: "arrays without common elements",
+			from: arr(i(1), i(2)),
+			to:   arr(i(3)),
+			want: []string{
+				"changed <root>[0]: 1 -> 3",
+				"removed <root>[1]: 2",
+			},
+		},
+		{
+			name: "different kinds",
+			from: obj("a", i(1)),
+			to:   arr(i(1)),
+			want: []string{"changed <root>: {a: 1} -> [1]"},
+		},
+		{
+			name: "numbers of different kinds",
+			from: arr(i(1), types.NewUintValue(2)),
+			to:   arr(types.NewFloatValue(1), i(2)),
+			want: []string{
+				"changed <root>[0]: 1 -> 1",
+				"changed <root>[1]: 2 -> 2",
+			},
+		},
+		{
+			name: "numbers of different kinds with numeric equality",
+			from: arr(i(1), types.NewUintValue(2)),
+			to:   arr(types.NewFloatValue(1), i(2)),
+			opts: []types.CompareOption{types.WithNumericEquality()},
+			want: nil,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Diff(tc.from, tc.to, tc.opts...) {
+				got = append(got, describe(c))
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffLargeArrays(t *testing.T) {
+	n := 30000
+	from := make([]*types.Value, 0, n)
+	for k := 0; k < n; k++ {
+		from = append(from, obj("id", i(int64(k))))
+	}
+	// An element is removed from and another one is inserted into the middle of the Array.
+	to := append(append(append([]*types.Value{}, from[:n/3]...), from[n/3+1:2*n/3]...), append([]*types.Value{s("new")}, from[2*n/3:]...)...)
+	var got []string
+	for _, c := range Diff(arr(from...), arr(to...)) {
+		got = append(got, describe(c))
+	}
+	want := []string{
+		fmt.Sprintf("removed <root>[%d]: {id: %d}", n/3, n/3),
+		fmt.Sprintf("added <root>[%d]: new", 2*n/3-1),
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// Arrays without common elements are compared position by position.
+	to = make([]*types.Value, 0, n)
+	for k := 0; k < n; k++ {
+		to = append(to, obj("id", i(int64(n+k))))
+	}
+	changes := Diff(arr(from...), arr(to...))
+	if len(changes) != n {
+		t.Fatalf("expected %d changes but got %d", n, len(changes))
+	}
+	if got, want := describe(changes[0]), fmt.Sprintf("changed <root>[0].id: 0 -> %d", n); got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+}
+
+func TestKindString(t *testing.T) {
+	for k, want := range map[Kind]string{Added: "added", Removed: "removed", Changed: "changed"} {
+		if got := k.String(); got != want {
+			t.Errorf("expected %#v but got %#v", want, got)
+		}
+	}
+}
+
+func describe(c Change) string {
+	switch c.Kind {
+	case Added:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, show(c.New))
+	case Removed:
+		return fmt.Sprintf("%s %s: %s", c.Kind, c.Path, show(c.Old))
+	default:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, c.Path, show(c.Old), show(c.New))
+	}
+}
+
+func show(v *types.Value) string {
+	switch v.Kind {
+	case types.Int:
+		return fmt.Sprint(v.Int)
+	case types.Uint:
+		return fmt.Sprint(v.Uint)
+	case types.Float:
+		return fmt.Sprint(v.Float)
+	case types.String:
+		return string(v.String)
+	case types.Object:
+		s := "{"
+		for i, k := range v.OrderedKeys() {
+			if i > 0 {
+				s += ", "
+			}
+			s += fmt.Sprintf("%s: %s", k, show(v.Object[k]))
+		}
+		return s + "}"
+	case types.Array:
+		s := "["
+		for i, elem := range v.Array {
+			if i > 0 {
+				s += ", "
+			}
+			s += show(elem)
+		}
+		return s + "]"
+	default:
+		return fmt.Sprintf("%#v", v.Kind)
+	}
+}
+
+func i(n int64) *types.Value {
+	return types.NewIntValue(n)
+}
+
+func s(str string) *types.Value {
+	return types.NewStringValue([]byte(str))
+}
+
+func arr(elems ...*types.Value) *types.Value {
+	return types.NewArrayValue(elems)
+}
+
+func obj(kvs ...interface{}) *types.Value {
+	v := types.NewObjectValue(map[string]*types.Value{})
+	for k := 0; k < len(kvs); k += 2 {
+		v.Set(kvs[k].(string), kvs[k+1].(*types.Value))
+	}
+	return v
+}
@@ -0,0 +1,81 @@
+package diff
+
+// MaxEdits is the maximum number of elements that Match removes and adds to find matching elements.
+const MaxEdits = 1000
+
+// Pair is a pair of indices of equal elements in two sequences.
+type Pair struct {
+	From, To int
+}
+
+// Match returns the longest common subsequence of two sequences as Pairs in ascending order,
+// where n and m are the lengths of them and equal(i, j) reports whether the i-th element of the first one equals the j-th element of the second one.
+//
+// It uses the algorithm of Myers, which takes O((n+m)D) time where D is the number of elements that are not in the subsequence.
+// If D is more than MaxEdits, it gives up and returns no Pairs, in which case callers should compare the elements position by position.
+func Match(n, m int, equal func(i, j int) bool) []Pair {
+	max := n + m
+	if max > MaxEdits {
+		max = MaxEdits
+	}
+	// v[offset+k] is the furthest x on the diagonal k (= x - y) that is reached with d edits,
+	// and trace[d][d+k] is its snapshot for each d, which is used to find the path backwards.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && equal(x, y) {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+	}
+	return nil
+}
+
+// backtrack follows the path found by Match from the end to the beginning, and returns the Pairs on the path in ascending order.
+func backtrack(trace [][]int, n, m int) []Pair {
+	var pairs []Pair
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		// (midX, midY) is where the diagonal move that ends at (x, y) begins, which is reached from (prevX, prevY) by an edit.
+		prevX, prevY, midX, midY := 0, 0, 0, 0
+		if d > 0 {
+			k := x - y
+			prev := trace[d-1]
+			if k == -d || (k != d && prev[d-1+k-1] < prev[d-1+k+1]) {
+				prevX = prev[d-1+k+1]
+				prevY = prevX - (k + 1)
+				midX, midY = prevX, prevY+1
+			} else {
+				prevX = prev[d-1+k-1]
+				prevY = prevX - (k - 1)
+				midX, midY = prevX+1, prevY
+			}
+		}
+		for x > midX && y > midY {
+			x--
+			y--
+			pairs = append(pairs, Pair{From: x, To: y})
+		}
+		x, y = prevX, prevY
+	}
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return pairs
+}
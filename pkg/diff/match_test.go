@@ -0,0 +1,65 @@
+package diff
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestMatchFindsLongestCommonSubsequence(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 3000; n++ {
+		a, b := randomSequence(r), randomSequence(r)
+		pairs := Match(len(a), len(b), func(i, j int) bool { return a[i] == b[j] })
+		for k, p := range pairs {
+			if a[p.From] != b[p.To] {
+				t.Fatalf("%v, %v: %v is not a pair of equal elements", a, b, p)
+			}
+			if k > 0 && (p.From <= pairs[k-1].From || p.To <= pairs[k-1].To) {
+				t.Fatalf("%v, %v: %v is not in ascending order", a, b, pairs)
+			}
+		}
+		if want := lcsLength(a, b); len(pairs) != want {
+			t.Fatalf("%v, %v: expected %d pairs but got %v", a, b, want, pairs)
+		}
+	}
+}
+
+func TestMatchGivesUpWhenThereAreTooManyEdits(t *testing.T) {
+	n := MaxEdits
+	pairs := Match(n, n, func(i, j int) bool { return i == j && i != 0 && i != n-1 })
+	if len(pairs) != n-2 {
+		t.Errorf("expected %d pairs but got %d", n-2, len(pairs))
+	}
+	pairs = Match(n, n, func(i, j int) bool { return false })
+	if pairs != nil {
+		t.Errorf("expected no pairs but got %d", len(pairs))
+	}
+}
+
+func randomSequence(r *rand.Rand) []int {
+	s := make([]int, r.Intn(12))
+	for i := range s {
+		s[i] = r.Intn(4)
+	}
+	return s
+}
+
+// lcsLength is the reference implementation of Match.
+func lcsLength(a, b []int) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	return lcs[0][0]
+}
@@ -0,0 +1,231 @@
+// Package disasm converts Watson Representation into a human-readable listing of `vm.Op`s.
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Instruction is an instruction in a listing.
+type Instruction struct {
+	Token *lexer.Token // the instruction and its position
+	Mode  lexer.Mode   // the mode of the lexer when it read the instruction
+
+	// Depth is the number of values on the stack after the instruction is executed.
+	// It is -1 if the instruction is not executed because the VM failed before it.
+	Depth int
+
+	// Err is an error that the VM returned when it executed the instruction.
+	Err error
+
+	// Annotation describes the value that is built by a sequence of instructions that ends with this instruction, e.g. `int 123`.
+	// It is empty if the instruction does not end such sequence.
+	Annotation string
+
+	top *types.Value // the top of the stack after the instruction is executed
+}
+
+// Disassembler reads Watson Representation and writes its listing.
+type Disassembler struct {
+	w         io.Writer
+	stackSize int
+	showDepth bool
+}
+
+// DisassemblerOption configures a Disassembler.
+type DisassemblerOption interface {
+	apply(*Disassembler)
+}
+
+type disassemblerOption func(*Disassembler)
+
+func (opt disassemblerOption) apply(d *Disassembler) {
+	opt(d)
+}
+
+// WithStackSize sets the stack size of the VM that a Disassembler uses to analyze instructions.
+func WithStackSize(size int) DisassemblerOption {
+	return disassemblerOption(func(d *Disassembler) {
+		d.stackSize = size
+	})
+}
+
+// WithDepth makes a Disassembler write the depth of the stack after each instruction.
+func WithDepth() DisassemblerOption {
+	return disassemblerOption(func(d *Disassembler) {
+		d.showDepth = true
+	})
+}
+
+// NewDisassembler creates a new Disassembler that writes listings to w.
+func NewDisassembler(w io.Writer, opts ...DisassemblerOption) *Disassembler {
+	d := &Disassembler{w: w}
+	for _, opt := range opts {
+		opt.apply(d)
+	}
+	return d
+}
+
+// Disassemble reads all instructions from l and writes their listing to the underlying writer.
+// Each line consists of the position, the mode, the mnemonic and optionally the depth of the stack, followed by an annotation if any.
+func (d *Disassembler) Disassemble(l *lexer.Lexer) error {
+	insts, err := d.Analyze(l)
+	if err != nil {
+		return err
+	}
+	for _, inst := range insts {
+		err = d.write(inst)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Analyze reads all instructions from l and executes them to annotate.
+// It returns an error only if l fails; an error returned by the VM is stored in the Instruction that caused it.
+func (d *Disassembler) Analyze(l *lexer.Lexer) ([]*Instruction, error) {
+	insts := make([]*Instruction, 0)
+	m := vm.NewVM(vm.WithStackSize(d.stackSize))
+	failed := false
+	for {
+		mode := l.Mode()
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		inst := &Instruction{Token: tok, Mode: mode, Depth: -1}
+		insts = append(insts, inst)
+		if failed {
+			continue
+		}
+		err = m.Feed(tok.Op)
+		if err != nil {
+			inst.Err = err
+			failed = true
+			continue
+		}
+		inst.Depth = m.Depth()
+		// Numbers and strings on the stack are never modified in place, so it is safe to keep the top without copying it.
+		inst.top, _ = m.Top()
+	}
+	annotate(insts)
+	return insts, nil
+}
+
+func (d *Disassembler) write(inst *Instruction) error {
+	var b strings.Builder
+	pos := fmt.Sprintf("%d:%d", inst.Token.Line+1, inst.Token.Column+1)
+	fmt.Fprintf(&b, "%-10s %s  %#v", pos, modeName(inst.Mode), inst.Token.Op)
+	if d.showDepth {
+		if inst.Depth < 0 {
+			fmt.Fprintf(&b, "  %5s", "-")
+		} else {
+			fmt.Fprintf(&b, "  %5d", inst.Depth)
+		}
+	}
+	if inst.Err != nil {
+		fmt.Fprintf(&b, "  ; error: %s", inst.Err.Error())
+	} else if inst.Annotation != "" {
+		fmt.Fprintf(&b, "  ; %s", inst.Annotation)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(d.w, b.String())
+	return err
+}
+
+// annotate finds sequences of instructions that build a single int or string and annotates their last instructions.
+//
+// A sequence that builds an int consists of integer operations that leave exactly one more value on the stack, and optionally ends with Itof or Itou.
+// A sequence that builds a string starts with Snew and ends with the last Sadd that follows it.
+func annotate(insts []*Instruction) {
+	op := func(i int) vm.Op {
+		return insts[i].Token.Op
+	}
+	for i := 0; i < len(insts); {
+		if insts[i].Depth < 0 {
+			break
+		}
+		last := -1
+		switch {
+		case isIntOp(op(i)):
+			base := depthBefore(insts, i)
+			for j := i; j < len(insts) && isIntOp(op(j)) && insts[j].Depth > base; j++ {
+				if insts[j].Depth == base+1 {
+					last = j
+				}
+			}
+			if last >= 0 && last+1 < len(insts) && (op(last+1) == vm.Itof || op(last+1) == vm.Itou) {
+				last++
+			}
+		case op(i) == vm.Snew:
+			last = i
+			for j := i + 1; j < len(insts) && (isIntOp(op(j)) || op(j) == vm.Sadd); j++ {
+				if op(j) == vm.Sadd {
+					last = j
+				}
+			}
+		}
+		if last < 0 {
+			i++
+			continue
+		}
+		insts[last].Annotation = describe(insts[last].top)
+		i = last + 1
+	}
+}
+
+// depthBefore returns the depth of the stack just before insts[i] is executed.
+func depthBefore(insts []*Instruction, i int) int {
+	if i == 0 {
+		return 0
+	}
+	return insts[i-1].Depth
+}
+
+func isIntOp(op vm.Op) bool {
+	switch op {
+	case vm.Inew, vm.Iinc, vm.Ishl, vm.Iadd, vm.Ineg, vm.Isht:
+		return true
+	default:
+		return false
+	}
+}
+
+// describe returns an annotation for v. It returns an empty string if v is not a number or a string.
+func describe(v *types.Value) string {
+	if v == nil {
+		return ""
+	}
+	switch v.Kind {
+	case types.Int:
+		return "int " + strconv.FormatInt(v.Int, 10)
+	case types.Uint:
+		return "uint " + strconv.FormatUint(v.Uint, 10)
+	case types.Float:
+		return "float " + strconv.FormatFloat(v.Float, 'g', -1, 64)
+	case types.String:
+		return "string " + strconv.Quote(string(v.String))
+	default:
+		return ""
+	}
+}
+
+func modeName(m lexer.Mode) string {
+	switch m {
+	case lexer.A:
+		return "A"
+	case lexer.S:
+		return "S"
+	default:
+		panic(fmt.Errorf("unknown mode: %d", m))
+	}
+}
@@ -0,0 +1,107 @@
+package disasm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestAnalyzeAnnotatesInts(t *testing.T) {
+	insts := analyze(t, "BBubazBubi")
+	want := []string{"", "", "", "", "int 2", "", "", "", "", "float 1e-323"}
+	if diff := cmp.Diff(want, annotations(insts)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeAnnotatesStrings(t *testing.T) {
+	// "a" followed by an Int in S mode
+	insts := analyze(t, "?SShkShaaaaakShaaaaaak-Sh")
+	got := annotations(insts)
+	if got[22] != `string "a"` {
+		t.Errorf("expected the last Sadd to be annotated, but got %#v", got)
+	}
+	if got[24] != "int 1" {
+		t.Errorf("expected the int after the string to be annotated, but got %#v", got)
+	}
+	for i, a := range got {
+		if i != 22 && i != 24 && a != "" {
+			t.Errorf("unexpected annotation at %d: %s", i, a)
+		}
+	}
+}
+
+func TestAnalyzeAnnotatesConsecutiveIntsSeparately(t *testing.T) {
+	insts := analyze(t, "BuBBuba")
+	want := []string{"", "int 1", "", "", "", "", "int 2"}
+	if diff := cmp.Diff(want, annotations(insts)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeReportsDepth(t *testing.T) {
+	insts := analyze(t, "BBua")
+	want := []int{1, 2, 2, 1}
+	got := make([]int, 0, len(insts))
+	for _, inst := range insts {
+		got = append(got, inst.Depth)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzeStoresErrorAndContinuesListing(t *testing.T) {
+	insts := analyze(t, "BoBu")
+	if len(insts) != 4 {
+		t.Fatalf("expected 4 instructions but got %d", len(insts))
+	}
+	if !errors.Is(insts[1].Err, vm.ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch but got %v", insts[1].Err)
+	}
+	for _, inst := range insts[2:] {
+		if inst.Depth != -1 || inst.Err != nil || inst.Annotation != "" {
+			t.Errorf("expected an instruction that is not executed but got %#v", inst)
+		}
+	}
+}
+
+func TestDisassembleWritesListing(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDisassembler(&buf, WithDepth())
+	err := d.Disassemble(lexer.NewLexer(strings.NewReader("Bu\nBo")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "" +
+		"1:1        A  Inew      1\n" +
+		"1:2        A  Iinc      1  ; int 1\n" +
+		"2:1        A  Inew      2  ; int 0\n" +
+		"2:2        A  Bneg      -  ; error: Bneg: type mismatch (expected Bool, got Int); stack depth: 2, top: [Int, Int]\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func analyze(t *testing.T, src string) []*Instruction {
+	t.Helper()
+	insts, err := NewDisassembler(&bytes.Buffer{}).Analyze(lexer.NewLexer(strings.NewReader(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return insts
+}
+
+func annotations(insts []*Instruction) []string {
+	as := make([]string, 0, len(insts))
+	for _, inst := range insts {
+		as = append(as, inst.Annotation)
+	}
+	return as
+}
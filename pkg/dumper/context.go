@@ -0,0 +1,52 @@
+package dumper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// ContextError is an error that occurs when a Dumper stops writing because its context is done.
+type ContextError struct {
+	Written int64 // the number of `vm.Op`s written by the Dumper before it stopped
+	Err     error // the error returned by `ctx.Err()`
+}
+
+func (e *ContextError) Error() string {
+	return fmt.Sprintf("%s after writing %d instructions", e.Err.Error(), e.Written)
+}
+
+func (e *ContextError) Unwrap() error {
+	return e.Err
+}
+
+// WithContext makes a Dumper check ctx before writing each `vm.Op`.
+// Once ctx is done, Dump returns a *ContextError that wraps `ctx.Err()`.
+func WithContext(ctx context.Context) DumperOption {
+	return dumperOption(func(d *Dumper) {
+		d.ctx = ctx
+	})
+}
+
+// contextWriter is a `lexer.OpWriter` that stops writing once its context is done.
+type contextWriter struct {
+	lexer.OpWriter
+	ctx     context.Context
+	written int64
+}
+
+func (w *contextWriter) Write(op vm.Op) error {
+	select {
+	case <-w.ctx.Done():
+		return &ContextError{Written: w.written, Err: w.ctx.Err()}
+	default:
+	}
+	err := w.OpWriter.Write(op)
+	if err != nil {
+		return err
+	}
+	w.written++
+	return nil
+}
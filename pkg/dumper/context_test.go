@@ -0,0 +1,67 @@
+package dumper
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// cancelingWriter cancels its context after n ops are written.
+type cancelingWriter struct {
+	*lexer.SliceWriter
+	n      int
+	cancel context.CancelFunc
+}
+
+func (w *cancelingWriter) Write(op vm.Op) error {
+	err := w.SliceWriter.Write(op)
+	w.n--
+	if w.n == 0 {
+		w.cancel()
+	}
+	return err
+}
+
+func TestDumpWithContextStopsWhenContextIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &cancelingWriter{SliceWriter: lexer.NewSliceWriter(), n: 5, cancel: cancel}
+	d := NewDumper(w, WithContext(ctx))
+	err := d.Dump(types.NewStringValue([]byte("hello")))
+	var ctxErr *ContextError
+	if !errors.As(err, &ctxErr) {
+		t.Fatalf("expected *ContextError but got %#v", err)
+	}
+	if ctxErr.Written != 5 {
+		t.Errorf("expected %d instructions to be written but got %d", 5, ctxErr.Written)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	if len(w.Ops()) != 5 {
+		t.Errorf("expected %d instructions to be written but got %d", 5, len(w.Ops()))
+	}
+}
+
+func TestDumpWithContextWritesTheSameOpsAsDumpWithoutContext(t *testing.T) {
+	v := types.NewStringValue([]byte("hello"))
+	want := lexer.NewSliceWriter()
+	err := NewDumper(want).Dump(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := lexer.NewSliceWriter()
+	err = NewDumper(got, WithContext(context.Background())).Dump(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want.Ops(), got.Ops()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,8 +2,10 @@
 package dumper
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"sort"
 
 	"github.com/genkami/watson/pkg/lexer"
 	"github.com/genkami/watson/pkg/types"
@@ -12,16 +14,63 @@ import (
 
 // Dumper dumps `types.Value` as a sequence of `types.Op`s.
 type Dumper struct {
-	w lexer.OpWriter
+	w            lexer.OpWriter
+	canonical    bool
+	normalized   bool
+	optimization Optimization
+	optimizer    *sizeOptimizer
+	ctx          context.Context
+}
+
+// DumperOption configures a Dumper.
+type DumperOption interface {
+	apply(*Dumper)
+}
+
+type dumperOption func(*Dumper)
+
+func (opt dumperOption) apply(d *Dumper) {
+	opt(d)
+}
+
+// WithCanonical makes a Dumper emit the canonical encoding of values, so that equal values are always dumped as the same sequence of `vm.Op`s.
+//
+// See "Canonical Encoding" in the specification for details.
+func WithCanonical() DumperOption {
+	return dumperOption(func(d *Dumper) {
+		d.canonical = true
+		d.normalized = true
+	})
+}
+
+// WithNormalized makes a Dumper emit the same sequence of `vm.Op`s as WithCanonical, except that keys of Objects are dumped in the order of `types.Value.OrderedKeys` instead of being sorted.
+// This is useful to rewrite values in a consistent style without reordering what a user wrote.
+func WithNormalized() DumperOption {
+	return dumperOption(func(d *Dumper) {
+		d.normalized = true
+	})
 }
 
 // NewDumper creates a new Dumper.
-func NewDumper(w lexer.OpWriter) *Dumper {
-	return &Dumper{w: w}
+func NewDumper(w lexer.OpWriter, opts ...DumperOption) *Dumper {
+	d := &Dumper{w: w}
+	for _, opt := range opts {
+		opt.apply(d)
+	}
+	if d.optimization == OptimizeSize && !d.normalized {
+		d.optimizer = newSizeOptimizer()
+	}
+	if d.ctx != nil {
+		d.w = &contextWriter{OpWriter: d.w, ctx: d.ctx}
+	}
+	return d
 }
 
 // Dump converts v into a sequence of `types.Op`s and writes it to the underlying writer `lexer.OpWriter`.
 func (d *Dumper) Dump(v *types.Value) error {
+	if d.optimizer != nil {
+		return d.writeAll(d.optimizer.dump(v))
+	}
 	switch v.Kind {
 	case types.Int:
 		return d.dumpInt(uint64(v.Int))
@@ -32,7 +81,7 @@ func (d *Dumper) Dump(v *types.Value) error {
 	case types.String:
 		return d.dumpString(v.String)
 	case types.Object:
-		return d.dumpObject(v.Object)
+		return d.dumpObject(v)
 	case types.Array:
 		return d.dumpArray(v.Array)
 	case types.Bool:
@@ -44,6 +93,16 @@ func (d *Dumper) Dump(v *types.Value) error {
 	}
 }
 
+func (d *Dumper) writeAll(ops []vm.Op) error {
+	for _, op := range ops {
+		err := d.w.Write(op)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *Dumper) dumpInt(n uint64) error {
 	var err error
 	err = d.w.Write(vm.Inew)
@@ -102,10 +161,7 @@ func (d *Dumper) dumpFloat(x float64) error {
 		if err != nil {
 			return err
 		}
-		err = d.w.Write(vm.Fneg)
-		if err != nil {
-			return err
-		}
+		return d.w.Write(vm.Fneg)
 	}
 	err = d.dumpInt(math.Float64bits(x))
 	if err != nil {
@@ -137,18 +193,18 @@ func (d *Dumper) dumpString(s []byte) error {
 	return nil
 }
 
-func (d *Dumper) dumpObject(obj map[string]*types.Value) error {
+func (d *Dumper) dumpObject(obj *types.Value) error {
 	var err error
 	err = d.w.Write(vm.Onew)
 	if err != nil {
 		return err
 	}
-	for k, v := range obj {
+	for _, k := range d.keys(obj) {
 		err = d.dumpString([]byte(k))
 		if err != nil {
 			return err
 		}
-		err = d.Dump(v)
+		err = d.Dump(obj.Object[k])
 		if err != nil {
 			return err
 		}
@@ -160,6 +216,15 @@ func (d *Dumper) dumpObject(obj map[string]*types.Value) error {
 	return nil
 }
 
+// keys returns the keys of obj in the order they should be dumped.
+func (d *Dumper) keys(obj *types.Value) []string {
+	keys := obj.OrderedKeys()
+	if d.canonical {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
 func (d *Dumper) dumpArray(arr []*types.Value) error {
 	var err error
 	err = d.w.Write(vm.Anew)
@@ -9,6 +9,7 @@ import (
 
 	"github.com/genkami/watson/pkg/lexer"
 	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
 	"github.com/genkami/watson/pkg/vm"
 )
 
@@ -19,7 +20,7 @@ func TestDumpInt(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -38,7 +39,7 @@ func TestDumpUint(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -64,7 +65,7 @@ func TestDumpFloat(t *testing.T) {
 			}
 			return
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -87,7 +88,7 @@ func TestDumpString(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -103,7 +104,7 @@ func TestDumpObject(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -119,6 +120,21 @@ func TestDumpObject(t *testing.T) {
 	})
 }
 
+func TestDumpObjectPreservesTheOrderOfKeys(t *testing.T) {
+	orig := types.NewObjectValue(map[string]*types.Value{})
+	orig.Set("zebra", types.NewIntValue(1))
+	orig.Set("ant", types.NewIntValue(2))
+	orig.Set("monkey", types.NewIntValue(3))
+	converted, err := encodeThenExecute(orig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zebra", "ant", "monkey"}
+	if diff := cmp.Diff(want, converted.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestDumpArray(t *testing.T) {
 	test := func(arr []*types.Value) {
 		orig := types.NewArrayValue(arr)
@@ -126,7 +142,7 @@ func TestDumpArray(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -142,7 +158,7 @@ func TestDumpBool(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(orig, converted); diff != "" {
+		if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 	}
@@ -156,11 +172,122 @@ func TestDumpNil(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(orig, converted); diff != "" {
+	if diff := cmp.Diff(orig, converted, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDumpFloatNegativeInfinityPushesOnlyOneValue(t *testing.T) {
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w)
+	err := d.Dump(types.NewFloatValue(math.Inf(-1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vm.Op{vm.Finf, vm.Fneg}
+	got := w.Ops()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCanonicalDumpInt(t *testing.T) {
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithCanonical())
+	err := d.Dump(types.NewIntValue(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vm.Op{
+		vm.Inew,
+		vm.Inew, vm.Iinc, vm.Iadd,
+		vm.Inew, vm.Iinc, vm.Ishl, vm.Ishl, vm.Iadd,
+	}
+	got := w.Ops()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCanonicalDumpObjectSortsKeys(t *testing.T) {
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithCanonical())
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("b", types.NewNilValue())
+	obj.Set("a", types.NewBoolValue(false))
+	err := d.Dump(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vm.Op{vm.Onew}
+	want = append(want, dumpCanonical(t, types.NewStringValue([]byte("a")))...)
+	want = append(want, vm.Bnew, vm.Oadd)
+	want = append(want, dumpCanonical(t, types.NewStringValue([]byte("b")))...)
+	want = append(want, vm.Nnew, vm.Oadd)
+	got := w.Ops()
+	if diff := cmp.Diff(want, got); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
 
+func TestCanonicalDumpIsDeterministic(t *testing.T) {
+	obj := map[string]*types.Value{}
+	for i := 0; i < 20; i++ {
+		obj[fmt.Sprintf("key%d", i)] = types.NewObjectValue(map[string]*types.Value{
+			"x": types.NewIntValue(int64(i)),
+			"y": types.NewBoolValue(i%2 == 0),
+			"z": types.NewStringValue([]byte("shrimp")),
+		})
+	}
+	v := types.NewObjectValue(obj)
+	want := dumpCanonical(t, v)
+	for i := 0; i < 10; i++ {
+		got := dumpCanonical(t, v)
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestCanonicalDumpDoesNotDistinguishNaNs(t *testing.T) {
+	want := dumpCanonical(t, types.NewFloatValue(math.NaN()))
+	got := dumpCanonical(t, types.NewFloatValue(math.Float64frombits(0x7ff8000000000123)))
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNormalizedDumpPreservesTheOrderOfKeys(t *testing.T) {
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithNormalized(), WithOptimization(OptimizeSize))
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("b", types.NewNilValue())
+	obj.Set("a", types.NewBoolValue(false))
+	err := d.Dump(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vm.Op{vm.Onew}
+	want = append(want, dumpCanonical(t, types.NewStringValue([]byte("b")))...)
+	want = append(want, vm.Nnew, vm.Oadd)
+	want = append(want, dumpCanonical(t, types.NewStringValue([]byte("a")))...)
+	want = append(want, vm.Bnew, vm.Oadd)
+	got := w.Ops()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func dumpCanonical(t *testing.T, val *types.Value) []vm.Op {
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithCanonical())
+	err := d.Dump(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Ops()
+}
+
 func encodeThenExecute(val *types.Value) (*types.Value, error) {
 	w := lexer.NewSliceWriter()
 	d := NewDumper(w)
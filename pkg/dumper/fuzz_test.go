@@ -0,0 +1,17 @@
+//go:build go1.18
+// +build go1.18
+
+package dumper
+
+import (
+	"testing"
+)
+
+func FuzzRoundTripThroughLexerAndVM(f *testing.F) {
+	for seed := int64(0); seed < 10; seed++ {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, seed int64) {
+		testRoundTrip(t, seed)
+	})
+}
@@ -0,0 +1,373 @@
+package dumper
+
+import (
+	"bytes"
+	"math"
+	"math/bits"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Optimization specifies what a Dumper optimizes its output for.
+type Optimization int
+
+const (
+	// OptimizeNone makes a Dumper emit a straightforward sequence of `vm.Op`s.
+	OptimizeNone Optimization = iota
+
+	// OptimizeSize makes a Dumper search for a sequence of `vm.Op`s that is as short as possible.
+	OptimizeSize
+)
+
+// WithOptimization makes a Dumper optimize its output for o.
+//
+// It has no effect if WithCanonical or WithNormalized is also given, because they determine a unique sequence for each value.
+func WithOptimization(o Optimization) DumperOption {
+	return dumperOption(func(d *Dumper) {
+		d.optimization = o
+	})
+}
+
+// maxReversedElems is the maximum number of elements that an array can push onto the stack at once.
+// It keeps the output of a size-optimizing Dumper from overflowing the stack of the VM.
+const maxReversedElems = 32
+
+// maxMemoizedInts is the number of integers that a sizeOptimizer memoizes before it forgets all of them.
+// It keeps a Dumper that dumps many values (e.g. a long multi-document stream) from growing without bound.
+const maxMemoizedInts = 4096
+
+// sizeOptimizer converts values into short sequences of `vm.Op`s.
+type sizeOptimizer struct {
+	// ints memoizes the shortest sequence found for each integer.
+	// A nil entry means that the integer is being searched.
+	ints map[uint64][]vm.Op
+}
+
+func newSizeOptimizer() *sizeOptimizer {
+	return &sizeOptimizer{ints: map[uint64][]vm.Op{}}
+}
+
+// dump returns the sequence that pushes v. Unlike value, it is called once for each value that a Dumper dumps.
+func (o *sizeOptimizer) dump(v *types.Value) []vm.Op {
+	// The memo is cleared only here, since clearing it while integers are being searched could make the search loop forever.
+	if len(o.ints) > maxMemoizedInts {
+		o.ints = map[uint64][]vm.Op{}
+	}
+	return o.value(v)
+}
+
+func (o *sizeOptimizer) value(v *types.Value) []vm.Op {
+	switch v.Kind {
+	case types.Int:
+		return o.int(uint64(v.Int))
+	case types.Uint:
+		return concat(o.int(v.Uint), []vm.Op{vm.Itou})
+	case types.Float:
+		return o.float(v.Float)
+	case types.String:
+		return o.string(v.String)
+	case types.Object:
+		return o.object(v)
+	case types.Array:
+		return o.array(v.Array)
+	case types.Bool:
+		if v.Bool {
+			return []vm.Op{vm.Bnew, vm.Bneg}
+		}
+		return []vm.Op{vm.Bnew}
+	default:
+		return []vm.Op{vm.Nnew}
+	}
+}
+
+// int returns the shortest sequence found that pushes n as an Int.
+// It returns nil if n is being searched, so that callers can avoid infinite recursion.
+func (o *sizeOptimizer) int(n uint64) []vm.Op {
+	if ops, ok := o.ints[n]; ok {
+		return ops
+	}
+	o.ints[n] = nil
+	best := o.positive(n)
+	if -n != n {
+		best = shorter(best, concat(o.positive(-n), []vm.Op{vm.Ineg}))
+	}
+	o.ints[n] = best
+	return best
+}
+
+// positive returns the shortest sequence found that pushes n without negating it at the end.
+func (o *sizeOptimizer) positive(n uint64) []vm.Op {
+	return shorter(o.signedDigits(n), o.repeated(n))
+}
+
+// signedDigits builds n from its most significant bit like the ordinary binary representation,
+// except that each digit can also be -1, which is made by `Ineg Iinc Ineg`.
+// Consecutive `Ishl`s are replaced with `Isht` when it is shorter.
+func (o *sizeOptimizer) signedDigits(n uint64) []vm.Op {
+	if n == 0 {
+		return []vm.Op{vm.Inew}
+	}
+	size := bits.Len64(n)
+	bit := func(i int) int {
+		return int(n>>uint(size-1-i)) & 1
+	}
+
+	// step is a transition that shifts the top of the stack by `shifts` bits and then applies `extra`.
+	type step struct {
+		from, fromState int
+		shifts          int
+		extra           []vm.Op
+	}
+	var (
+		inc  = []vm.Op{vm.Iinc}
+		inc2 = []vm.Op{vm.Iinc, vm.Iinc}
+		dec  = []vm.Op{vm.Ineg, vm.Iinc, vm.Ineg}
+		dec2 = []vm.Op{vm.Ineg, vm.Iinc, vm.Ineg, vm.Ineg, vm.Iinc, vm.Ineg}
+	)
+
+	// cost[i][s] is the length of the shortest sequence that consumes the first i bits of n, leaving `prefix + s` on the stack.
+	// A negative cost means that the state is unreachable.
+	cost := make([][2]int, size+1)
+	prev := make([][2]step, size+1)
+	for i := range cost {
+		cost[i] = [2]int{-1, -1}
+	}
+	relax := func(i, s int, c int, st step) {
+		if cost[i][s] < 0 || c < cost[i][s] {
+			cost[i][s] = c
+			prev[i][s] = st
+		}
+	}
+	// the initial states push 0, 1, and 2 respectively
+	relax(0, 0, 1, step{from: -1, extra: []vm.Op{vm.Inew}})
+	relax(1, 0, 2, step{from: -1, extra: []vm.Op{vm.Inew, vm.Iinc}})
+	relax(1, 1, 3, step{from: -1, extra: []vm.Op{vm.Inew, vm.Iinc, vm.Iinc}})
+	for i := 0; i < size; i++ {
+		for s := 0; s < 2; s++ {
+			if cost[i][s] < 0 {
+				continue
+			}
+			// bits equal to s can be consumed by shifting only.
+			run := 0
+			for i+run < size && bit(i+run) == s {
+				run++
+			}
+			for j := 0; j <= run && i+j < size; j++ {
+				base := cost[i][s] + len(shifts[j+1])
+				move := func(next int, extra []vm.Op) {
+					relax(i+j+1, next, base+len(extra), step{from: i, fromState: s, shifts: j + 1, extra: extra})
+				}
+				switch {
+				case s == 0 && bit(i+j) == 0:
+					move(1, inc)
+				case s == 0 && bit(i+j) == 1:
+					move(0, inc)
+					move(1, inc2)
+				case s == 1 && bit(i+j) == 0:
+					move(1, dec)
+					move(0, dec2)
+				case s == 1 && bit(i+j) == 1:
+					move(0, dec)
+				}
+			}
+			if i+run == size && run > 0 {
+				relax(size, s, cost[i][s]+len(shifts[run]), step{from: i, fromState: s, shifts: run})
+			}
+		}
+	}
+
+	final := 0
+	var tail []vm.Op
+	if cost[size][1] >= 0 && (cost[size][0] < 0 || cost[size][1]+len(dec) < cost[size][0]) {
+		final = 1
+		tail = dec
+	}
+	steps := make([]step, 0, size)
+	for i, s := size, final; i >= 0; {
+		st := prev[i][s]
+		steps = append(steps, st)
+		i, s = st.from, st.fromState
+	}
+	ops := make([]vm.Op, 0, cost[size][final]+len(tail))
+	for k := len(steps) - 1; k >= 0; k-- {
+		if steps[k].shifts > 0 {
+			ops = append(ops, shifts[steps[k].shifts]...)
+		}
+		ops = append(ops, steps[k].extra...)
+	}
+	return append(ops, tail...)
+}
+
+// repeated builds n as `p + (p << k)` by duplicating p when n consists of the same bit pattern p repeated twice.
+func (o *sizeOptimizer) repeated(n uint64) []vm.Op {
+	var best []vm.Op
+	for k := 1; k < 64; k++ {
+		p := n & (1<<uint(k) - 1)
+		if p == 0 || bits.Len64(p)+k > 64 || p+p<<uint(k) != n {
+			continue
+		}
+		ops := o.int(p)
+		if ops == nil {
+			continue
+		}
+		best = shorter(best, concat(ops, []vm.Op{vm.Gdup}, binary(uint64(k)), []vm.Op{vm.Isht, vm.Iadd}))
+	}
+	return best
+}
+
+// shifts[n] is the shortest sequence that shifts the top of the stack by n bits.
+var shifts [65][]vm.Op
+
+func init() {
+	for n := range shifts {
+		sht := concat(binary(uint64(n)), []vm.Op{vm.Isht})
+		if len(sht) < n {
+			shifts[n] = sht
+			continue
+		}
+		shifts[n] = make([]vm.Op, n)
+		for i := range shifts[n] {
+			shifts[n][i] = vm.Ishl
+		}
+	}
+}
+
+// char returns the shortest sequence found that pushes an Int which is equal to c when it is truncated to a byte.
+func (o *sizeOptimizer) char(c byte) []vm.Op {
+	return shorter(o.int(uint64(c)), o.int(uint64(int64(c)-256)))
+}
+
+func (o *sizeOptimizer) float(x float64) []vm.Op {
+	if math.IsNaN(x) {
+		return []vm.Op{vm.Fnan}
+	} else if math.IsInf(x, 1) {
+		return []vm.Op{vm.Finf}
+	} else if math.IsInf(x, -1) {
+		return []vm.Op{vm.Finf, vm.Fneg}
+	}
+	n := math.Float64bits(x)
+	best := concat(o.int(n), []vm.Op{vm.Itof})
+	if math.Signbit(x) {
+		best = shorter(best, concat(o.int(n&^(1<<63)), []vm.Op{vm.Itof, vm.Fneg}))
+	}
+	return best
+}
+
+func (o *sizeOptimizer) string(s []byte) []vm.Op {
+	ops := []vm.Op{vm.Snew}
+	for _, c := range s {
+		ops = append(ops, o.char(c)...)
+		ops = append(ops, vm.Sadd)
+	}
+	return ops
+}
+
+func (o *sizeOptimizer) object(obj *types.Value) []vm.Op {
+	ops := []vm.Op{vm.Onew}
+	for _, k := range obj.OrderedKeys() {
+		v := obj.Object[k]
+		ops = append(ops, o.string([]byte(k))...)
+		if v.Kind == types.String && bytes.Equal(v.String, []byte(k)) {
+			ops = append(ops, vm.Gdup)
+		} else {
+			ops = append(ops, o.value(v)...)
+		}
+		ops = append(ops, vm.Oadd)
+	}
+	return ops
+}
+
+// array builds arr by appending its elements one by one.
+// If arr has consecutive elements that are equal to each other near its head,
+// it instead pushes the first few elements in reverse order, duplicating the same elements with `Gdup`,
+// and then appends them to the array with `Gswp Aadd`.
+func (o *sizeOptimizer) array(arr []*types.Value) []vm.Op {
+	elems := make([][]vm.Op, 0, len(arr))
+	for _, v := range arr {
+		elems = append(elems, o.value(v))
+	}
+
+	// Each reversed element costs an extra Gswp, and each duplicated element saves all but one of its ops.
+	reversed := 0
+	bestGain, gain := 0, 0
+	for i := 0; i < len(elems) && i < maxReversedElems; i++ {
+		gain--
+		if i > 0 && equalOps(elems[i], elems[i-1]) {
+			gain += len(elems[i]) - 1
+		}
+		if gain > bestGain {
+			bestGain = gain
+			reversed = i + 1
+		}
+	}
+
+	ops := make([]vm.Op, 0)
+	for i := reversed - 1; i >= 0; i-- {
+		if i < reversed-1 && equalOps(elems[i], elems[i+1]) {
+			ops = append(ops, vm.Gdup)
+		} else {
+			ops = append(ops, elems[i]...)
+		}
+	}
+	ops = append(ops, vm.Anew)
+	for i := 0; i < reversed; i++ {
+		ops = append(ops, vm.Gswp, vm.Aadd)
+	}
+	for _, elem := range elems[reversed:] {
+		ops = append(ops, elem...)
+		ops = append(ops, vm.Aadd)
+	}
+	return ops
+}
+
+// binary returns the ordinary binary representation of n.
+func binary(n uint64) []vm.Op {
+	ops := []vm.Op{vm.Inew}
+	for i := bits.Len64(n) - 1; i >= 0; i-- {
+		if len(ops) > 1 {
+			ops = append(ops, vm.Ishl)
+		}
+		if n>>uint(i)&1 == 1 {
+			ops = append(ops, vm.Iinc)
+		}
+	}
+	return ops
+}
+
+// shorter returns the shorter one of a and b. Nil is regarded as infinitely long.
+func shorter(a, b []vm.Op) []vm.Op {
+	if a == nil || (b != nil && len(b) < len(a)) {
+		return b
+	}
+	return a
+}
+
+// concat concatenates sequences into a newly allocated one.
+// It returns nil if any of them is nil.
+func concat(seqs ...[]vm.Op) []vm.Op {
+	size := 0
+	for _, seq := range seqs {
+		if seq == nil {
+			return nil
+		}
+		size += len(seq)
+	}
+	ops := make([]vm.Op, 0, size)
+	for _, seq := range seqs {
+		ops = append(ops, seq...)
+	}
+	return ops
+}
+
+func equalOps(a, b []vm.Op) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,236 @@
+package dumper
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestOptimizedDumpInt(t *testing.T) {
+	for _, n := range []int64{
+		0, 1, -1, 2, -2, 3, 7, 8, 255, 256, -256, 0x5555, 0xdeadbeef, -0xdeadbeef,
+		1 << 31, 1 << 32, 1<<32 - 1, 1<<62 + 1, 0x0101010101010101, 0x7f7f7f7f7f7f7f7f,
+		math.MaxInt64, math.MinInt64, math.MaxInt64 - 1, math.MinInt64 + 1,
+	} {
+		testOptimizedDump(t, types.NewIntValue(n))
+	}
+}
+
+func TestOptimizedDumpRandomInts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		testOptimizedDump(t, types.NewIntValue(int64(r.Uint64())))
+		testOptimizedDump(t, types.NewIntValue(r.Int63n(1<<16)-1<<15))
+	}
+}
+
+func TestOptimizedDumpUint(t *testing.T) {
+	for _, n := range []uint64{0, 1, 2, 255, 1 << 63, 1<<64 - 1, 0xfffffffffffffffe, 0x8000000000000001} {
+		testOptimizedDump(t, types.NewUintValue(n))
+	}
+}
+
+func TestOptimizedDumpFloat(t *testing.T) {
+	for _, x := range []float64{
+		0, 1, -1, 1.5, -2.25, 0.1, math.Pi, -math.E, 1e100, -1e-100,
+		math.MaxFloat64, -math.MaxFloat64, math.SmallestNonzeroFloat64,
+		math.Inf(1), math.Inf(-1), math.NaN(),
+	} {
+		testOptimizedDump(t, types.NewFloatValue(x))
+	}
+}
+
+func TestOptimizedDumpRandomFloats(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		x := math.Float64frombits(r.Uint64())
+		testOptimizedDump(t, types.NewFloatValue(x))
+	}
+}
+
+func TestOptimizedDumpNegativeZero(t *testing.T) {
+	x := math.Copysign(0, -1)
+	got := executeOps(t, dumpOptimized(t, types.NewFloatValue(x)))
+	if got.Kind != types.Float || math.Float64bits(got.Float) != math.Float64bits(x) {
+		t.Errorf("expected %#v but got %#v", x, got.Float)
+	}
+}
+
+func TestOptimizedDumpString(t *testing.T) {
+	all := make([]byte, 0, 256)
+	for c := 0; c < 256; c++ {
+		all = append(all, byte(c))
+	}
+	testOptimizedDump(t, types.NewStringValue([]byte{}))
+	testOptimizedDump(t, types.NewStringValue([]byte("hello, world")))
+	testOptimizedDump(t, types.NewStringValue(all))
+}
+
+func TestOptimizedDumpCharUsesNegativeNumbers(t *testing.T) {
+	got := dumpOptimized(t, types.NewStringValue([]byte{0xff}))
+	want := []vm.Op{vm.Snew, vm.Inew, vm.Iinc, vm.Ineg, vm.Sadd}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOptimizedDumpBoolAndNil(t *testing.T) {
+	testOptimizedDump(t, types.NewBoolValue(true))
+	testOptimizedDump(t, types.NewBoolValue(false))
+	testOptimizedDump(t, types.NewNilValue())
+}
+
+func TestOptimizedDumpObject(t *testing.T) {
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("name", types.NewStringValue([]byte("name")))
+	obj.Set("replicas", types.NewIntValue(3))
+	obj.Set("labels", types.NewObjectValue(map[string]*types.Value{
+		"app": types.NewStringValue([]byte("nginx")),
+	}))
+	obj.Set("empty", types.NewObjectValue(map[string]*types.Value{}))
+	ops := testOptimizedDump(t, obj)
+	if !containsOp(ops, vm.Gdup) {
+		t.Errorf("expected a value that is equal to its key to be duplicated, but got %#v", ops)
+	}
+}
+
+func TestOptimizedDumpArray(t *testing.T) {
+	long := types.NewStringValue([]byte("a long string that is repeated"))
+	testOptimizedDump(t, types.NewArrayValue([]*types.Value{}))
+	testOptimizedDump(t, types.NewArrayValue([]*types.Value{
+		types.NewIntValue(1), types.NewIntValue(2), types.NewIntValue(3),
+	}))
+	ops := testOptimizedDump(t, types.NewArrayValue([]*types.Value{
+		long, long, long, types.NewIntValue(1), long,
+	}))
+	if !containsOp(ops, vm.Gdup) {
+		t.Errorf("expected repeated elements to be duplicated, but got %#v", ops)
+	}
+}
+
+func TestOptimizedDumpArrayDoesNotOverflowStack(t *testing.T) {
+	elem := types.NewStringValue([]byte("shrimp"))
+	arr := make([]*types.Value, 0, 1100) // more than the default stack size
+	for i := 0; i < 1100; i++ {
+		arr = append(arr, elem)
+	}
+	testOptimizedDump(t, types.NewArrayValue(arr))
+}
+
+func TestOptimizedDumpNested(t *testing.T) {
+	inner := types.NewObjectValue(map[string]*types.Value{
+		"x": types.NewFloatValue(-0.5),
+		"y": types.NewUintValue(42),
+	})
+	testOptimizedDump(t, types.NewArrayValue([]*types.Value{
+		inner, inner,
+		types.NewArrayValue([]*types.Value{inner, types.NewNilValue()}),
+		types.NewArrayValue([]*types.Value{inner, types.NewNilValue()}),
+	}))
+}
+
+func TestOptimizedDumpDoesNotMemoizeTooManyInts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithOptimization(OptimizeSize))
+	for i := 0; i < 3*maxMemoizedInts; i++ {
+		err := d.Dump(types.NewIntValue(int64(r.Uint64())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Each Int adds a few entries, e.g. the ones for its negation and its halves.
+		if n := len(d.optimizer.ints); n > 2*maxMemoizedInts {
+			t.Fatalf("expected at most %d memoized ints but got %d", 2*maxMemoizedInts, n)
+		}
+	}
+}
+
+func TestCanonicalDumpIgnoresOptimization(t *testing.T) {
+	val := types.NewObjectValue(map[string]*types.Value{
+		"a": types.NewStringValue([]byte("a")),
+		"b": types.NewIntValue(-1),
+	})
+	want := dumpCanonical(t, val)
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithOptimization(OptimizeSize), WithCanonical())
+	err := d.Dump(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, w.Ops()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// testOptimizedDump checks that the optimized output of val decodes to val and that it is not longer than the ordinary output.
+func testOptimizedDump(t *testing.T, val *types.Value) []vm.Op {
+	t.Helper()
+	ops := dumpOptimized(t, val)
+	got := executeOps(t, ops)
+	if diff := cmp.Diff(val, got, cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	w := lexer.NewSliceWriter()
+	err := NewDumper(w).Dump(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) > len(w.Ops()) {
+		t.Errorf("optimized output is longer than the ordinary one: %d > %d", len(ops), len(w.Ops()))
+	}
+	return ops
+}
+
+func dumpOptimized(t *testing.T, val *types.Value) []vm.Op {
+	t.Helper()
+	w := lexer.NewSliceWriter()
+	d := NewDumper(w, WithOptimization(OptimizeSize))
+	err := d.Dump(val)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w.Ops()
+}
+
+// executeOps executes ops and returns the value that is left on the stack.
+// It fails if ops leaves more than one value.
+func executeOps(t *testing.T, ops []vm.Op) *types.Value {
+	t.Helper()
+	v := vm.NewVM()
+	for _, op := range ops {
+		err := v.Feed(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	top, err := v.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = v.Feed(vm.Gpop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Top(); err == nil {
+		t.Fatalf("more than one value is left on the stack")
+	}
+	return top
+}
+
+func containsOp(ops []vm.Op, op vm.Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
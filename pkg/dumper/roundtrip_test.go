@@ -0,0 +1,75 @@
+package dumper
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestRoundTripThroughLexerAndVM(t *testing.T) {
+	for seed := int64(0); seed < 300; seed++ {
+		testRoundTrip(t, seed)
+	}
+}
+
+// testRoundTrip asserts that every value is restored by dumping it, unlexing the Ops, lexing them again and executing them.
+func testRoundTrip(t *testing.T, seed int64) {
+	t.Helper()
+	want := typestest.NewGenerator(seed).Value()
+	for _, tc := range []struct {
+		name    string
+		opts    []DumperOption
+		cmpOpts []cmp.Option
+	}{
+		{"default", nil, nil},
+		// The canonical encoding sorts keys of Objects, so the order in which they were added is lost.
+		{"canonical", []DumperOption{WithCanonical()}, []cmp.Option{cmpopts.IgnoreUnexported(types.Value{})}},
+		{"optimized", []DumperOption{WithOptimization(OptimizeSize)}, nil},
+	} {
+		for _, mode := range []lexer.Mode{lexer.A, lexer.S} {
+			got, err := roundTrip(want, mode, tc.opts...)
+			if err != nil {
+				t.Fatalf("seed %d, %s, mode %d: %v", seed, tc.name, mode, err)
+			}
+			if diff := cmp.Diff(want, got, append(tc.cmpOpts, cmpopts.EquateNaNs(), typestest.CmpOption)...); diff != "" {
+				t.Errorf("seed %d, %s, mode %d: mismatch (-want +got):\n%s", seed, tc.name, mode, diff)
+			}
+		}
+	}
+}
+
+func roundTrip(val *types.Value, mode lexer.Mode, opts ...DumperOption) (*types.Value, error) {
+	buf := bytes.NewBuffer(nil)
+	u := lexer.NewUnlexer(buf, lexer.WithInitialUnlexerMode(mode))
+	err := NewDumper(u, opts...).Dump(val)
+	if err != nil {
+		return nil, err
+	}
+	err = u.Flush()
+	if err != nil {
+		return nil, err
+	}
+	l := lexer.NewLexer(buf, lexer.WithInitialLexerMode(mode))
+	m := vm.NewVM()
+	for {
+		op, err := l.NextOp()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m.Top()
+}
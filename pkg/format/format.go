@@ -0,0 +1,207 @@
+// Package format rewrites Watson Representation in a normalized style without changing its meaning.
+//
+// A Formatter executes its input and writes the values left on the stack from the bottom to the top,
+// using the canonical encoding with keys of Objects kept in the order they were added (see dumper.WithNormalized),
+// decorated by a prettifier style and laid out by a layout.Writer.
+// Since the output depends only on those values and the options, formatting the output again does not change it,
+// and inputs that leave equal values with the same order of keys on the stack are formatted into the same output.
+package format
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/layout"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/prettifier"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Formatter formats Watson Representation.
+type Formatter struct {
+	inputMode     lexer.Mode
+	outputMode    lexer.Mode
+	styleName     string
+	styleConfig   *prettifier.Config
+	layout        layout.Style
+	width         int
+	indent        int
+	multiDocument bool
+}
+
+// FormatterOption configures a Formatter.
+type FormatterOption interface {
+	apply(*Formatter)
+}
+
+type formatterOption func(*Formatter)
+
+func (opt formatterOption) apply(f *Formatter) {
+	opt(f)
+}
+
+// WithInputMode sets the initial mode of the lexer that reads the input. The default is A.
+func WithInputMode(m lexer.Mode) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.inputMode = m
+	})
+}
+
+// WithOutputMode sets the initial mode of the output. The default is A.
+func WithOutputMode(m lexer.Mode) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.outputMode = m
+	})
+}
+
+// WithStyle makes a Formatter decorate its output with the prettifier style registered by the given name.
+// The default is "none", which writes the encoding as is.
+//
+// A new Style is created from cfg each time Format is called, so that the same input is always formatted into the same output.
+func WithStyle(name string, cfg *prettifier.Config) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.styleName = name
+		f.styleConfig = cfg
+	})
+}
+
+// WithLayout sets where line breaks are inserted into the output. The default is layout.None.
+func WithLayout(s layout.Style) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.layout = s
+	})
+}
+
+// WithWidth sets the width of lines used by the layout. The default is layout.DefaultWidth.
+func WithWidth(width int) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.width = width
+	})
+}
+
+// WithIndent sets the number of spaces per nesting level used by layout.Indent. The default is layout.DefaultIndent.
+func WithIndent(indent int) FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.indent = indent
+	})
+}
+
+// WithMultiDocument makes a Formatter read and write a multi-document stream.
+// Each non-empty document is formatted separately and followed by `lexer.DocumentSeparator` and a newline.
+// Empty documents are removed since Decoders skip them.
+//
+// See "Multi-Document Streams" in the specification for details.
+func WithMultiDocument() FormatterOption {
+	return formatterOption(func(f *Formatter) {
+		f.multiDocument = true
+	})
+}
+
+// NewFormatter creates a new Formatter.
+func NewFormatter(opts ...FormatterOption) *Formatter {
+	f := &Formatter{
+		inputMode:  lexer.A,
+		outputMode: lexer.A,
+		styleName:  "none",
+		layout:     layout.None,
+		width:      layout.DefaultWidth,
+		indent:     layout.DefaultIndent,
+	}
+	for _, opt := range opts {
+		opt.apply(f)
+	}
+	return f
+}
+
+// Format reads Watson Representation from r and writes its formatted version to w.
+// The output ends with a newline unless it is empty.
+//
+// If the VM fails to execute an instruction, it returns an error that wraps the VM's error and tells where the instruction is.
+// It returns an error that wraps prettifier.ErrUnknownStyle if the style is not registered.
+func (f *Formatter) Format(w io.Writer, r io.Reader) error {
+	style, err := prettifier.NewStyle(f.styleName, f.styleConfig)
+	if err != nil {
+		return err
+	}
+	end := &endWriter{w: w}
+	w = end
+	if f.layout != layout.None {
+		w = layout.NewWriter(
+			w,
+			layout.WithStyle(f.layout),
+			layout.WithWidth(f.width),
+			layout.WithIndent(f.indent),
+			layout.WithInitialMode(f.outputMode),
+		)
+	}
+	u := lexer.NewUnlexer(w, lexer.WithInitialUnlexerMode(f.outputMode))
+	d := dumper.NewDumper(prettifier.NewPrettifier(u, prettifier.WithStyle(style)), dumper.WithNormalized())
+
+	lexOpts := []lexer.LexerOption{lexer.WithInitialLexerMode(f.inputMode)}
+	if f.multiDocument {
+		lexOpts = append(lexOpts, lexer.WithMultiDocument())
+	}
+	lex := lexer.NewLexer(r, lexOpts...)
+	m := vm.NewVM()
+	for {
+		op, err := lex.NextOp()
+		if err == io.EOF || err == lexer.ErrEndOfDocument {
+			dumpErr := f.dumpDocument(d, u, m.Stack())
+			if dumpErr != nil {
+				return dumpErr
+			}
+			if err == io.EOF {
+				break
+			}
+			m.Reset()
+			continue
+		} else if err != nil {
+			return err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			line, column := lex.Position()
+			return fmt.Errorf("%w at line %d, column %d", err, line+1, column+1)
+		}
+	}
+	err = u.Flush()
+	if err != nil {
+		return err
+	}
+	if end.written && end.last != '\n' {
+		_, err = io.WriteString(end, "\n")
+	}
+	return err
+}
+
+// dumpDocument writes the values left on the stack by a document.
+func (f *Formatter) dumpDocument(d *dumper.Dumper, u *lexer.Unlexer, stack []*types.Value) error {
+	for _, v := range stack {
+		err := d.Dump(v)
+		if err != nil {
+			return err
+		}
+	}
+	if f.multiDocument && len(stack) > 0 {
+		return u.EndDocument()
+	}
+	return nil
+}
+
+// endWriter remembers the last byte written to it, so that the output can be terminated by a newline.
+type endWriter struct {
+	w       io.Writer
+	written bool
+	last    byte
+}
+
+func (e *endWriter) Write(p []byte) (int, error) {
+	n, err := e.w.Write(p)
+	if n > 0 {
+		e.written = true
+		e.last = p[n-1]
+	}
+	return n, err
+}
@@ -0,0 +1,213 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/layout"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/prettifier"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		opts []FormatterOption
+		want string
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: "",
+		},
+		{
+			name: "canonical",
+			in:   "~?SShaaarrkShaaaaarrk",
+			want: "~?SShaaakShaaaaak\n",
+		},
+		{
+			name: "decorations are removed",
+			in:   "~$BBubba-",
+			want: "~BBubba\n",
+		},
+		{
+			name: "all values on the stack",
+			in:   "Bu?",
+			want: "BBua?\n",
+		},
+		{
+			name: "input mode",
+			in:   "SShaak",
+			opts: []FormatterOption{WithInputMode(lexer.S)},
+			want: "BBubba\n",
+		},
+		{
+			name: "output mode",
+			in:   "BBubba",
+			opts: []FormatterOption{WithOutputMode(lexer.S)},
+			want: "SShaak\n",
+		},
+		{
+			name: "style",
+			in:   "~?SShaaakShaaaaak",
+			opts: []FormatterOption{WithStyle("classic", nil)},
+			want: "~?SShaaarrkShaaaaarrk\n",
+		},
+		{
+			name: "layout",
+			in:   "~?SShaaakShaaaaak",
+			opts: []FormatterOption{WithLayout(layout.Indent), WithIndent(4)},
+			want: "~\n    ?SShaaakShaaaaak\n",
+		},
+		{
+			name: "multi-document",
+			in:   "BBubba;;\n~;BBubba",
+			opts: []FormatterOption{WithMultiDocument()},
+			want: "BBubba;\n~;\nBBubba;\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := format(tc.in, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFormatFailsWhenInstructionFails(t *testing.T) {
+	// Iinc on Nil.
+	_, err := format("BBubba\n?\n  u")
+	if !errors.Is(err, vm.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "at line 3, column 3") {
+		t.Errorf("expected the error to tell the position but got %q", err.Error())
+	}
+}
+
+func TestFormatFailsWhenStyleIsUnknown(t *testing.T) {
+	_, err := format("BBubba", WithStyle("no-such-style", nil))
+	if !errors.Is(err, prettifier.ErrUnknownStyle) {
+		t.Errorf("expected ErrUnknownStyle but got %v", err)
+	}
+}
+
+func TestFormatPreservesTheOrderOfKeys(t *testing.T) {
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("zebra", types.NewIntValue(1))
+	obj.Set("ant", types.NewIntValue(2))
+	obj.Set("monkey", types.NewIntValue(3))
+	in, err := encode([]*types.Value{obj})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := format(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := execute(out, lexer.A)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"zebra", "ant", "monkey"}
+	if diff := cmp.Diff(want, got[0].OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestFormatPreservesValuesAndIsIdempotent formats random values in various ways,
+// and checks that the output leaves the same values on the stack and is not changed by formatting it again.
+func TestFormatPreservesValuesAndIsIdempotent(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		g := typestest.NewGenerator(seed, typestest.WithMaxDepth(3))
+		want := []*types.Value{g.Value(), g.Value()}
+		in, err := encode(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mode := range []lexer.Mode{lexer.A, lexer.S} {
+			for _, style := range prettifier.Styles() {
+				opts := []FormatterOption{
+					WithOutputMode(mode),
+					WithStyle(style, &prettifier.Config{Seed: seed, Words: []string{"watson", "fmt"}}),
+					WithLayout(layout.Style(seed % 3)),
+					WithWidth(int(seed % 40)),
+				}
+				name := fmt.Sprintf("seed %d, mode %d, style %s", seed, mode, style)
+				out, err := format(in, opts...)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				got, err := execute(out, mode)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				cmpOpts := []cmp.Option{typestest.CmpOption, cmpopts.EquateNaNs()}
+				if diff := cmp.Diff(want, got, cmpOpts...); diff != "" {
+					t.Fatalf("%s: mismatch (-want +got):\n%s", name, diff)
+				}
+				again, err := format(out, append(opts, WithInputMode(mode))...)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if again != out {
+					t.Fatalf("%s: formatting %q again resulted in %q", name, out, again)
+				}
+			}
+		}
+	}
+}
+
+func format(in string, opts ...FormatterOption) (string, error) {
+	var buf bytes.Buffer
+	err := NewFormatter(opts...).Format(&buf, strings.NewReader(in))
+	return buf.String(), err
+}
+
+// encode writes vals in a way that is different from a Formatter.
+func encode(vals []*types.Value) (string, error) {
+	var buf bytes.Buffer
+	u := lexer.NewUnlexer(&buf)
+	d := dumper.NewDumper(u, dumper.WithOptimization(dumper.OptimizeSize))
+	for _, v := range vals {
+		err := d.Dump(v)
+		if err != nil {
+			return "", err
+		}
+	}
+	err := u.Flush()
+	return buf.String(), err
+}
+
+func execute(in string, mode lexer.Mode) ([]*types.Value, error) {
+	l := lexer.NewLexer(strings.NewReader(in), lexer.WithInitialLexerMode(mode))
+	m := vm.NewVM()
+	for {
+		op, err := l.NextOp()
+		if err == io.EOF {
+			return m.Stack(), nil
+		} else if err != nil {
+			return nil, err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,316 @@
+// Package layout inserts whitespace into Watson Representation to make it readable.
+//
+// Since lexers ignore whitespace, the output represents exactly the same sequence of `vm.Op`s as the input.
+package layout
+
+import (
+	"io"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Style specifies where a Writer inserts line breaks.
+type Style int
+
+const (
+	// None makes a Writer write its input as is.
+	None Style = iota
+
+	// Wrap makes a Writer break lines that are longer than its width.
+	// Lines are never broken in the middle of instructions that build a character of a String, so that each character stays on a single line.
+	Wrap
+
+	// Indent makes a Writer break lines after each instruction that creates an Object or an Array or adds an element to it,
+	// and indent each line according to the nesting depth. Long lines are broken in the same way as Wrap.
+	Indent
+)
+
+const (
+	DefaultWidth  = 80 // the default width of lines
+	DefaultIndent = 2  // the default number of spaces per nesting level
+)
+
+// Writer is an io.Writer that reads Watson Representation and writes it to its underlying io.Writer with whitespace inserted.
+//
+// Writer keeps track of the mode and the values on the stack, so all bytes must be written in order from the beginning.
+// Bytes that do not represent any instruction are written as is.
+type Writer struct {
+	w           io.Writer
+	style       Style
+	width       int
+	indent      int
+	mode        lexer.Mode
+	initialMode lexer.Mode
+	stack       []value // the values on the stack, from the bottom to the top
+	column      int
+	brk         bool // whether a line break is inserted before the next instruction
+	buf         []byte
+	err         error
+}
+
+// WriterOption configures a Writer.
+type WriterOption interface {
+	apply(*Writer)
+}
+
+type writerOption func(*Writer)
+
+func (opt writerOption) apply(w *Writer) {
+	opt(w)
+}
+
+// WithStyle sets the style of a Writer. The default is Indent.
+func WithStyle(s Style) WriterOption {
+	return writerOption(func(w *Writer) {
+		w.style = s
+	})
+}
+
+// WithWidth sets the width of lines. Lines are not broken by width if it is less than or equal to zero.
+func WithWidth(width int) WriterOption {
+	return writerOption(func(w *Writer) {
+		w.width = width
+	})
+}
+
+// WithIndent sets the number of spaces per nesting level.
+func WithIndent(indent int) WriterOption {
+	return writerOption(func(w *Writer) {
+		w.indent = indent
+	})
+}
+
+// WithInitialMode sets the initial mode of the input. It must be the same as the one of the lexer that reads the output.
+func WithInitialMode(m lexer.Mode) WriterOption {
+	return writerOption(func(w *Writer) {
+		w.mode = m
+	})
+}
+
+// NewWriter creates a new Writer that writes to w.
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	lw := &Writer{
+		w:      w,
+		style:  Indent,
+		width:  DefaultWidth,
+		indent: DefaultIndent,
+		mode:   lexer.A,
+	}
+	for _, opt := range opts {
+		opt.apply(lw)
+	}
+	lw.initialMode = lw.mode
+	return lw
+}
+
+// Write writes p to the underlying io.Writer with whitespace inserted.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.style == None {
+		n, err := w.w.Write(p)
+		w.err = err
+		return n, err
+	}
+	w.buf = w.buf[:0]
+	for _, b := range p {
+		if b == lexer.DocumentSeparator {
+			// The next document starts with a new lexer and a new VM.
+			w.put(b)
+			w.mode = w.initialMode
+			w.stack = w.stack[:0]
+			w.brk = false
+			continue
+		}
+		op, ok := lexer.ReadOp(w.mode, b)
+		if !ok {
+			w.put(b)
+			continue
+		}
+		if w.brk && !isGeneric(op) {
+			w.newline(op)
+		}
+		w.put(b)
+		w.mode = lexer.NextMode(w.mode, op)
+		w.exec(op)
+		w.brk = w.brk || w.breaksAfter(op)
+	}
+	_, err := w.w.Write(w.buf)
+	if err != nil {
+		w.err = err
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *Writer) put(b byte) {
+	w.buf = append(w.buf, b)
+	if b == '\n' {
+		w.column = 0
+		w.brk = false
+	} else {
+		w.column++
+	}
+}
+
+// newline breaks the line and indents the next line that starts with op.
+func (w *Writer) newline(op vm.Op) {
+	w.buf = append(w.buf, '\n')
+	w.column = 0
+	w.brk = false
+	if w.style != Indent {
+		return
+	}
+	for i := w.depth(op) * w.indent; i > 0; i-- {
+		w.put(' ')
+	}
+}
+
+// breaksAfter reports whether a line break should be inserted after op, which has just been executed.
+func (w *Writer) breaksAfter(op vm.Op) bool {
+	if w.style == Indent {
+		switch op {
+		case vm.Onew, vm.Anew, vm.Oadd, vm.Aadd:
+			return true
+		}
+	}
+	if w.width <= 0 || w.column < w.width {
+		return false
+	}
+	return op == vm.Sadd || !w.buildingCharacter()
+}
+
+// buildingCharacter reports whether the Ints on the top of the stack are being built to be added to a String.
+// Note that a small Int that is being built to be a value of an Object is also regarded as a character, since it also follows a String.
+func (w *Writer) buildingCharacter() bool {
+	i := len(w.stack) - 1
+	for ; i >= 0 && w.stack[i].kind == types.Int; i-- {
+		if n := w.stack[i].n; n < -0xff || 0xff < n {
+			return false
+		}
+	}
+	return i >= 0 && i < len(w.stack)-1 && w.stack[i].kind == types.String
+}
+
+// depth returns the nesting level of a line that starts with op.
+func (w *Writer) depth(op vm.Op) int {
+	depth := 0
+	for _, v := range w.stack {
+		if isContainer(v.kind) {
+			depth++
+		}
+	}
+	// A line that adds an Object or an Array to another one closes it.
+	if (op == vm.Oadd || op == vm.Aadd) && depth > 0 && isContainer(w.top(0).kind) {
+		depth--
+	}
+	return depth
+}
+
+// value is a value on the stack. Only Ints have their contents, which are used to tell whether they are characters.
+type value struct {
+	kind types.Kind
+	n    int64
+}
+
+// exec updates the values on the stack as a VM does.
+// Since the layout does not affect the meaning of the input, it never fails even if the input is invalid.
+func (w *Writer) exec(op vm.Op) {
+	switch op {
+	case vm.Inew:
+		w.push(value{kind: types.Int})
+	case vm.Iinc:
+		w.push(value{kind: types.Int, n: w.pop().n + 1})
+	case vm.Ishl:
+		w.push(value{kind: types.Int, n: w.pop().n << 1})
+	case vm.Ineg:
+		w.push(value{kind: types.Int, n: -w.pop().n})
+	case vm.Iadd:
+		b, a := w.pop(), w.pop()
+		w.push(value{kind: types.Int, n: a.n + b.n})
+	case vm.Isht:
+		b, a := w.pop(), w.pop()
+		n := a.n
+		if b.n >= 0 {
+			n <<= uint64(b.n)
+		} else {
+			n >>= uint64(-b.n)
+		}
+		w.push(value{kind: types.Int, n: n})
+	case vm.Itof, vm.Fneg:
+		w.pop()
+		w.push(value{kind: types.Float})
+	case vm.Itou:
+		w.pop()
+		w.push(value{kind: types.Uint})
+	case vm.Finf, vm.Fnan:
+		w.push(value{kind: types.Float})
+	case vm.Snew:
+		w.push(value{kind: types.String})
+	case vm.Sadd:
+		w.pop()
+		w.pop()
+		w.push(value{kind: types.String})
+	case vm.Onew:
+		w.push(value{kind: types.Object})
+	case vm.Oadd:
+		w.pop()
+		w.pop()
+		w.pop()
+		w.push(value{kind: types.Object})
+	case vm.Anew:
+		w.push(value{kind: types.Array})
+	case vm.Aadd:
+		w.pop()
+		w.pop()
+		w.push(value{kind: types.Array})
+	case vm.Bnew:
+		w.push(value{kind: types.Bool})
+	case vm.Bneg:
+		w.pop()
+		w.push(value{kind: types.Bool})
+	case vm.Nnew:
+		w.push(value{kind: types.Nil})
+	case vm.Gdup:
+		w.push(w.top(0))
+	case vm.Gpop:
+		w.pop()
+	case vm.Gswp:
+		a, b := w.pop(), w.pop()
+		w.push(a)
+		w.push(b)
+	}
+}
+
+func (w *Writer) push(v value) {
+	w.stack = append(w.stack, v)
+}
+
+// pop removes the top of the stack and returns it. It returns Nil if the stack is empty.
+func (w *Writer) pop() value {
+	v := w.top(0)
+	if len(w.stack) > 0 {
+		w.stack = w.stack[:len(w.stack)-1]
+	}
+	return v
+}
+
+// top returns the i-th value from the top of the stack, or Nil if there is no such value.
+func (w *Writer) top(i int) value {
+	if i >= len(w.stack) {
+		return value{kind: types.Nil}
+	}
+	return w.stack[len(w.stack)-1-i]
+}
+
+func isContainer(k types.Kind) bool {
+	return k == types.Object || k == types.Array
+}
+
+// isGeneric reports whether op is a generic operation, which is not worth starting a new line with.
+func isGeneric(op vm.Op) bool {
+	return op == vm.Gdup || op == vm.Gpop || op == vm.Gswp
+}
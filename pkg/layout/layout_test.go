@@ -0,0 +1,150 @@
+package layout
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/prettifier"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func sampleValue() *types.Value {
+	return types.NewObjectValue(map[string]*types.Value{
+		"name": types.NewStringValue([]byte("The quick brown fox jumps over the lazy dog")),
+		"tags": types.NewArrayValue([]*types.Value{
+			types.NewStringValue([]byte("tako")),
+			types.NewObjectValue(map[string]*types.Value{
+				"ika": types.NewIntValue(-1234567890123),
+			}),
+			types.NewBoolValue(true),
+			types.NewNilValue(),
+		}),
+		"pi": types.NewFloatValue(3.14),
+	})
+}
+
+// encode returns the prettified Watson Representation of v.
+func encode(t *testing.T, v *types.Value) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	u := lexer.NewUnlexer(buf)
+	err := dumper.NewDumper(prettifier.NewPrettifier(u)).Dump(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func readAll(t *testing.T, b []byte) []vm.Op {
+	t.Helper()
+	ops := make([]vm.Op, 0)
+	l := lexer.NewLexer(bytes.NewReader(b))
+	for {
+		op, err := l.NextOp()
+		if err == io.EOF {
+			return ops
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, op)
+	}
+}
+
+// format writes src to a Writer in small chunks and returns the output.
+func format(t *testing.T, src []byte, opts ...WriterOption) []byte {
+	t.Helper()
+	buf := bytes.NewBuffer(nil)
+	w := NewWriter(buf, opts...)
+	for i := 0; i < len(src); i += 7 {
+		end := i + 7
+		if end > len(src) {
+			end = len(src)
+		}
+		n, err := w.Write(src[i:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != end-i {
+			t.Fatalf("expected %d bytes to be written but got %d", end-i, n)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestWriterDoesNotChangeOps(t *testing.T) {
+	src := encode(t, sampleValue())
+	for _, style := range []Style{None, Wrap, Indent} {
+		for _, width := range []int{0, 1, 20, 80} {
+			got := format(t, src, WithStyle(style), WithWidth(width))
+			if diff := cmp.Diff(readAll(t, src), readAll(t, got)); diff != "" {
+				t.Errorf("style %d, width %d: mismatch (-want +got):\n%s", style, width, diff)
+			}
+		}
+	}
+}
+
+func TestWriterWithNoneWritesInputAsIs(t *testing.T) {
+	src := encode(t, sampleValue())
+	got := format(t, src, WithStyle(None))
+	if diff := cmp.Diff(src, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterWithIndentBreaksLinesAtStructuralBoundaries(t *testing.T) {
+	// Onew Snew Inew Iinc Sadd Anew Bnew Aadd Oadd, i.e. {"\x01": [false]}
+	src := []byte("~?Sh-v^?g")
+	want := "~\n  ?Sh-v\n    ^?\n  g"
+	got := format(t, src, WithStyle(Indent))
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterWithIndentUsesGivenIndentation(t *testing.T) {
+	src := []byte("~?Sh-v^?g")
+	want := "~\n ?Sh-v\n  ^?\n g"
+	got := format(t, src, WithStyle(Indent), WithIndent(1))
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriterWithWrapBreaksLinesAfterCharacters(t *testing.T) {
+	src := encode(t, types.NewStringValue([]byte("The quick brown fox jumps over the lazy dog")))
+	got := format(t, src, WithStyle(Wrap), WithWidth(20))
+	lines := strings.Split(string(got), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("expected multiple lines but got %q", got)
+	}
+	for _, line := range lines[:len(lines)-1] {
+		// Sadd is `-` in S mode, which the lexer is in after Snew.
+		if !strings.HasSuffix(line, "-") {
+			t.Errorf("expected a line to end with Sadd: %q", line)
+		}
+		if len(line) < 20 {
+			t.Errorf("expected a line to be at least %d bytes: %q", 20, line)
+		}
+	}
+}
+
+func TestWriterResetsModeAtDocumentSeparator(t *testing.T) {
+	// Snew | Anew Bnew Aadd
+	src := []byte("?;\n@zs")
+	want := "?;\n@\n  zs"
+	got := format(t, src, WithStyle(Indent))
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+package lexer_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// FuzzLexerAndVM asserts that arbitrary input never makes the lexer nor the VM panic,
+// and that the value left on the stack is restored by dumping it and executing the output again.
+func FuzzLexerAndVM(f *testing.F) {
+	for _, src := range []string{
+		"", "B", "?SShak", "~?$#zM", "@Bus", "Bubbbbbbbbbba", "qp", "?$#~?SShkShaakShaaak-M", "EEEE", "#%",
+	} {
+		f.Add([]byte(src))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		top, err := execute(src)
+		if err != nil {
+			return
+		}
+		w := lexer.NewSliceWriter()
+		err = dumper.NewDumper(w).Dump(top)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := newVM()
+		err = m.FeedMulti(w.Ops())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := m.Top()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(top, got, cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	})
+}
+
+// execute executes src and returns the value on the top of the stack.
+func execute(src []byte) (*types.Value, error) {
+	l := lexer.NewLexer(bytes.NewReader(src))
+	m := newVM()
+	for {
+		op, err := l.NextOp()
+		if err == io.EOF {
+			return m.Top()
+		} else if err != nil {
+			return nil, err
+		}
+		err = m.Feed(op)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newVM creates a VM that does not run out of memory by values that are duplicated repeatedly.
+func newVM() *vm.VM {
+	return vm.NewVM(vm.WithMaxAllocatedBytes(1 << 20))
+}
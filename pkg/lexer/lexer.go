@@ -60,6 +60,7 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
 	"io"
 
@@ -85,6 +86,13 @@ type Token struct {
 
 var newline = char("\n")
 
+// DocumentSeparator is a character that separates documents in a multi-document stream.
+// Since it does not correspond to any instruction in either mode, a lexer that does not support multi-document streams just ignores it.
+const DocumentSeparator byte = ';'
+
+// ErrEndOfDocument is returned by Lexer.Next when it hits DocumentSeparator in a multi-document stream.
+var ErrEndOfDocument = errors.New("end of document")
+
 // LexerOption configures a Lexer.
 type LexerOption interface {
 	apply(*Lexer)
@@ -111,6 +119,14 @@ func WithFileName(name string) LexerOption {
 	})
 }
 
+// WithMultiDocument makes a lexer regard DocumentSeparator as the end of a document.
+// Each time a lexer hits DocumentSeparator, it resets its mode to the initial one.
+func WithMultiDocument() LexerOption {
+	return lexerOption(func(l *Lexer) {
+		l.multiDocument = true
+	})
+}
+
 // Lexer converts a Watson Representation into a sequence of `vm.Op`s.
 // Each lexer has its state called mode. Its default mode is A, and whenever it yields the `Snew` instruction, it flips its mode.
 //
@@ -123,20 +139,33 @@ func WithFileName(name string) LexerOption {
 // Then it hits '?', which is now interpreted as `Snew`, yields `Snew`, and changes its current mode to A.
 // In the end, it hits 'q' and yields `Finf`, and it stops its lexing procedure.
 type Lexer struct {
-	r        io.Reader
-	mode     Mode
-	buf      [1]byte
-	fileName string
-	line     int
-	column   int
+	r             io.Reader
+	mode          Mode
+	initialMode   Mode
+	multiDocument bool
+	buf           []byte
+	pos           int   // the index of the next byte in buf
+	end           int   // the number of valid bytes in buf
+	err           error // an error returned by r, which is reported after all bytes in buf are consumed
+	fileName      string
+	line          int // the position of the next byte
+	column        int
+	opLine        int // the position of the last Op
+	opColumn      int
 }
 
+// BufferSize is the size of the internal buffers of Lexer and Unlexer.
+const BufferSize = 4096
+
 // Creates a new Lexer that reads Watson Representation from r.
+//
+// The Lexer reads ahead from r into its internal buffer, so r should not be read by anything else while the Lexer is in use.
 func NewLexer(r io.Reader, opts ...LexerOption) *Lexer {
-	l := &Lexer{r: r, mode: A}
+	l := &Lexer{r: r, mode: A, buf: make([]byte, BufferSize)}
 	for _, opt := range opts {
 		opt.apply(l)
 	}
+	l.initialMode = l.mode
 	return l
 }
 
@@ -147,33 +176,108 @@ func (l *Lexer) Mode() Mode {
 
 // Returns the next Op.
 // This returns io.EOF if it hits on the end of the input.
+// If the lexer is created with WithMultiDocument, this also returns ErrEndOfDocument if it hits on DocumentSeparator.
+//
+// Next allocates a new Token each time it is called. Use NextOp and Position instead if it matters.
 func (l *Lexer) Next() (*Token, error) {
+	op, err := l.NextOp()
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		Op:       op,
+		FileName: l.fileName,
+		Line:     l.opLine,
+		Column:   l.opColumn,
+	}, nil
+}
+
+// NextOp is the same as Next except that it returns only the Op without allocating a Token.
+// The position of the Op can be obtained by Position.
+func (l *Lexer) NextOp() (vm.Op, error) {
 	for {
-		_, err := l.r.Read(l.buf[:])
-		if err != nil {
-			// Note that it returns io.EOF if the underlying Reader returns io.EOF.
-			return nil, err
+		if l.pos >= l.end {
+			err := l.fill()
+			if err != nil {
+				// Note that it returns io.EOF if the underlying Reader returns io.EOF.
+				return 0, err
+			}
 		}
+		b := l.buf[l.pos]
+		l.pos++
 		line := l.line
 		col := l.column
-		if l.buf[0] == newline {
+		if b == newline {
 			l.line++
 			l.column = 0
 		} else {
 			l.column++
 		}
-		if op, ok := readOp(l.mode, l.buf[0]); ok {
-			l.mode = nextMode(l.mode, op)
-			return &Token{
-				Op:       op,
-				FileName: l.fileName,
-				Line:     line,
-				Column:   col,
-			}, nil
+		if l.multiDocument && b == DocumentSeparator {
+			l.mode = l.initialMode
+			return 0, ErrEndOfDocument
+		}
+		if op, ok := ReadOp(l.mode, b); ok {
+			l.mode = NextMode(l.mode, op)
+			l.opLine = line
+			l.opColumn = col
+			return op, nil
 		}
 	}
 }
 
+// Position returns the position of the Op that is returned by the last call of Next or NextOp.
+// Both line and column start from 0, as well as the ones in Token.
+func (l *Lexer) Position() (line, column int) {
+	return l.opLine, l.opColumn
+}
+
+// Resume makes the lexer read from r after it has read all bytes from the previous io.Reader.
+// The mode and the position of the lexer are kept, so that a Watson Representation can be split into multiple readers.
+// Bytes that have been buffered but not read yet are read before the ones from r.
+func (l *Lexer) Resume(r io.Reader) {
+	l.r = r
+	l.err = nil
+}
+
+// Reset makes the lexer read from r as if it were newly created by NewLexer with the same options.
+// Unlike Resume, it discards buffered bytes and resets the mode and the position, but it keeps the internal buffer to reduce allocations.
+func (l *Lexer) Reset(r io.Reader) {
+	l.r = r
+	l.mode = l.initialMode
+	l.pos = 0
+	l.end = 0
+	l.err = nil
+	l.line = 0
+	l.column = 0
+	l.opLine = 0
+	l.opColumn = 0
+}
+
+// Buffered returns the number of bytes that have been read from the underlying io.Reader but not consumed by the lexer yet.
+func (l *Lexer) Buffered() int {
+	return l.end - l.pos
+}
+
+// FileName returns the file name that is set by WithFileName.
+func (l *Lexer) FileName() string {
+	return l.fileName
+}
+
+// fill reads the next chunk from the underlying Reader.
+func (l *Lexer) fill() error {
+	for l.err == nil {
+		n, err := l.r.Read(l.buf)
+		l.pos = 0
+		l.end = n
+		l.err = err
+		if n > 0 {
+			return nil
+		}
+	}
+	return l.err
+}
+
 // OpWriter is an abstract interface that defines what the Unlexer does.
 type OpWriter interface {
 	Write(vm.Op) error
@@ -207,7 +311,7 @@ func (s *SliceWriter) Ops() []vm.Op {
 
 func (s *SliceWriter) Write(op vm.Op) error {
 	s.ops = append(s.ops, op)
-	s.mode = nextMode(s.mode, op)
+	s.mode = NextMode(s.mode, op)
 	return nil
 }
 
@@ -230,9 +334,14 @@ func WithInitialUnlexerMode(m Mode) UnlexerOption {
 }
 
 // Unlexer converts a sequence of `vm.Op`s into a sequence of characters.
+//
+// Unlexer buffers its output. Flush must be called after all Ops are written.
 type Unlexer struct {
-	w    io.Writer
-	mode Mode
+	w           io.Writer
+	mode        Mode
+	initialMode Mode
+	buf         []byte
+	err         error // the first error returned by w, which is returned by all subsequent writes
 }
 
 // NewUnlexer returns a new Unlexer that writes to w.
@@ -240,20 +349,58 @@ func NewUnlexer(w io.Writer, opts ...UnlexerOption) *Unlexer {
 	u := &Unlexer{
 		w:    w,
 		mode: A,
+		buf:  make([]byte, 0, BufferSize),
 	}
 	for _, opt := range opts {
 		opt.apply(u)
 	}
+	u.initialMode = u.mode
 	return u
 }
 
 // Write writes an Op to the underlying io.Writer.
+// The output may be buffered until Flush is called.
 func (u *Unlexer) Write(op vm.Op) error {
-	b := make([]byte, 1)
-	b[0] = showOp(u.mode, op)
-	u.mode = nextMode(u.mode, op)
-	_, err := u.w.Write(b)
-	return err
+	if u.err != nil {
+		return u.err
+	}
+	u.buf = append(u.buf, showOp(u.mode, op))
+	u.mode = NextMode(u.mode, op)
+	if len(u.buf) >= BufferSize {
+		return u.Flush()
+	}
+	return nil
+}
+
+// EndDocument writes DocumentSeparator followed by a newline to the underlying io.Writer, and then resets its mode to the initial one.
+// The output may be buffered until Flush is called.
+func (u *Unlexer) EndDocument() error {
+	if u.err != nil {
+		return u.err
+	}
+	u.mode = u.initialMode
+	u.buf = append(u.buf, DocumentSeparator, newline)
+	if len(u.buf) >= BufferSize {
+		return u.Flush()
+	}
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (u *Unlexer) Flush() error {
+	if u.err != nil {
+		return u.err
+	}
+	if len(u.buf) == 0 {
+		return nil
+	}
+	_, err := u.w.Write(u.buf)
+	if err != nil {
+		u.err = err
+		return err
+	}
+	u.buf = u.buf[:0]
+	return nil
 }
 
 // Mode returns the unlexer's current mode.
@@ -261,7 +408,8 @@ func (u *Unlexer) Mode() Mode {
 	return u.mode
 }
 
-func nextMode(mode Mode, op vm.Op) Mode {
+// NextMode returns the mode of a lexer after it yields op in mode.
+func NextMode(mode Mode, op vm.Op) Mode {
 	var next Mode
 	switch mode {
 	case A:
@@ -338,6 +486,17 @@ var opTableS = map[byte]vm.Op{
 
 var reversedTableS map[vm.Op]byte
 
+// lookupTable and reversedLookupTable are array versions of the tables above, which are indexed by Mode.
+var (
+	lookupTable         [2][256]lookupEntry
+	reversedLookupTable [2][]byte
+)
+
+type lookupEntry struct {
+	op vm.Op
+	ok bool
+}
+
 func init() {
 	reversedTableA = make(map[vm.Op]byte)
 	for k, v := range opTableA {
@@ -347,36 +506,38 @@ func init() {
 	for k, v := range opTableS {
 		reversedTableS[v] = k
 	}
+	for m, table := range []map[byte]vm.Op{A: opTableA, S: opTableS} {
+		for b, op := range table {
+			lookupTable[m][b].op = op
+			lookupTable[m][b].ok = true
+		}
+	}
+	for m, table := range []map[vm.Op]byte{A: reversedTableA, S: reversedTableS} {
+		reversedLookupTable[m] = make([]byte, len(vm.AllOps()))
+		for op, b := range table {
+			reversedLookupTable[m][op] = b
+		}
+	}
 }
 
-func readOp(m Mode, b byte) (op vm.Op, ok bool) {
-	var table map[byte]vm.Op
-	switch m {
-	case A:
-		table = opTableA
-	case S:
-		table = opTableS
-	default:
+// ReadOp returns the Op that b represents in mode m.
+// ok is false if b does not represent any Op, in which case a lexer just skips b.
+func ReadOp(m Mode, b byte) (op vm.Op, ok bool) {
+	if m != A && m != S {
 		panic(fmt.Errorf("unknown mode: %d", m))
 	}
-	op, ok = table[b]
-	return
+	entry := &lookupTable[m][b]
+	return entry.op, entry.ok
 }
 
 func showOp(m Mode, op vm.Op) byte {
-	var table map[vm.Op]byte
-	switch m {
-	case A:
-		table = reversedTableA
-	case S:
-		table = reversedTableS
-	default:
+	if m != A && m != S {
 		panic(fmt.Errorf("unknown mode: %d", m))
 	}
-	if b, ok := table[op]; ok {
-		return b
+	if op < 0 || int(op) >= len(reversedLookupTable[m]) {
+		panic(fmt.Errorf("unknown Op: %#v\n", op))
 	}
-	panic(fmt.Errorf("unknown Op: %#v\n", op))
+	return reversedLookupTable[m][op]
 }
 
 func char(s string) byte {
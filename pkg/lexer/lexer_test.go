@@ -2,8 +2,12 @@ package lexer
 
 import (
 	"bytes"
+	"errors"
 	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/genkami/watson/pkg/vm"
 
@@ -214,6 +218,10 @@ func TestWriteWritesAnOp(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
 	want := []byte("B")
 	got := buf.Bytes()
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -233,6 +241,10 @@ func TestWriteChangesItsModeWhenHittingSnew(t *testing.T) {
 			t.Fatal(err)
 		}
 	}
+	err := u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	got := buf.Bytes()
 	if diff := cmp.Diff(want, got); diff != "" {
@@ -266,3 +278,342 @@ func readAll(s string) ([]vm.Op, error) {
 		out = append(out, tok.Op)
 	}
 }
+
+func TestNextIgnoresDocumentSeparatorByDefault(t *testing.T) {
+	got, err := readAll("B;u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []vm.Op{vm.Inew, vm.Iinc}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("expected %#v but got %#v", want, got)
+	}
+}
+
+func TestNextReturnsErrEndOfDocumentWhenMultiDocumentIsEnabled(t *testing.T) {
+	l := NewLexer(bytes.NewReader([]byte("B;u")), WithMultiDocument())
+	tok, err := l.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Op != vm.Inew {
+		t.Errorf("expected %#v but got %#v", vm.Inew, tok.Op)
+	}
+	_, err = l.Next()
+	if err != ErrEndOfDocument {
+		t.Fatalf("expected ErrEndOfDocument but got %#v", err)
+	}
+	tok, err = l.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Op != vm.Iinc {
+		t.Errorf("expected %#v but got %#v", vm.Iinc, tok.Op)
+	}
+}
+
+func TestDocumentSeparatorResetsModeToInitialMode(t *testing.T) {
+	l := NewLexer(bytes.NewReader([]byte("b?;b")), WithInitialLexerMode(A), WithMultiDocument())
+	want := []vm.Op{vm.Ishl, vm.Snew, vm.Ishl}
+	got := make([]vm.Op, 0, len(want))
+	for {
+		tok, err := l.Next()
+		if err == io.EOF {
+			break
+		} else if err == ErrEndOfDocument {
+			if l.Mode() != A {
+				t.Errorf("expected %#v but got %#v", A, l.Mode())
+			}
+			continue
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok.Op)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("expected %#v but got %#v", want, got)
+	}
+}
+
+func TestEndDocumentWritesSeparatorAndResetsMode(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	u := NewUnlexer(buf, WithInitialUnlexerMode(S))
+	for _, op := range []vm.Op{vm.Snew, vm.Snew, vm.Snew} {
+		err := u.Write(op)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := u.EndDocument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Mode() != S {
+		t.Errorf("expected %#v but got %#v", S, u.Mode())
+	}
+	want := []byte("$?$;\n")
+	got := buf.Bytes()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("expected %#v but got %#v", want, got)
+	}
+}
+
+func TestNextOpReturnsOpsAndPositions(t *testing.T) {
+	l := NewLexer(bytes.NewReader([]byte("B\n u?S")))
+	want := []struct {
+		op           vm.Op
+		line, column int
+	}{
+		{vm.Inew, 0, 0},
+		{vm.Iinc, 1, 1},
+		{vm.Snew, 1, 2},
+		{vm.Inew, 1, 3},
+	}
+	for _, w := range want {
+		op, err := l.NextOp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, column := l.Position()
+		if op != w.op || line != w.line || column != w.column {
+			t.Errorf("expected %#v at %d:%d but got %#v at %d:%d", w.op, w.line, w.column, op, line, column)
+		}
+	}
+	_, err := l.NextOp()
+	if err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestNextOpReadsInputLongerThanBuffer(t *testing.T) {
+	src := strings.Repeat("Bu?Sh$", BufferSize)
+	for _, r := range []io.Reader{
+		strings.NewReader(src),
+		iotest.OneByteReader(strings.NewReader(src)),
+		iotest.HalfReader(strings.NewReader(src)),
+		iotest.DataErrReader(strings.NewReader(src)),
+	} {
+		l := NewLexer(r)
+		n := 0
+		for {
+			_, err := l.NextOp()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+		if n != len(src) {
+			t.Errorf("expected %d ops but got %d", len(src), n)
+		}
+	}
+}
+
+func TestNextOpReturnsErrorOfReader(t *testing.T) {
+	l := NewLexer(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("BB"))))
+	_, err := l.NextOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.NextOp()
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("expected ErrTimeout but got %v", err)
+	}
+}
+
+func TestResumeKeepsModeAndPosition(t *testing.T) {
+	l := NewLexer(strings.NewReader("B?\nS"))
+	for i := 0; i < 2; i++ {
+		_, err := l.NextOp()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := l.NextOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = l.NextOp()
+	if err != io.EOF {
+		t.Fatalf("expected EOF but got %v", err)
+	}
+	l.Resume(strings.NewReader("h"))
+	op, err := l.NextOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, column := l.Position()
+	if op != vm.Iinc || line != 1 || column != 1 {
+		t.Errorf("expected %#v at 1:1 but got %#v at %d:%d", vm.Iinc, op, line, column)
+	}
+	_, err = l.NextOp()
+	if err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestResetDiscardsModeAndPosition(t *testing.T) {
+	l := NewLexer(strings.NewReader("B?\nSSSS"))
+	for i := 0; i < 3; i++ {
+		_, err := l.NextOp()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 'B' is Inew in mode A, which is the initial mode.
+	l.Reset(strings.NewReader("B"))
+	op, err := l.NextOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, column := l.Position()
+	if op != vm.Inew || line != 0 || column != 0 {
+		t.Errorf("expected %#v at 0:0 but got %#v at %d:%d", vm.Inew, op, line, column)
+	}
+	_, err = l.NextOp()
+	if err != io.EOF {
+		t.Errorf("expected EOF but got %v", err)
+	}
+}
+
+func TestBufferedReturnsTheNumberOfUnreadBytes(t *testing.T) {
+	l := NewLexer(strings.NewReader("BuBu"))
+	_, err := l.NextOp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Buffered() != 3 {
+		t.Errorf("expected %d but got %d", 3, l.Buffered())
+	}
+}
+
+func TestUnlexerBuffersOutputUntilFlush(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	u := NewUnlexer(buf)
+	err := u.Write(vm.Inew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected output to be buffered but got %#v", buf.Bytes())
+	}
+	err = u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte("B"), buf.Bytes()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestUnlexerFlushesWhenBufferIsFull(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	u := NewUnlexer(buf)
+	for i := 0; i < BufferSize+1; i++ {
+		err := u.Write(vm.Inew)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.Len() != BufferSize {
+		t.Errorf("expected %d bytes to be written but got %d", BufferSize, buf.Len())
+	}
+	err := u.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != BufferSize+1 {
+		t.Errorf("expected %d bytes to be written but got %d", BufferSize+1, buf.Len())
+	}
+}
+
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func TestUnlexerReturnsErrorOfWriterOnSubsequentWrites(t *testing.T) {
+	u := NewUnlexer(failingWriter{})
+	err := u.Write(vm.Inew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = u.Flush()
+	if !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected errWriteFailed but got %v", err)
+	}
+	err = u.Write(vm.Inew)
+	if !errors.Is(err, errWriteFailed) {
+		t.Errorf("expected errWriteFailed but got %v", err)
+	}
+}
+
+// largeInput is about 1MB of Watson Representation.
+var largeInput = []byte(strings.Repeat("BBubaBubaBubaBubaBubaBubaBubaBuba?SShkShaaaaakShaaaaaak-$\n", 1<<14))
+
+func BenchmarkLexerNext(b *testing.B) {
+	b.SetBytes(int64(len(largeInput)))
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(bytes.NewReader(largeInput))
+		for {
+			_, err := l.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkLexerNextOp(b *testing.B) {
+	b.SetBytes(int64(len(largeInput)))
+	for i := 0; i < b.N; i++ {
+		l := NewLexer(bytes.NewReader(largeInput))
+		for {
+			_, err := l.NextOp()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkUnlexerWrite(b *testing.B) {
+	ops := make([]vm.Op, 0, len(largeInput))
+	l := NewLexer(bytes.NewReader(largeInput))
+	for {
+		op, err := l.NextOp()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			b.Fatal(err)
+		}
+		ops = append(ops, op)
+	}
+	b.SetBytes(int64(len(ops)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		u := NewUnlexer(ioutil.Discard)
+		for _, op := range ops {
+			err := u.Write(op)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		err := u.Flush()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Package lint reports suspicious parts of Watson programs.
+//
+// A Linter executes a program on a VM and reports Findings, each of which belongs to one of the following Rules:
+//
+//	dead-value        a value is discarded by Gpop, so the instructions that built it have no effect.
+//	duplicate-key     Oadd overwrites a key that is already in the Object.
+//	leftover          a value is left on the stack below the top, where Decode ignores it.
+//	mode-confusion    a character is ignored or fails in the current mode, but it is a valid instruction in the other mode.
+//
+// Each Rule can be disabled individually. Note that decorations inserted by the prettifier intentionally contain dead values.
+package lint
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/typecheck"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+var (
+	ErrUnknownRule = errors.New("unknown rule")
+)
+
+// Rule identifies a kind of Findings.
+type Rule string
+
+const (
+	DeadValue     Rule = "dead-value"
+	DuplicateKey  Rule = "duplicate-key"
+	Leftover      Rule = "leftover"
+	ModeConfusion Rule = "mode-confusion"
+)
+
+// Rules returns all Rules in sorted order.
+func Rules() []Rule {
+	return []Rule{DeadValue, DuplicateKey, Leftover, ModeConfusion}
+}
+
+// ParseRule returns the Rule of the given name.
+// It returns ErrUnknownRule if there is no such Rule.
+func ParseRule(name string) (Rule, error) {
+	for _, r := range Rules() {
+		if string(r) == name {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownRule, name)
+}
+
+// Finding is a suspicious part of a program.
+type Finding struct {
+	Rule    Rule
+	Token   *lexer.Token // the instruction that the Finding is about and its position
+	Message string
+}
+
+// String returns the Finding in the form of "FILE:LINE:COLUMN: MESSAGE (RULE)", where FILE is omitted if the Token has no file name.
+// Both LINE and COLUMN start from 1.
+func (f *Finding) String() string {
+	pos := fmt.Sprintf("%d:%d", f.Token.Line+1, f.Token.Column+1)
+	if f.Token.FileName != "" {
+		pos = f.Token.FileName + ":" + pos
+	}
+	return fmt.Sprintf("%s: %s (%s)", pos, f.Message, f.Rule)
+}
+
+// Linter reports Findings in programs.
+type Linter struct {
+	mode          lexer.Mode
+	fileName      string
+	multiDocument bool
+	disabled      map[Rule]bool
+}
+
+// LinterOption configures a Linter.
+type LinterOption interface {
+	apply(*Linter)
+}
+
+type linterOption func(*Linter)
+
+func (opt linterOption) apply(l *Linter) {
+	opt(l)
+}
+
+// WithInitialMode sets the initial mode of programs. The default is A.
+func WithInitialMode(m lexer.Mode) LinterOption {
+	return linterOption(func(l *Linter) {
+		l.mode = m
+	})
+}
+
+// WithFileName sets the file name of Tokens in Findings.
+func WithFileName(name string) LinterOption {
+	return linterOption(func(l *Linter) {
+		l.fileName = name
+	})
+}
+
+// WithMultiDocument makes a Linter read a multi-document stream, where each document is executed on an empty VM.
+func WithMultiDocument() LinterOption {
+	return linterOption(func(l *Linter) {
+		l.multiDocument = true
+	})
+}
+
+// WithDisabledRules prevents a Linter from reporting Findings of the given Rules.
+func WithDisabledRules(rules ...Rule) LinterOption {
+	return linterOption(func(l *Linter) {
+		for _, r := range rules {
+			l.disabled[r] = true
+		}
+	})
+}
+
+// NewLinter creates a new Linter.
+func NewLinter(opts ...LinterOption) *Linter {
+	l := &Linter{
+		mode:     lexer.A,
+		disabled: map[Rule]bool{},
+	}
+	for _, opt := range opts {
+		opt.apply(l)
+	}
+	return l
+}
+
+// Lint executes a program read from r and returns Findings sorted by their positions.
+//
+// If the VM fails to execute an instruction, it returns the Findings reported so far
+// and an error that wraps the VM's error and tells where the instruction is.
+func (l *Linter) Lint(r io.Reader) ([]Finding, error) {
+	s := &state{linter: l, vm: vm.NewVM(), mode: l.mode}
+	br := bufio.NewReader(r)
+	line, column := 0, 0
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return s.sorted(), err
+		}
+		// The position is counted in the same way as lexer.Lexer.
+		tokLine, tokColumn := line, column
+		if b == '\n' {
+			line++
+			column = 0
+		} else {
+			column++
+		}
+		if l.multiDocument && b == lexer.DocumentSeparator {
+			s.endDocument()
+			continue
+		}
+		op, ok := lexer.ReadOp(s.mode, b)
+		if !ok {
+			if other, ok := lexer.ReadOp(otherMode(s.mode), b); ok {
+				s.report(ModeConfusion, s.token(other, tokLine, tokColumn),
+					"%q is ignored in mode %s, but it is %#v in mode %s", b, modeName(s.mode), other, modeName(otherMode(s.mode)))
+			}
+			continue
+		}
+		tok := s.token(op, tokLine, tokColumn)
+		err = s.exec(tok, b)
+		if err != nil {
+			return s.sorted(), fmt.Errorf("%w at line %d, column %d", err, tok.Line+1, tok.Column+1)
+		}
+	}
+	s.endDocument()
+	return s.sorted(), nil
+}
+
+// state is the state of a Linter while it lints a program.
+type state struct {
+	linter   *Linter
+	vm       *vm.VM
+	mode     lexer.Mode
+	origins  []*lexer.Token // the instructions that started building each value on the stack, from the bottom to the top
+	findings []Finding
+}
+
+func (s *state) token(op vm.Op, line, column int) *lexer.Token {
+	return &lexer.Token{Op: op, FileName: s.linter.fileName, Line: line, Column: column}
+}
+
+func (s *state) report(rule Rule, tok *lexer.Token, format string, args ...interface{}) {
+	if s.linter.disabled[rule] {
+		return
+	}
+	s.findings = append(s.findings, Finding{Rule: rule, Token: tok, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *state) sorted() []Finding {
+	sort.SliceStable(s.findings, func(i, j int) bool {
+		a, b := s.findings[i].Token, s.findings[j].Token
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return s.findings
+}
+
+// exec executes tok, which is represented by b, and keeps track of where each value on the stack comes from.
+func (s *state) exec(tok *lexer.Token, b byte) error {
+	op := tok.Op
+	switch op {
+	case vm.Gpop:
+		if v, err := s.vm.Top(); err == nil {
+			origin := s.origin(0)
+			s.report(DeadValue, tok, "Gpop discards the %#v built at line %d, column %d", v.Kind, origin.Line+1, origin.Column+1)
+		}
+	case vm.Oadd:
+		if s.canExecute(op) {
+			key, _ := s.vm.Peek(1)
+			obj, _ := s.vm.Peek(2)
+			if _, ok := obj.Object[string(key.String)]; ok {
+				s.report(DuplicateKey, tok, "Oadd overwrites the key %q that is already in the Object", key.String)
+			}
+		}
+	}
+	err := s.vm.Feed(op)
+	if err != nil {
+		other := otherMode(s.mode)
+		if otherOp, ok := lexer.ReadOp(other, b); ok && s.canExecute(otherOp) {
+			s.report(ModeConfusion, tok, "%#v fails in mode %s, but %q is %#v in mode %s", op, modeName(s.mode), b, otherOp, modeName(other))
+		}
+		return err
+	}
+	s.mode = lexer.NextMode(s.mode, op)
+
+	switch op {
+	case vm.Gpop:
+		s.origins = s.origins[:len(s.origins)-1]
+	case vm.Gdup:
+		s.origins = append(s.origins, tok)
+	case vm.Gswp:
+		n := len(s.origins)
+		s.origins[n-1], s.origins[n-2] = s.origins[n-2], s.origins[n-1]
+	default:
+		// The result is regarded as the deepest operand that is modified, e.g. the Object that Oadd adds a key to.
+		origin := tok
+		if n := len(typecheck.EffectOf(op).Operands); n > 0 {
+			origin = s.origin(n - 1)
+			s.origins = s.origins[:len(s.origins)-n]
+		}
+		s.origins = append(s.origins, origin)
+	}
+	return nil
+}
+
+// endDocument reports values left below the top of the stack and empties the stack for the next document.
+func (s *state) endDocument() {
+	for i := 0; i < len(s.origins)-1; i++ {
+		v, _ := s.vm.Peek(len(s.origins) - 1 - i)
+		s.report(Leftover, s.origins[i], "the %#v built here is left below the top of the stack", v.Kind)
+	}
+	s.vm.Reset()
+	s.origins = s.origins[:0]
+	s.mode = s.linter.mode
+}
+
+// origin returns the instruction that started building the i-th value from the top of the stack.
+func (s *state) origin(i int) *lexer.Token {
+	return s.origins[len(s.origins)-1-i]
+}
+
+// canExecute reports whether the stack has all operands of op.
+func (s *state) canExecute(op vm.Op) bool {
+	for i, k := range typecheck.EffectOf(op).Operands {
+		v, err := s.vm.Peek(i)
+		if err != nil || (k != typecheck.Any && v.Kind != k) {
+			return false
+		}
+	}
+	return true
+}
+
+func otherMode(m lexer.Mode) lexer.Mode {
+	if m == lexer.A {
+		return lexer.S
+	}
+	return lexer.A
+}
+
+func modeName(m lexer.Mode) string {
+	if m == lexer.A {
+		return "A"
+	}
+	return "S"
+}
@@ -0,0 +1,167 @@
+package lint
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestLint(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		opts []LinterOption
+		want []string
+	}{
+		{
+			name: "no findings",
+			// [1, nil, {"": [true]}]
+			in:   "@Bus.s~?v^!?g?\n",
+			want: nil,
+		},
+		{
+			name: "dead value",
+			in:   "BBubba\n.#",
+			want: []string{
+				"2:2: Gpop discards the Nil built at line 2, column 1 (dead-value)",
+			},
+		},
+		{
+			name: "dead value built by multiple instructions",
+			in:   "BBubba\n@Bus#",
+			want: []string{
+				"2:5: Gpop discards the Array built at line 2, column 1 (dead-value)",
+			},
+		},
+		{
+			name: "duplicate key",
+			// {"\x01": 1, "\x01": nil}
+			in: unlex(t, vm.Onew, vm.Snew, vm.Inew, vm.Iinc, vm.Sadd, vm.Inew, vm.Iinc, vm.Oadd,
+				vm.Snew, vm.Inew, vm.Iinc, vm.Sadd, vm.Nnew, vm.Oadd),
+			want: []string{
+				`1:14: Oadd overwrites the key "\x01" that is already in the Object (duplicate-key)`,
+			},
+		},
+		{
+			name: "leftover",
+			in:   "Bu\n.\n~",
+			want: []string{
+				"1:1: the Int built here is left below the top of the stack (leftover)",
+				"2:1: the Nil built here is left below the top of the stack (leftover)",
+			},
+		},
+		{
+			name: "character of the other mode",
+			in:   "Bh",
+			want: []string{
+				"1:2: 'h' is ignored in mode A, but it is Iinc in mode S (mode-confusion)",
+			},
+		},
+		{
+			name: "whitespace",
+			in:   "B \n\t1",
+			want: nil,
+		},
+		{
+			name: "initial mode",
+			in:   "Sh",
+			opts: []LinterOption{WithInitialMode(lexer.S)},
+			want: nil,
+		},
+		{
+			name: "disabled rules",
+			in:   "Bh.\n.#",
+			opts: []LinterOption{WithDisabledRules(ModeConfusion, Leftover)},
+			want: []string{
+				"2:2: Gpop discards the Nil built at line 2, column 1 (dead-value)",
+			},
+		},
+		{
+			name: "file name",
+			in:   ".#",
+			opts: []LinterOption{WithFileName("a.watson")},
+			want: []string{
+				"a.watson:1:2: Gpop discards the Nil built at line 1, column 1 (dead-value)",
+			},
+		},
+		{
+			name: "multi-document",
+			in:   "B.;B;",
+			opts: []LinterOption{WithMultiDocument()},
+			want: []string{
+				"1:1: the Int built here is left below the top of the stack (leftover)",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			findings, err := NewLinter(tc.opts...).Lint(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, describe(findings)); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLintReportsModeConfusionWhenInstructionFails(t *testing.T) {
+	// Iinc on a Float, which would be Fneg in mode S.
+	findings, err := NewLinter().Lint(strings.NewReader("B\nqu"))
+	if !errors.Is(err, vm.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch but got %v", err)
+	}
+	if !strings.Contains(err.Error(), "at line 2, column 2") {
+		t.Errorf("expected the error to tell the position but got %q", err.Error())
+	}
+	// Values left on the stack are not reported since the program does not finish.
+	want := []string{"2:2: Iinc fails in mode A, but 'u' is Fneg in mode S (mode-confusion)"}
+	if diff := cmp.Diff(want, describe(findings)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	for _, r := range Rules() {
+		got, err := ParseRule(string(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != r {
+			t.Errorf("expected %s but got %s", r, got)
+		}
+	}
+	_, err := ParseRule("no-such-rule")
+	if !errors.Is(err, ErrUnknownRule) {
+		t.Errorf("expected ErrUnknownRule but got %v", err)
+	}
+}
+
+func describe(findings []Finding) []string {
+	var s []string
+	for _, f := range findings {
+		s = append(s, f.String())
+	}
+	return s
+}
+
+func unlex(t *testing.T, ops ...vm.Op) string {
+	t.Helper()
+	var buf bytes.Buffer
+	u := lexer.NewUnlexer(&buf)
+	for _, op := range ops {
+		if err := u.Write(op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := u.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,159 @@
+package prettifier
+
+import (
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// anyKind is an operand that can be a value of any kind.
+const anyKind types.Kind = -1
+
+// noop builds a sequence of Ops that has no effect on the stack as a whole.
+// Each Op is executed on temporary values that are pushed by the sequence itself, and all of them are popped at the end,
+// so the values that are already on the stack are never touched.
+type noop struct {
+	mode  lexer.Mode
+	temps []types.Kind // the kinds of the temporary values, from the bottom to the top
+	ops   []vm.Op
+}
+
+func newNoop(mode lexer.Mode) *noop {
+	return &noop{mode: mode}
+}
+
+// add appends op to the sequence after pushing temporary values that op takes as operands if necessary.
+func (n *noop) add(op vm.Op) {
+	args := operands(op)
+	if !n.hasOperands(args) {
+		for _, k := range args {
+			n.pushTemp(k)
+		}
+	}
+	n.emit(op)
+}
+
+// spell appends an Op that is represented by c.
+// If c represents no Op in the current mode, it switches the mode first.
+// It does nothing if c represents no Op in either mode.
+func (n *noop) spell(c byte) {
+	op, ok := lexer.ReadOp(n.mode, c)
+	if !ok {
+		op, ok = lexer.ReadOp(lexer.NextMode(n.mode, vm.Snew), c)
+		if !ok {
+			return
+		}
+		n.emit(vm.Snew)
+	}
+	// Operands are pushed by Ops that do not change the mode, so op is still represented by c.
+	n.add(op)
+}
+
+// finish pops all temporary values and returns the sequence.
+func (n *noop) finish() []vm.Op {
+	for len(n.temps) > 0 {
+		n.emit(vm.Gpop)
+	}
+	return n.ops
+}
+
+func (n *noop) hasOperands(args []types.Kind) bool {
+	if len(n.temps) < len(args) {
+		return false
+	}
+	base := len(n.temps) - len(args)
+	for i, k := range args {
+		if k != anyKind && n.temps[base+i] != k {
+			return false
+		}
+	}
+	return true
+}
+
+// pushTemp pushes a new temporary value of kind k without changing the mode.
+func (n *noop) pushTemp(k types.Kind) {
+	switch k {
+	case types.Int:
+		n.emit(vm.Inew)
+	case types.Float:
+		n.emit(vm.Finf)
+	case types.String:
+		// Snew changes the mode, so it is cancelled out by another Snew.
+		n.emit(vm.Snew)
+		n.emit(vm.Snew)
+		n.emit(vm.Gpop)
+	case types.Object:
+		n.emit(vm.Onew)
+	case types.Array:
+		n.emit(vm.Anew)
+	case types.Bool:
+		n.emit(vm.Bnew)
+	default:
+		n.emit(vm.Nnew)
+	}
+}
+
+// emit appends op to the sequence. The stack must have all operands of op.
+func (n *noop) emit(op vm.Op) {
+	n.ops = append(n.ops, op)
+	n.mode = lexer.NextMode(n.mode, op)
+	top := len(n.temps) - 1
+	switch op {
+	case vm.Gdup:
+		n.temps = append(n.temps, n.temps[top])
+	case vm.Gpop:
+		n.temps = n.temps[:top]
+	case vm.Gswp:
+		n.temps[top], n.temps[top-1] = n.temps[top-1], n.temps[top]
+	default:
+		n.temps = append(n.temps[:len(n.temps)-len(operands(op))], result(op))
+	}
+}
+
+// operands returns the kinds of values that op takes, from the bottom to the top.
+func operands(op vm.Op) []types.Kind {
+	switch op {
+	case vm.Iinc, vm.Ishl, vm.Ineg, vm.Itof, vm.Itou:
+		return []types.Kind{types.Int}
+	case vm.Iadd, vm.Isht:
+		return []types.Kind{types.Int, types.Int}
+	case vm.Fneg:
+		return []types.Kind{types.Float}
+	case vm.Sadd:
+		return []types.Kind{types.String, types.Int}
+	case vm.Oadd:
+		return []types.Kind{types.Object, types.String, anyKind}
+	case vm.Aadd:
+		return []types.Kind{types.Array, anyKind}
+	case vm.Bneg:
+		return []types.Kind{types.Bool}
+	case vm.Gdup, vm.Gpop:
+		return []types.Kind{anyKind}
+	case vm.Gswp:
+		return []types.Kind{anyKind, anyKind}
+	default:
+		return nil
+	}
+}
+
+// result returns the kind of the value that op pushes. op must not be a generic operation.
+func result(op vm.Op) types.Kind {
+	switch op {
+	case vm.Inew, vm.Iinc, vm.Ishl, vm.Iadd, vm.Ineg, vm.Isht:
+		return types.Int
+	case vm.Itof, vm.Finf, vm.Fnan, vm.Fneg:
+		return types.Float
+	case vm.Itou:
+		return types.Uint
+	case vm.Snew, vm.Sadd:
+		return types.String
+	case vm.Onew, vm.Oadd:
+		return types.Object
+	case vm.Anew, vm.Aadd:
+		return types.Array
+	case vm.Bnew, vm.Bneg:
+		return types.Bool
+	default:
+		return types.Nil
+	}
+}
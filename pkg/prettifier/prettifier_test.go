@@ -9,6 +9,7 @@ import (
 
 	"github.com/genkami/watson/pkg/lexer"
 	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
 	"github.com/genkami/watson/pkg/vm"
 )
 
@@ -30,7 +31,7 @@ func TestPrettifierDoesNotChangeSemantics(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
-		if diff := cmp.Diff(origResult, prettifiedResult); diff != "" {
+		if diff := cmp.Diff(origResult, prettifiedResult, typestest.CmpOption); diff != "" {
 			t.Errorf("mismatch (-want +got):\n%s", diff)
 		}
 		actual, err := unlex(prettified)
@@ -67,9 +68,9 @@ func lex(src string) ([]vm.Op, error) {
 	}
 }
 
-func prettify(orig []vm.Op) ([]vm.Op, error) {
+func prettify(orig []vm.Op, opts ...PrettifierOption) ([]vm.Op, error) {
 	sw := lexer.NewSliceWriter()
-	p := NewPrettifier(sw)
+	p := NewPrettifier(sw, opts...)
 	for _, op := range orig {
 		err := p.Write(op)
 		if err != nil {
@@ -99,5 +100,9 @@ func unlex(ops []vm.Op) (string, error) {
 			return "", err
 		}
 	}
+	err := ul.Flush()
+	if err != nil {
+		return "", err
+	}
 	return buf.String(), nil
 }
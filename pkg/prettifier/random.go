@@ -0,0 +1,38 @@
+package prettifier
+
+import (
+	"math/rand"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+const (
+	randomRate   = 4 // a random decoration is inserted before one in randomRate Ops on average
+	randomMaxLen = 4 // the maximum number of Ops in a random decoration other than ones that push or pop temporary values
+)
+
+// randomStyle inserts random sequences of Ops that have no effect.
+// The output is determined only by its seed and its input.
+type randomStyle struct {
+	rand *rand.Rand
+	ops  []vm.Op
+}
+
+func newRandomStyle(seed int64) *randomStyle {
+	return &randomStyle{
+		rand: rand.New(rand.NewSource(seed)),
+		ops:  vm.AllOps(),
+	}
+}
+
+func (s *randomStyle) Decorate(op vm.Op, _ *vm.Op, mode lexer.Mode) []vm.Op {
+	if s.rand.Intn(randomRate) != 0 {
+		return []vm.Op{op}
+	}
+	n := newNoop(mode)
+	for i := s.rand.Intn(randomMaxLen) + 1; i > 0; i-- {
+		n.add(s.ops[s.rand.Intn(len(s.ops))])
+	}
+	return append(n.finish(), op)
+}
@@ -0,0 +1,140 @@
+package prettifier
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+var (
+	ErrUnknownStyle = errors.New("unknown style")
+)
+
+// Style determines how a Prettifier decorates Ops.
+type Style interface {
+	// Decorate returns a sequence of Ops that is written instead of op.
+	// last is the Op that was written to the Prettifier just before op, or nil if op is the first one.
+	// mode is the mode of the underlying OpWriter just before op is written.
+	//
+	// The returned Ops must have exactly the same effect on the stack as op alone.
+	Decorate(op vm.Op, last *vm.Op, mode lexer.Mode) []vm.Op
+}
+
+// Config is passed to functions that create Styles.
+// Each Style may ignore some or all of the fields.
+type Config struct {
+	Seed  int64    // the seed of random number generators
+	Words []string // the words that a Style writes in its output
+}
+
+// StyleFunc creates a new Style from cfg.
+type StyleFunc func(cfg *Config) Style
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]StyleFunc{}
+)
+
+// Register makes a Style available by the given name.
+// It panics if a Style with the same name is already registered.
+func Register(name string, f StyleFunc) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Errorf("style %q is already registered", name))
+	}
+	registry[name] = f
+}
+
+// NewStyle creates a new Style that is registered by the given name.
+// It returns ErrUnknownStyle if there is no such Style.
+func NewStyle(name string, cfg *Config) (Style, error) {
+	registryMu.RLock()
+	f, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStyle, name)
+	}
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	return f(cfg), nil
+}
+
+// Styles returns the names of all registered Styles in sorted order.
+func Styles() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	Register("none", func(*Config) Style { return noneStyle{} })
+	Register("classic", func(*Config) Style { return classicStyle{} })
+	Register("random", func(cfg *Config) Style { return newRandomStyle(cfg.Seed) })
+	Register("words", func(cfg *Config) Style { return newWordsStyle(cfg.Words) })
+}
+
+// noneStyle does not decorate anything.
+type noneStyle struct{}
+
+func (noneStyle) Decorate(op vm.Op, _ *vm.Op, _ lexer.Mode) []vm.Op {
+	return []vm.Op{op}
+}
+
+// classicStyle is the original style of Prettifier.
+type classicStyle struct{}
+
+func (classicStyle) Decorate(op vm.Op, last *vm.Op, mode lexer.Mode) []vm.Op {
+	if last == nil {
+		return []vm.Op{op}
+	}
+	switch mode {
+	case lexer.A:
+		return decorateClassicA(op, *last)
+	case lexer.S:
+		return decorateClassicS(op, *last)
+	default:
+		panic(fmt.Errorf("unknown mode: %d", mode))
+	}
+}
+
+func decorateClassicA(op vm.Op, last vm.Op) []vm.Op {
+	if last == vm.Bnew && op == vm.Oadd {
+		return []vm.Op{vm.Bneg, vm.Bneg, vm.Oadd}
+	} else if topShouldBeInt(last) && op == vm.Oadd {
+		return []vm.Op{vm.Ineg, vm.Ineg, vm.Oadd, vm.Gdup, vm.Gpop}
+	} else {
+		return []vm.Op{op}
+	}
+}
+
+func decorateClassicS(op vm.Op, last vm.Op) []vm.Op {
+	if last == vm.Ishl && op == vm.Iadd { // Sharrk
+		return []vm.Op{vm.Ineg, vm.Ineg, vm.Iadd}
+	} else if last == vm.Isht && op == vm.Iadd { // ShaArrk
+		return []vm.Op{vm.Ineg, vm.Ineg, vm.Iadd}
+	} else if op == vm.Onew { // Samee+
+		return []vm.Op{vm.Inew, vm.Ishl, vm.Finf, vm.Gpop, vm.Gpop, vm.Onew}
+	} else {
+		return []vm.Op{op}
+	}
+}
+
+func topShouldBeInt(op vm.Op) bool {
+	for _, v := range []vm.Op{vm.Inew, vm.Iinc, vm.Ishl, vm.Iadd, vm.Ineg, vm.Isht} {
+		if op == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package prettifier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestEveryStyleDoesNotChangeSemantics(t *testing.T) {
+	for i := 0; i < 200; i++ {
+		v := typestest.NewGenerator(int64(i)).Value()
+		orig := dump(t, v)
+		for _, name := range Styles() {
+			cfg := &Config{Seed: int64(i), Words: []string{"hello", "Watson", "Sharrk", "", "!?"}}
+			s, err := NewStyle(name, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			prettified, err := prettify(orig, WithStyle(s))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := execute(prettified)
+			if err != nil {
+				t.Fatalf("style %s: %v", name, err)
+			}
+			if diff := cmp.Diff(v, got, cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+				t.Errorf("style %s: mismatch (-want +got):\n%s", name, diff)
+			}
+		}
+	}
+}
+
+func TestNoneStyleWritesOpsAsIs(t *testing.T) {
+	orig, err := lex("~?$#BM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStyle("none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := prettify(orig, WithStyle(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(orig, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRandomStyleIsDeterminedBySeed(t *testing.T) {
+	orig := dump(t, typestest.NewGenerator(1).Value())
+	decorate := func(seed int64) string {
+		s, err := NewStyle("random", &Config{Seed: seed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops, err := prettify(orig, WithStyle(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := unlex(ops)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	if decorate(42) != decorate(42) {
+		t.Errorf("expected the same output for the same seed")
+	}
+	if decorate(42) == decorate(43) {
+		t.Errorf("expected different outputs for different seeds")
+	}
+}
+
+func TestWordsStyleSpellsWords(t *testing.T) {
+	orig, err := lex("~?$#BM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStyle("words", &Config{Words: []string{"hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := prettify(orig, WithStyle(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := unlex(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "l" represents no Op in either mode.
+	if strings.Count(got, "She") != 2 {
+		t.Errorf("expected %#v to spell the word before both Onew and Oadd", got)
+	}
+}
+
+func TestNewStyleReturnsErrorIfStyleIsUnknown(t *testing.T) {
+	_, err := NewStyle("no-such-style", nil)
+	if !errors.Is(err, ErrUnknownStyle) {
+		t.Errorf("expected %v but got %v", ErrUnknownStyle, err)
+	}
+}
+
+func TestRegisterPanicsIfStyleIsAlreadyRegistered(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected Register to panic")
+		}
+	}()
+	Register("classic", func(*Config) Style { return noneStyle{} })
+}
+
+func dump(t *testing.T, v *types.Value) []vm.Op {
+	t.Helper()
+	sw := lexer.NewSliceWriter()
+	err := dumper.NewDumper(sw).Dump(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sw.Ops()
+}
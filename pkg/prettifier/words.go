@@ -0,0 +1,31 @@
+package prettifier
+
+import (
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// wordsStyle spells the given words in turn before the first Op and before each Op that adds an element to an Object or an Array.
+// Each word is written by Ops that operate only on temporary values, which are popped after the word.
+// Characters that represent no Op in either mode are skipped, and some extra characters may appear around the word.
+type wordsStyle struct {
+	words []string
+	next  int
+}
+
+func newWordsStyle(words []string) *wordsStyle {
+	return &wordsStyle{words: words}
+}
+
+func (s *wordsStyle) Decorate(op vm.Op, last *vm.Op, mode lexer.Mode) []vm.Op {
+	if len(s.words) == 0 || (last != nil && op != vm.Oadd && op != vm.Aadd) {
+		return []vm.Op{op}
+	}
+	word := s.words[s.next]
+	s.next = (s.next + 1) % len(s.words)
+	n := newNoop(mode)
+	for i := 0; i < len(word); i++ {
+		n.spell(word[i])
+	}
+	return append(n.finish(), op)
+}
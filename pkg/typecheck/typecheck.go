@@ -0,0 +1,306 @@
+// Package typecheck checks Watson programs without executing them.
+//
+// Since the kind of the value that each `vm.Op` pushes depends only on the Op itself and the kinds of its operands,
+// keeping track of only the kinds of values is enough to tell whether a VM fails to execute a program and what kinds of values are left on the stack.
+// It is much cheaper than executing the program, since no values are built.
+//
+// Note that a Checker does not know the limits of a VM other than the stack size (e.g. vm.WithMaxStringLength), so the VM may still fail due to them.
+package typecheck
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+// Signature is the kinds of values on a stack, from the bottom to the top.
+type Signature []types.Kind
+
+// String returns the Signature in the form of e.g. "[Int, Object]".
+func (s Signature) String() string {
+	names := make([]string, 0, len(s))
+	for _, k := range s {
+		names = append(names, fmt.Sprintf("%#v", k))
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+// Equal reports whether s and other have the same kinds in the same order.
+func (s Signature) Equal(other Signature) bool {
+	if len(s) != len(other) {
+		return false
+	}
+	for i := range s {
+		if s[i] != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseSignature parses a Signature in the same form as the one returned by Signature.String.
+func ParseSignature(s string) (Signature, error) {
+	t := strings.TrimSpace(s)
+	if !strings.HasPrefix(t, "[") || !strings.HasSuffix(t, "]") {
+		return nil, fmt.Errorf("invalid signature: %s", s)
+	}
+	t = strings.TrimSpace(t[1 : len(t)-1])
+	sig := Signature{}
+	if t == "" {
+		return sig, nil
+	}
+	for _, name := range strings.Split(t, ",") {
+		k, ok := kindOf(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown kind %q in signature: %s", strings.TrimSpace(name), s)
+		}
+		sig = append(sig, k)
+	}
+	return sig, nil
+}
+
+func kindOf(name string) (types.Kind, bool) {
+	for k := types.Int; k <= types.Nil; k++ {
+		if fmt.Sprintf("%#v", k) == name {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// Any is an operand of an Effect that can be a value of any kind.
+const Any types.Kind = -1
+
+// Effect is what an Op does to the kinds on the stack.
+type Effect struct {
+	Operands []types.Kind // the kinds of values that the Op pops, from the top of the stack
+	Result   types.Kind   // the kind of the value that the Op pushes; Any for generic operations, which push their operands instead
+}
+
+// effects follows the comments on each Op in watson/pkg/vm.
+var effects = [...]Effect{
+	vm.Inew: {nil, types.Int},
+	vm.Iinc: {[]types.Kind{types.Int}, types.Int},
+	vm.Ishl: {[]types.Kind{types.Int}, types.Int},
+	vm.Iadd: {[]types.Kind{types.Int, types.Int}, types.Int},
+	vm.Ineg: {[]types.Kind{types.Int}, types.Int},
+	vm.Isht: {[]types.Kind{types.Int, types.Int}, types.Int},
+	vm.Itof: {[]types.Kind{types.Int}, types.Float},
+	vm.Itou: {[]types.Kind{types.Int}, types.Uint},
+	vm.Finf: {nil, types.Float},
+	vm.Fnan: {nil, types.Float},
+	vm.Fneg: {[]types.Kind{types.Float}, types.Float},
+	vm.Snew: {nil, types.String},
+	vm.Sadd: {[]types.Kind{types.Int, types.String}, types.String},
+	vm.Onew: {nil, types.Object},
+	vm.Oadd: {[]types.Kind{Any, types.String, types.Object}, types.Object},
+	vm.Anew: {nil, types.Array},
+	vm.Aadd: {[]types.Kind{Any, types.Array}, types.Array},
+	vm.Bnew: {nil, types.Bool},
+	vm.Bneg: {[]types.Kind{types.Bool}, types.Bool},
+	vm.Nnew: {nil, types.Nil},
+	vm.Gdup: {[]types.Kind{Any}, Any},
+	vm.Gpop: {[]types.Kind{Any}, Any},
+	vm.Gswp: {[]types.Kind{Any, Any}, Any},
+}
+
+// EffectOf returns the Effect of op. Its Operands are shared, so they must not be modified.
+func EffectOf(op vm.Op) Effect {
+	if op < 0 || int(op) >= len(effects) {
+		panic(fmt.Errorf("invalid opcode: %d", op))
+	}
+	return effects[op]
+}
+
+// Stack is an abstract stack of a VM, which keeps track of only the kinds of values.
+type Stack struct {
+	kinds []types.Kind
+	size  int
+}
+
+// NewStack returns an empty Stack that can have at most size values, in the same way as vm.WithStackSize.
+// If size is less than or equal to zero, vm.DefaultStackSize will be used.
+func NewStack(size int) *Stack {
+	if size <= 0 {
+		size = vm.DefaultStackSize
+	}
+	return &Stack{size: size}
+}
+
+// Feed changes the kinds on the stack as a VM does when it executes op.
+// If the VM would fail, it returns a *vm.ExecError whose fields other than Preview are the same as the VM's, and the stack is left unchanged.
+// Preview is always empty since there are no values.
+func (s *Stack) Feed(op vm.Op) error {
+	e := EffectOf(op)
+	depth := len(s.kinds)
+	// Operands are checked from the top as the VM pops them.
+	for i, want := range e.Operands {
+		if i >= depth {
+			return s.execError(op, vm.ErrStackEmpty, 0, 0)
+		}
+		if got := s.kinds[depth-1-i]; want != Any && got != want {
+			return s.execError(op, vm.ErrTypeMismatch, want, got)
+		}
+	}
+	switch op {
+	case vm.Gdup:
+		if depth >= s.size {
+			return s.execError(op, vm.ErrMaximumStackSizeExceeded, 0, 0)
+		}
+		s.kinds = append(s.kinds, s.kinds[depth-1])
+	case vm.Gpop:
+		s.kinds = s.kinds[:depth-1]
+	case vm.Gswp:
+		s.kinds[depth-1], s.kinds[depth-2] = s.kinds[depth-2], s.kinds[depth-1]
+	default:
+		n := depth - len(e.Operands)
+		if n >= s.size {
+			return s.execError(op, vm.ErrMaximumStackSizeExceeded, 0, 0)
+		}
+		s.kinds = append(s.kinds[:n], e.Result)
+	}
+	return nil
+}
+
+func (s *Stack) execError(op vm.Op, err error, expected, actual types.Kind) *vm.ExecError {
+	return &vm.ExecError{Op: op, Err: err, Expected: expected, Actual: actual, Depth: len(s.kinds)}
+}
+
+// Depth returns the number of values on the stack.
+func (s *Stack) Depth() int {
+	return len(s.kinds)
+}
+
+// Signature returns the kinds of values on the stack.
+func (s *Stack) Signature() Signature {
+	return append(Signature{}, s.kinds...)
+}
+
+// CheckError tells which instruction a VM would fail to execute.
+type CheckError struct {
+	Token *lexer.Token  // the instruction that would fail and its position
+	Err   *vm.ExecError // the error that the VM would return; see Stack.Feed
+	Stack Signature     // the kinds of values on the stack just before the instruction
+}
+
+// Error returns the error in the same form as lint.Finding, e.g. "a.watson:2:2: Iinc: type mismatch".
+func (e *CheckError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Token.Line+1, e.Token.Column+1)
+	if e.Token.FileName != "" {
+		pos = e.Token.FileName + ":" + pos
+	}
+	return fmt.Sprintf("%s: %s", pos, e.Err.Error())
+}
+
+func (e *CheckError) Unwrap() error {
+	return e.Err
+}
+
+// Checker checks programs.
+type Checker struct {
+	mode          lexer.Mode
+	fileName      string
+	stackSize     int
+	multiDocument bool
+}
+
+// CheckerOption configures a Checker.
+type CheckerOption interface {
+	apply(*Checker)
+}
+
+type checkerOption func(*Checker)
+
+func (opt checkerOption) apply(c *Checker) {
+	opt(c)
+}
+
+// WithInitialMode sets the initial mode of programs. The default is A.
+func WithInitialMode(m lexer.Mode) CheckerOption {
+	return checkerOption(func(c *Checker) {
+		c.mode = m
+	})
+}
+
+// WithFileName sets the file name of Tokens in CheckErrors.
+func WithFileName(name string) CheckerOption {
+	return checkerOption(func(c *Checker) {
+		c.fileName = name
+	})
+}
+
+// WithStackSize sets the stack size of the VM that is supposed to execute programs. See NewStack for details.
+func WithStackSize(size int) CheckerOption {
+	return checkerOption(func(c *Checker) {
+		c.stackSize = size
+	})
+}
+
+// WithMultiDocument makes a Checker read a multi-document stream, where each document is checked on an empty stack.
+func WithMultiDocument() CheckerOption {
+	return checkerOption(func(c *Checker) {
+		c.multiDocument = true
+	})
+}
+
+// NewChecker creates a new Checker.
+func NewChecker(opts ...CheckerOption) *Checker {
+	c := &Checker{mode: lexer.A}
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+	return c
+}
+
+// Check reads a program from r and returns the Signature of the stack that the program leaves.
+// If a VM would fail to execute an instruction, it returns a *CheckError.
+//
+// If the Checker reads a multi-document stream, it returns the Signature of the last document that CheckDocuments returns.
+func (c *Checker) Check(r io.Reader) (Signature, error) {
+	sigs, err := c.CheckDocuments(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) == 0 {
+		return Signature{}, nil
+	}
+	return sigs[len(sigs)-1], nil
+}
+
+// CheckDocuments is the same as Check, but it returns the Signature of each document in a multi-document stream.
+// Documents that leave no values are skipped since Decoders skip them.
+// Unless WithMultiDocument is given, the whole program is a single document and it returns exactly one Signature.
+func (c *Checker) CheckDocuments(r io.Reader) ([]Signature, error) {
+	lexOpts := []lexer.LexerOption{lexer.WithInitialLexerMode(c.mode), lexer.WithFileName(c.fileName)}
+	if c.multiDocument {
+		lexOpts = append(lexOpts, lexer.WithMultiDocument())
+	}
+	lex := lexer.NewLexer(r, lexOpts...)
+	s := NewStack(c.stackSize)
+	var sigs []Signature
+	for {
+		op, err := lex.NextOp()
+		if err == io.EOF || err == lexer.ErrEndOfDocument {
+			if !c.multiDocument || s.Depth() > 0 {
+				sigs = append(sigs, s.Signature())
+			}
+			if err == io.EOF {
+				return sigs, nil
+			}
+			s = NewStack(c.stackSize)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		err = s.Feed(op)
+		if err != nil {
+			line, column := lex.Position()
+			tok := &lexer.Token{Op: op, FileName: c.fileName, Line: line, Column: column}
+			return nil, &CheckError{Token: tok, Err: err.(*vm.ExecError), Stack: s.Signature()}
+		}
+	}
+}
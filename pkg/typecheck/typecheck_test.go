@@ -0,0 +1,297 @@
+package typecheck
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/dumper"
+	"github.com/genkami/watson/pkg/lexer"
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+	"github.com/genkami/watson/pkg/vm"
+)
+
+func TestCheck(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		opts []CheckerOption
+		want string
+	}{
+		{"empty", "", nil, "[]"},
+		{"single value", "BBubba", nil, "[Int]"},
+		// [1, nil, {"": [true]}]
+		{"nested values", "@Bus.s~?v^!?g?", nil, "[Array]"},
+		{"multiple values", "Bu.~?", nil, "[Int, Nil, Object, String]"},
+		{"generic operations", "B.%E.#", nil, "[Nil, Int, Int]"},
+		{"conversions", "Bi Bu' qp", nil, "[Float, Uint, Float]"},
+		{"initial mode", "Sh$", []CheckerOption{WithInitialMode(lexer.S)}, "[Int, String]"},
+		{"last document", "BBubba;~;", []CheckerOption{WithMultiDocument()}, "[Object]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sig, err := NewChecker(tc.opts...).Check(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sig.String(); got != tc.want {
+				t.Errorf("expected %s but got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckFails(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		in       string
+		opts     []CheckerOption
+		want     error
+		expected types.Kind
+		actual   types.Kind
+		stack    string
+		message  string
+	}{
+		{
+			name:     "type mismatch",
+			in:       "B\nqu",
+			want:     vm.ErrTypeMismatch,
+			expected: types.Int,
+			actual:   types.Float,
+			stack:    "[Int, Float]",
+			message:  "2:2: Iinc: type mismatch (expected Int, got Float); stack depth: 2",
+		},
+		{
+			name:    "stack underflow",
+			in:      "Ba",
+			want:    vm.ErrStackEmpty,
+			stack:   "[Int]",
+			message: "1:2: Iadd: stack is empty; stack depth: 1",
+		},
+		{
+			name:    "stack overflow",
+			in:      "B.E",
+			opts:    []CheckerOption{WithStackSize(2), WithFileName("a.watson")},
+			want:    vm.ErrMaximumStackSizeExceeded,
+			stack:   "[Int, Nil]",
+			message: "a.watson:1:3: Gdup: maximum stack size exceeded; stack depth: 2",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewChecker(tc.opts...).Check(strings.NewReader(tc.in))
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("expected %v but got %v", tc.want, err)
+			}
+			var cerr *CheckError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("expected *CheckError but got %#v", err)
+			}
+			if cerr.Err.Expected != tc.expected || cerr.Err.Actual != tc.actual {
+				t.Errorf("expected %#v and %#v but got %#v and %#v", tc.expected, tc.actual, cerr.Err.Expected, cerr.Err.Actual)
+			}
+			if got := cerr.Stack.String(); got != tc.stack {
+				t.Errorf("expected %s but got %s", tc.stack, got)
+			}
+			if got := err.Error(); got != tc.message {
+				t.Errorf("expected %q but got %q", tc.message, got)
+			}
+		})
+	}
+}
+
+func TestCheckDocuments(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   string
+		opts []CheckerOption
+		want []string
+	}{
+		{"single document", "BBubba;~", nil, []string{"[Int, Object]"}},
+		{"empty single document", "", nil, []string{"[]"}},
+		{"multi-document", "BBubba;\n~?;\n", []CheckerOption{WithMultiDocument()}, []string{"[Int]", "[Object, String]"}},
+		{"empty documents", ";;B;;", []CheckerOption{WithMultiDocument()}, []string{"[Int]"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sigs, err := NewChecker(tc.opts...).CheckDocuments(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(sigs))
+			for _, sig := range sigs {
+				got = append(got, sig.String())
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckDocumentsFailsWithPositionInStream(t *testing.T) {
+	_, err := NewChecker(WithMultiDocument()).CheckDocuments(strings.NewReader("BBubba;\nBqu"))
+	if !errors.Is(err, vm.ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch but got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "2:3: ") {
+		t.Errorf("expected the error to tell the position but got %q", err.Error())
+	}
+}
+
+// TestStackAgreesWithVM runs random programs both on a Stack and on a VM, and checks that they fail at the same instructions in the same ways
+// and that the kinds on the stacks are the same.
+func TestStackAgreesWithVM(t *testing.T) {
+	ops := vm.AllOps()
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		s := NewStack(8)
+		m := vm.NewVM(vm.WithStackSize(8))
+		for i := 0; i < 300; i++ {
+			op := ops[r.Intn(len(ops))]
+			err := s.Feed(op)
+			want := m.Feed(op)
+			if (err == nil) != (want == nil) {
+				t.Fatalf("seed %d: %#v: expected %v but got %v", seed, op, want, err)
+			}
+			if want != nil {
+				got, ok := err.(*vm.ExecError)
+				if !ok {
+					t.Fatalf("seed %d: expected *vm.ExecError but got %#v", seed, err)
+				}
+				// Preview is not compared since a Stack has no values.
+				w := want.(*vm.ExecError)
+				if got.Op != w.Op || got.Err != w.Err || got.Expected != w.Expected || got.Actual != w.Actual || got.Depth != w.Depth {
+					t.Fatalf("seed %d: expected %v but got %v", seed, want, got)
+				}
+			}
+			if diff := cmp.Diff(kinds(m), s.Signature()); diff != "" {
+				t.Fatalf("seed %d: mismatch after %d ops (-want +got):\n%s", seed, i+1, diff)
+			}
+		}
+	}
+}
+
+func TestSignatureOfDumpedValueIsItsKind(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		v := typestest.NewGenerator(seed).Value()
+		in, err := dump(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := NewChecker().Check(bytes.NewReader(in))
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		if want := (Signature{v.Kind}); !sig.Equal(want) {
+			t.Errorf("seed %d: expected %s but got %s", seed, want, sig)
+		}
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	for _, sig := range []Signature{
+		{},
+		{types.Object},
+		{types.Int, types.Uint, types.Float, types.String, types.Object, types.Array, types.Bool, types.Nil},
+	} {
+		got, err := ParseSignature(sig.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(sig) {
+			t.Errorf("expected %s but got %s", sig, got)
+		}
+	}
+	got, err := ParseSignature(" [ Int ,Nil ] ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Signature{types.Int, types.Nil}); !got.Equal(want) {
+		t.Errorf("expected %s but got %s", want, got)
+	}
+	for _, s := range []string{"", "Int", "[Int", "[Int,]", "[Integer]"} {
+		_, err := ParseSignature(s)
+		if err == nil {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
+
+func kinds(m *vm.VM) Signature {
+	sig := Signature{}
+	for i := m.Depth() - 1; i >= 0; i-- {
+		v, _ := m.Peek(i)
+		sig = append(sig, v.Kind)
+	}
+	return sig
+}
+
+func dump(v *types.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	u := lexer.NewUnlexer(&buf)
+	err := dumper.NewDumper(u).Dump(v)
+	if err != nil {
+		return nil, err
+	}
+	err = u.Flush()
+	return buf.Bytes(), err
+}
+
+// largeInput returns a program that builds an Array of about n bytes.
+func largeInput(b *testing.B, n int) []byte {
+	obj := types.NewObjectValue(map[string]*types.Value{})
+	obj.Set("name", types.NewStringValue([]byte("Sherlock Holmes")))
+	obj.Set("age", types.NewIntValue(60))
+	obj.Set("tags", types.NewArrayValue([]*types.Value{types.NewBoolValue(true), types.NewNilValue()}))
+	elem, err := dump(obj)
+	if err != nil {
+		b.Fatal(err)
+	}
+	arr := make([]*types.Value, 0, n/len(elem)+1)
+	for i := 0; i < cap(arr); i++ {
+		arr = append(arr, obj)
+	}
+	in, err := dump(types.NewArrayValue(arr))
+	if err != nil {
+		b.Fatal(err)
+	}
+	return in
+}
+
+func BenchmarkCheck(b *testing.B) {
+	in := largeInput(b, 1<<20)
+	b.SetBytes(int64(len(in)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := NewChecker().Check(bytes.NewReader(in))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkExecute is to be compared with BenchmarkCheck.
+func BenchmarkExecute(b *testing.B) {
+	in := largeInput(b, 1<<20)
+	b.SetBytes(int64(len(in)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lex := lexer.NewLexer(bytes.NewReader(in))
+		m := vm.NewVM()
+		for {
+			op, err := lex.NextOp()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+			if err := m.Feed(op); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -556,7 +556,8 @@ func (v *Value) addToMap(obj reflect.Value, path path) error {
 			path: path,
 		}
 	}
-	for k, e := range v.Object {
+	for _, k := range v.OrderedKeys() {
+		e := v.Object[k]
 		key := reflect.ValueOf(k)
 		elem, err := e.cast(elemType, newFieldPath(path, k))
 		if err != nil {
@@ -605,7 +606,8 @@ func (v *Value) castToStruct(t reflect.Type, path path) (reflect.Value, error) {
 	}
 	pobj := reflect.New(t)
 	obj := pobj.Elem()
-	for k, v := range v.Object {
+	for _, k := range v.OrderedKeys() {
+		v := v.Object[k]
 		tag, ok := findField(k, obj)
 		if !ok {
 			continue
@@ -0,0 +1,417 @@
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"sort"
+	"unicode/utf8"
+)
+
+// CompareOption configures how Equal, Compare and Hash regard values.
+type CompareOption interface {
+	apply(*compareConfig)
+}
+
+type compareOption func(*compareConfig)
+
+func (opt compareOption) apply(c *compareConfig) {
+	opt(c)
+}
+
+type compareConfig struct {
+	ieeeNaN bool
+	numeric bool
+	utf8    bool
+}
+
+// WithIEEENaN makes Equal regard NaN as unequal to any value including itself, as IEEE 754 does.
+// Compare and Hash are not affected since Compare needs a total order.
+func WithIEEENaN() CompareOption {
+	return compareOption(func(c *compareConfig) {
+		c.ieeeNaN = true
+	})
+}
+
+// WithNumericEquality makes Ints, Uints and Floats compared by their numeric values regardless of their kinds,
+// e.g. `Int 1`, `Uint 1` and `Float 1.0` are equal to each other.
+func WithNumericEquality() CompareOption {
+	return compareOption(func(c *compareConfig) {
+		c.numeric = true
+	})
+}
+
+// WithUTF8Strings makes Strings compared as sequences of Unicode code points, where each invalid UTF-8 byte is regarded as U+FFFD.
+// Keys of Objects are still compared byte by byte.
+func WithUTF8Strings() CompareOption {
+	return compareOption(func(c *compareConfig) {
+		c.utf8 = true
+	})
+}
+
+func newCompareConfig(opts []CompareOption) *compareConfig {
+	c := &compareConfig{}
+	for _, opt := range opts {
+		opt.apply(c)
+	}
+	return c
+}
+
+// Equal reports whether v and other have the same contents.
+// Objects are equal if they have the same set of keys and values, regardless of the order in which the keys were added.
+//
+// By default, values of different kinds are never equal, NaN is equal to NaN, and 0.0 is equal to -0.0.
+func (v *Value) Equal(other *Value, opts ...CompareOption) bool {
+	c := newCompareConfig(opts)
+	if c.ieeeNaN && (containsNaN(v) || containsNaN(other)) {
+		return false
+	}
+	return c.compare(v, other) == 0
+}
+
+// Compare returns an integer comparing v and other in a total order.
+// The result will be 0 if v is equal to other in the sense of Equal, -1 if v < other, and +1 if v > other.
+//
+// Values of different kinds are ordered by their kinds, i.e. Int < Uint < Float < String < Object < Array < Bool < Nil.
+// All numbers are regarded as Ints in this order if WithNumericEquality is given.
+// NaN is less than any other Float and -0.0 is equal to 0.0.
+// Strings and Arrays are ordered lexicographically, and false is less than true.
+// Objects are ordered lexicographically as sequences of key-value pairs sorted by their keys.
+func (v *Value) Compare(other *Value, opts ...CompareOption) int {
+	return newCompareConfig(opts).compare(v, other)
+}
+
+// Hash returns a hash of the contents of v. Values that are equal in the sense of Equal with the same options have the same hash.
+// The hash is stable, i.e. it does not change between processes nor versions.
+func (v *Value) Hash(opts ...CompareOption) uint64 {
+	h := fnv.New64a()
+	newCompareConfig(opts).hash(h, v)
+	return h.Sum64()
+}
+
+func (c *compareConfig) compare(a, b *Value) int {
+	ra, rb := c.rank(a.Kind), c.rank(b.Kind)
+	if ra != rb {
+		return compareInts(int64(ra), int64(rb))
+	}
+	if c.numeric && isNumber(a.Kind) {
+		return compareNumbers(a, b)
+	}
+	switch a.Kind {
+	case Int:
+		return compareInts(a.Int, b.Int)
+	case Uint:
+		return compareUints(a.Uint, b.Uint)
+	case Float:
+		return compareFloats(a.Float, b.Float)
+	case String:
+		if c.utf8 {
+			return compareUTF8(a.String, b.String)
+		}
+		return bytes.Compare(a.String, b.String)
+	case Object:
+		return c.compareObjects(a, b)
+	case Array:
+		return c.compareArrays(a.Array, b.Array)
+	case Bool:
+		return compareBools(a.Bool, b.Bool)
+	case Nil:
+		return 0
+	default:
+		panic(fmt.Errorf("invalid kind: %d", a.Kind))
+	}
+}
+
+// rank returns the position of k in the order of kinds.
+func (c *compareConfig) rank(k Kind) Kind {
+	if c.numeric && isNumber(k) {
+		return Int
+	}
+	return k
+}
+
+func (c *compareConfig) compareObjects(a, b *Value) int {
+	ka, kb := sortedKeys(a), sortedKeys(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if ka[i] != kb[i] {
+			if ka[i] < kb[i] {
+				return -1
+			}
+			return 1
+		}
+		if r := c.compare(a.Object[ka[i]], b.Object[kb[i]]); r != 0 {
+			return r
+		}
+	}
+	return compareInts(int64(len(ka)), int64(len(kb)))
+}
+
+func (c *compareConfig) compareArrays(a, b []*Value) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if r := c.compare(a[i], b[i]); r != 0 {
+			return r
+		}
+	}
+	return compareInts(int64(len(a)), int64(len(b)))
+}
+
+func compareInts(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareUints(a, b uint64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	an, bn := math.IsNaN(a), math.IsNaN(b)
+	if an || bn {
+		return compareBools(!an, !bn)
+	}
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func compareBools(a, b bool) int {
+	if a == b {
+		return 0
+	} else if b {
+		return -1
+	}
+	return 1
+}
+
+func compareUTF8(a, b []byte) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRune(a)
+		rb, nb := utf8.DecodeRune(b)
+		if ra != rb {
+			return compareInts(int64(ra), int64(rb))
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return compareInts(int64(len(a)), int64(len(b)))
+}
+
+// compareNumbers compares two numbers of any kinds exactly.
+func compareNumbers(a, b *Value) int {
+	switch {
+	case a.Kind == Float && b.Kind == Float:
+		return compareFloats(a.Float, b.Float)
+	case a.Kind == Float:
+		return compareFloatWithInteger(a.Float, b)
+	case b.Kind == Float:
+		return -compareFloatWithInteger(b.Float, a)
+	case a.Kind == Int && b.Kind == Int:
+		return compareInts(a.Int, b.Int)
+	case a.Kind == Uint && b.Kind == Uint:
+		return compareUints(a.Uint, b.Uint)
+	case a.Kind == Int:
+		return compareIntWithUint(a.Int, b.Uint)
+	default:
+		return -compareIntWithUint(b.Int, a.Uint)
+	}
+}
+
+func compareIntWithUint(a int64, b uint64) int {
+	if a < 0 {
+		return -1
+	}
+	return compareUints(uint64(a), b)
+}
+
+const (
+	twoTo63 = float64(1 << 63)
+	twoTo64 = twoTo63 * 2
+)
+
+// compareFloatWithInteger compares x with an Int or a Uint.
+func compareFloatWithInteger(x float64, n *Value) int {
+	if math.IsNaN(x) {
+		return -1
+	}
+	t := math.Trunc(x)
+	frac := compareFloats(x, t)
+	if n.Kind == Int {
+		if x < -twoTo63 {
+			return -1
+		} else if x >= twoTo63 {
+			return 1
+		}
+		if r := compareInts(int64(t), n.Int); r != 0 {
+			return r
+		}
+		return frac
+	}
+	if x < 0 {
+		return -1
+	} else if x >= twoTo64 {
+		return 1
+	}
+	if r := compareUints(uint64(t), n.Uint); r != 0 {
+		return r
+	}
+	return frac
+}
+
+// Tags that are written to hashes before values.
+const (
+	hashInt byte = iota
+	hashUint
+	hashFloat
+	hashString
+	hashObject
+	hashArray
+	hashBool
+	hashNil
+	hashInteger // an integer of any kind, used with WithNumericEquality
+)
+
+func (c *compareConfig) hash(h hash.Hash64, v *Value) {
+	switch v.Kind {
+	case Int:
+		if c.numeric && v.Int < 0 {
+			writeHashInteger(h, true, -uint64(v.Int))
+		} else if c.numeric {
+			writeHashInteger(h, false, uint64(v.Int))
+		} else {
+			writeHashUint(h, hashInt, uint64(v.Int))
+		}
+	case Uint:
+		if c.numeric {
+			writeHashInteger(h, false, v.Uint)
+		} else {
+			writeHashUint(h, hashUint, v.Uint)
+		}
+	case Float:
+		c.hashFloat(h, v.Float)
+	case String:
+		s := v.String
+		if c.utf8 {
+			s = normalizeUTF8(s)
+		}
+		writeHashBytes(h, hashString, s)
+	case Object:
+		keys := sortedKeys(v)
+		writeHashUint(h, hashObject, uint64(len(keys)))
+		for _, k := range keys {
+			writeHashBytes(h, hashString, []byte(k))
+			c.hash(h, v.Object[k])
+		}
+	case Array:
+		writeHashUint(h, hashArray, uint64(len(v.Array)))
+		for _, elem := range v.Array {
+			c.hash(h, elem)
+		}
+	case Bool:
+		b := uint64(0)
+		if v.Bool {
+			b = 1
+		}
+		writeHashUint(h, hashBool, b)
+	case Nil:
+		h.Write([]byte{hashNil})
+	default:
+		panic(fmt.Errorf("invalid kind: %d", v.Kind))
+	}
+}
+
+func (c *compareConfig) hashFloat(h hash.Hash64, x float64) {
+	if c.numeric && x == math.Trunc(x) && -twoTo63 <= x && x < twoTo64 {
+		if x < 0 {
+			writeHashInteger(h, true, -uint64(int64(x)))
+		} else {
+			writeHashInteger(h, false, uint64(x))
+		}
+		return
+	}
+	if math.IsNaN(x) {
+		x = math.NaN()
+	} else if x == 0 {
+		x = 0 // -0.0 is equal to 0.0
+	}
+	writeHashUint(h, hashFloat, math.Float64bits(x))
+}
+
+// writeHashInteger writes an integer of any kind. The integer is -abs if neg is true, or abs otherwise.
+func writeHashInteger(h hash.Hash64, neg bool, abs uint64) {
+	writeHashUint(h, hashInteger, abs)
+	if neg && abs != 0 {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+}
+
+func writeHashUint(h hash.Hash64, tag byte, n uint64) {
+	var b [9]byte
+	b[0] = tag
+	binary.BigEndian.PutUint64(b[1:], n)
+	h.Write(b[:])
+}
+
+func writeHashBytes(h hash.Hash64, tag byte, s []byte) {
+	writeHashUint(h, tag, uint64(len(s)))
+	h.Write(s)
+}
+
+// normalizeUTF8 replaces each invalid UTF-8 byte in s with U+FFFD.
+func normalizeUTF8(s []byte) []byte {
+	buf := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		r, n := utf8.DecodeRune(s)
+		buf = append(buf, string(r)...)
+		s = s[n:]
+	}
+	return buf
+}
+
+func sortedKeys(v *Value) []string {
+	keys := make([]string, 0, len(v.Object))
+	for k := range v.Object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func isNumber(k Kind) bool {
+	return k == Int || k == Uint || k == Float
+}
+
+func containsNaN(v *Value) bool {
+	switch v.Kind {
+	case Float:
+		return math.IsNaN(v.Float)
+	case Object:
+		for _, elem := range v.Object {
+			if containsNaN(elem) {
+				return true
+			}
+		}
+	case Array:
+		for _, elem := range v.Array {
+			if containsNaN(elem) {
+				return true
+			}
+		}
+	}
+	return false
+}
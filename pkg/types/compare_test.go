@@ -0,0 +1,170 @@
+package types_test
+
+import (
+	"math"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestEqual(t *testing.T) {
+	nan := types.NewFloatValue(math.NaN())
+	obj := func(kvs ...interface{}) *types.Value {
+		v := types.NewObjectValue(map[string]*types.Value{})
+		for i := 0; i < len(kvs); i += 2 {
+			v.Set(kvs[i].(string), kvs[i+1].(*types.Value))
+		}
+		return v
+	}
+	for _, tc := range []struct {
+		name string
+		a, b *types.Value
+		opts []types.CompareOption
+		want bool
+	}{
+		{"same ints", types.NewIntValue(1), types.NewIntValue(1), nil, true},
+		{"different ints", types.NewIntValue(1), types.NewIntValue(2), nil, false},
+		{"int and uint", types.NewIntValue(1), types.NewUintValue(1), nil, false},
+		{"int and uint with numeric equality", types.NewIntValue(1), types.NewUintValue(1), []types.CompareOption{types.WithNumericEquality()}, true},
+		{"int and float with numeric equality", types.NewIntValue(-3), types.NewFloatValue(-3), []types.CompareOption{types.WithNumericEquality()}, true},
+		{"int and fraction with numeric equality", types.NewIntValue(1), types.NewFloatValue(1.5), []types.CompareOption{types.WithNumericEquality()}, false},
+		{"max uint and float", types.NewUintValue(math.MaxUint64), types.NewFloatValue(math.MaxUint64), []types.CompareOption{types.WithNumericEquality()}, false},
+		{"negative int and uint", types.NewIntValue(-1), types.NewUintValue(math.MaxUint64), []types.CompareOption{types.WithNumericEquality()}, false},
+		{"NaN", nan, nan, nil, true},
+		{"NaN with IEEE semantics", nan, nan, []types.CompareOption{types.WithIEEENaN()}, false},
+		{"nested NaN with IEEE semantics", types.NewArrayValue([]*types.Value{nan}), types.NewArrayValue([]*types.Value{nan}), []types.CompareOption{types.WithIEEENaN()}, false},
+		{"zero and negative zero", types.NewFloatValue(0), types.NewFloatValue(math.Copysign(0, -1)), nil, true},
+		{"invalid UTF-8", types.NewStringValue([]byte("\xff")), types.NewStringValue([]byte("\xfe")), nil, false},
+		{"invalid UTF-8 as UTF-8", types.NewStringValue([]byte("a\xff")), types.NewStringValue([]byte("a�")), []types.CompareOption{types.WithUTF8Strings()}, true},
+		{"keys in different order", obj("a", nan, "b", types.NewNilValue()), obj("b", types.NewNilValue(), "a", nan), nil, true},
+		{"different keys", obj("a", types.NewNilValue()), obj("b", types.NewNilValue()), nil, false},
+		{"arrays", types.NewArrayValue([]*types.Value{types.NewBoolValue(true)}), types.NewArrayValue([]*types.Value{types.NewBoolValue(true)}), nil, true},
+		{"arrays of different lengths", types.NewArrayValue([]*types.Value{}), types.NewArrayValue([]*types.Value{types.NewNilValue()}), nil, false},
+	} {
+		if got := tc.a.Equal(tc.b, tc.opts...); got != tc.want {
+			t.Errorf("%s: expected %t but got %t", tc.name, tc.want, got)
+		}
+		if got := tc.b.Equal(tc.a, tc.opts...); got != tc.want {
+			t.Errorf("%s (reversed): expected %t but got %t", tc.name, tc.want, got)
+		}
+		if tc.want && tc.a.Hash(tc.opts...) != tc.b.Hash(tc.opts...) {
+			t.Errorf("%s: expected the same hashes", tc.name)
+		}
+	}
+}
+
+func TestCompareSortsValuesInTotalOrder(t *testing.T) {
+	want := []*types.Value{
+		types.NewIntValue(math.MinInt64),
+		types.NewIntValue(0),
+		types.NewUintValue(0),
+		types.NewUintValue(math.MaxUint64),
+		types.NewFloatValue(math.NaN()),
+		types.NewFloatValue(math.Inf(-1)),
+		types.NewFloatValue(0.5),
+		types.NewStringValue([]byte("")),
+		types.NewStringValue([]byte("a")),
+		types.NewStringValue([]byte("ab")),
+		types.NewStringValue([]byte("b")),
+		types.NewObjectValue(map[string]*types.Value{}),
+		types.NewObjectValue(map[string]*types.Value{"a": types.NewIntValue(1)}),
+		types.NewObjectValue(map[string]*types.Value{"a": types.NewIntValue(2)}),
+		types.NewObjectValue(map[string]*types.Value{"b": types.NewIntValue(0)}),
+		types.NewArrayValue([]*types.Value{}),
+		types.NewArrayValue([]*types.Value{types.NewIntValue(1)}),
+		types.NewBoolValue(false),
+		types.NewBoolValue(true),
+		types.NewNilValue(),
+	}
+	got := make([]*types.Value, len(want))
+	for i := range want {
+		got[i] = want[len(want)-1-i]
+	}
+	sort.SliceStable(got, func(i, j int) bool { return got[i].Compare(got[j]) < 0 })
+	for i := range want {
+		if want[i] != got[i] {
+			t.Errorf("expected %#v at %d but got %#v", want[i], i, got[i])
+		}
+	}
+}
+
+func TestCompareWithNumericEqualityOrdersNumbersByValue(t *testing.T) {
+	want := []*types.Value{
+		types.NewFloatValue(math.NaN()),
+		types.NewFloatValue(math.Inf(-1)),
+		types.NewIntValue(math.MinInt64),
+		types.NewFloatValue(-1.5),
+		types.NewIntValue(-1),
+		types.NewFloatValue(-0.5),
+		types.NewUintValue(0),
+		types.NewFloatValue(0.5),
+		types.NewIntValue(math.MaxInt64),
+		types.NewFloatValue(1 << 63),
+		types.NewUintValue(math.MaxUint64),
+		types.NewFloatValue(1 << 64),
+		types.NewStringValue([]byte("")),
+	}
+	opt := types.WithNumericEquality()
+	for i := range want {
+		for j := range want {
+			if got, exp := want[i].Compare(want[j], opt), compareInts(i, j); got != exp {
+				t.Errorf("expected %d when comparing %#v with %#v but got %d", exp, want[i], want[j], got)
+			}
+		}
+	}
+}
+
+func TestCompareAndHashAreConsistentWithEqual(t *testing.T) {
+	for _, opts := range [][]types.CompareOption{
+		nil,
+		{types.WithNumericEquality()},
+		{types.WithUTF8Strings()},
+	} {
+		values := make([]*types.Value, 0, 200)
+		for seed := int64(0); seed < 100; seed++ {
+			g := typestest.NewGenerator(seed, typestest.WithMaxDepth(2), typestest.WithMaxLength(2))
+			values = append(values, g.Value(), g.Value())
+		}
+		for _, a := range values {
+			if a.Compare(a.DeepCopy(), opts...) != 0 || a.Hash(opts...) != a.DeepCopy().Hash(opts...) {
+				t.Errorf("expected %#v to be equal to its copy", a)
+			}
+			for _, b := range values {
+				ab, ba := a.Compare(b, opts...), b.Compare(a, opts...)
+				if ab != -ba {
+					t.Errorf("expected Compare to be antisymmetric: %#v, %#v", a, b)
+				}
+				if a.Equal(b, opts...) != (ab == 0) {
+					t.Errorf("expected Equal to be consistent with Compare: %#v, %#v", a, b)
+				}
+				if ab == 0 && a.Hash(opts...) != b.Hash(opts...) {
+					t.Errorf("expected equal values to have the same hashes: %#v, %#v", a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestHashIsStable(t *testing.T) {
+	v := types.NewObjectValue(map[string]*types.Value{
+		"a": types.NewArrayValue([]*types.Value{types.NewIntValue(1), types.NewStringValue([]byte("x"))}),
+		"b": types.NewNilValue(),
+	})
+	// The hash must not change between versions, since it may be persisted.
+	if diff := cmp.Diff(uint64(3166808491027642663), v.Hash()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
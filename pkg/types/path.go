@@ -48,3 +48,36 @@ func newIndexPath(parent path, idx int) path {
 func (p *indexPath) string() string {
 	return fmt.Sprintf("%s[%d]", p.parent.string(), p.idx)
 }
+
+// Path is a location of a value in another value, such as `<root>.name[1]`.
+type Path struct {
+	p path
+}
+
+// RootPath returns the Path of the outermost value.
+func RootPath() Path {
+	return Path{p: newRootPath()}
+}
+
+// Field returns the Path of the value of the given key in the Object at p.
+func (p Path) Field(field string) Path {
+	return Path{p: newFieldPath(p.path(), field)}
+}
+
+// Index returns the Path of the idx-th element of the Array at p.
+func (p Path) Index(idx int) Path {
+	return Path{p: newIndexPath(p.path(), idx)}
+}
+
+// String returns a string representation of p, e.g. `<root>.name[1]`.
+func (p Path) String() string {
+	return p.path().string()
+}
+
+// path returns the underlying path. The zero value of Path is regarded as the root.
+func (p Path) path() path {
+	if p.p == nil {
+		return newRootPath()
+	}
+	return p.p
+}
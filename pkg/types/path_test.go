@@ -30,3 +30,19 @@ func TestIndexPath(t *testing.T) {
 		t.Errorf("expected %#v but got %#v", expected, actual)
 	}
 }
+
+func TestExportedPath(t *testing.T) {
+	expected := "<root>.TheField[1]"
+	actual := RootPath().Field("TheField").Index(1).String()
+	if expected != actual {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+}
+
+func TestZeroPathIsRoot(t *testing.T) {
+	expected := "<root>.TheField"
+	actual := Path{}.Field("TheField").String()
+	if expected != actual {
+		t.Errorf("expected %#v but got %#v", expected, actual)
+	}
+}
@@ -157,15 +157,16 @@ func ptrToValueByReflection(v reflect.Value) (*Value, error) {
 }
 
 func structToValueByReflection(v reflect.Value) (*Value, error) {
-	obj := map[string]*Value{}
+	obj := NewObjectValue(map[string]*Value{})
 	err := addFields(obj, v)
 	if err != nil {
 		return nil, err
 	}
-	return NewObjectValue(obj), nil
+	return obj, nil
 }
 
-func addFields(obj map[string]*Value, v reflect.Value) error {
+// addFields adds the fields of v to obj in the order they are declared.
+func addFields(obj *Value, v reflect.Value) error {
 	size := v.NumField()
 	t := v.Type()
 	for i := 0; i < size; i++ {
@@ -189,13 +190,13 @@ func addFields(obj map[string]*Value, v reflect.Value) error {
 			if err != nil {
 				return err
 			}
-			obj[name] = elemVal
+			obj.Set(name, elemVal)
 		} else {
 			elemVal, err := ToValueByReflection(elem)
 			if err != nil {
 				return err
 			}
-			obj[name] = elemVal
+			obj.Set(name, elemVal)
 		}
 	}
 	return nil
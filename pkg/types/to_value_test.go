@@ -8,6 +8,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
 )
 
 func TestToValueConvertsNilInterface(t *testing.T) {
@@ -16,7 +17,7 @@ func TestToValueConvertsNilInterface(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -28,7 +29,7 @@ func TestToValueConvertsNilPointer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -40,7 +41,7 @@ func TestToValueConvertsNilSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -52,7 +53,7 @@ func TestToValueConvertsNilMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -63,7 +64,7 @@ func TestToValueConvertsTrue(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -74,7 +75,7 @@ func TestToValueConvertsFalse(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -85,7 +86,7 @@ func TestToValueConvertsInt(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -96,7 +97,7 @@ func TestToValueConvertsInt8(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -107,7 +108,7 @@ func TestToValueConvertsInt16(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -118,7 +119,7 @@ func TestToValueConvertsInt32(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -129,7 +130,7 @@ func TestToValueConvertsInt64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -140,7 +141,7 @@ func TestToValueConvertsUint(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -151,7 +152,7 @@ func TestToValueConvertsUint8(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -162,7 +163,7 @@ func TestToValueConvertsUint16(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -173,7 +174,7 @@ func TestToValueConvertsUint32(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -184,7 +185,7 @@ func TestToValueConvertsUint64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -195,7 +196,7 @@ func TestToValueConvertsString(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -220,7 +221,7 @@ func TestToValueConvertsFloat64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -233,7 +234,7 @@ func TestToValueConvertsMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -260,7 +261,7 @@ func TestToValueConvertsHeteroMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -273,7 +274,7 @@ func TestToValueConvertsMapWhoseKeyCanBeConvertedToString(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -286,7 +287,7 @@ func TestToValueConvertsSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -313,7 +314,7 @@ func TestToValueConvertsHeteroSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -326,7 +327,7 @@ func TestToValueConvertsArray(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -353,7 +354,7 @@ func TestToValueConvertsHeteroArray(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -365,16 +366,16 @@ func TestToValueConvertsPtr(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
 
 func TestToValueConvertsUntaggedStruct(t *testing.T) {
-	want := types.NewObjectValue(map[string]*types.Value{
-		"name":     types.NewStringValue([]byte("hoge")),
-		"longname": types.NewStringValue([]byte("longhoge")),
-	})
+	// in field order
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("name", types.NewStringValue([]byte("hoge")))
+	want.Set("longname", types.NewStringValue([]byte("longhoge")))
 	got, err := types.ToValue(&untagged{
 		Name:     "hoge",
 		LongName: "longhoge",
@@ -382,7 +383,7 @@ func TestToValueConvertsUntaggedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -401,18 +402,18 @@ func TestToValueConvertsNestedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
 
 func TestToValueConvertsEmbeddedStruct(t *testing.T) {
-	want := types.NewObjectValue(map[string]*types.Value{
-		"field": types.NewIntValue(123),
-		"embeddedinner": types.NewObjectValue(map[string]*types.Value{
-			"anotherfield": types.NewIntValue(456),
-		}),
-	})
+	// in field order
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("field", types.NewIntValue(123))
+	want.Set("embeddedinner", types.NewObjectValue(map[string]*types.Value{
+		"anotherfield": types.NewIntValue(456),
+	}))
 	value := &embedded{
 		Field: 123,
 	}
@@ -421,7 +422,7 @@ func TestToValueConvertsEmbeddedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -436,7 +437,7 @@ func TestToValueConvertsTaggedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -452,7 +453,7 @@ func TestToValueOmitsPrivateField(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -469,7 +470,7 @@ func TestToValueOmitsEmptyFieldTaggedWithOmitempty(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -485,7 +486,7 @@ func TestToValueOmitsFieldTaggedWithHyphen(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -504,7 +505,7 @@ func TestToValueEnbedsFieldTaggedWithInline(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -521,7 +522,7 @@ func TestToValueUsesMarshalWatsonWhenArgImplementsMarshaler(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -536,7 +537,7 @@ func TestToValueUsesMarshalWatsonWhenArgImplementsMarshalerEvenIfNotStruct(t *te
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -548,7 +549,7 @@ func TestToValueByReflectionConvertsNilPointer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -560,7 +561,7 @@ func TestToValueByReflectionConvertsNilSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -572,7 +573,7 @@ func TestToValueByReflectionConvertsNilMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -583,7 +584,7 @@ func TestToValueByReflectionConvertsTrue(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -594,7 +595,7 @@ func TestToValueByReflectionConvertsFalse(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -605,7 +606,7 @@ func TestToValueByReflectionConvertsInt(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -616,7 +617,7 @@ func TestToValueByReflectionConvertsInt8(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -627,7 +628,7 @@ func TestToValueByReflectionConvertsInt16(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -638,7 +639,7 @@ func TestToValueByReflectionConvertsInt32(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -649,7 +650,7 @@ func TestToValueByReflectionConvertsInt64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -660,7 +661,7 @@ func TestToValueByReflectionConvertsUint(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -671,7 +672,7 @@ func TestToValueByReflectionConvertsUint8(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -682,7 +683,7 @@ func TestToValueByReflectionConvertsUint16(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -693,7 +694,7 @@ func TestToValueByReflectionConvertsUint32(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -704,7 +705,7 @@ func TestToValueByReflectionConvertsUint64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -715,7 +716,7 @@ func TestToValueByReflectionConvertsString(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -740,7 +741,7 @@ func TestToValueByReflectionConvertsFloat64(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -753,7 +754,7 @@ func TestToValueByReflectionConvertsMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -780,7 +781,7 @@ func TestToValueByReflectionConvertsHeteroMap(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -793,7 +794,7 @@ func TestToValueByReflectionConvertsMapWhoseKeyCanBeConvertedToString(t *testing
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -806,7 +807,7 @@ func TestToValueByReflectionConvertsSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -833,7 +834,7 @@ func TestToValueByReflectionConvertsHeteroSlice(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -846,7 +847,7 @@ func TestToValueByReflectionConvertsArray(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -873,7 +874,7 @@ func TestToValueByReflectionConvertsHeteroArray(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -885,16 +886,16 @@ func TestToValueByReflectionConvertsPtr(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
 
 func TestToValueByReflectionConvertsUntaggedStruct(t *testing.T) {
-	want := types.NewObjectValue(map[string]*types.Value{
-		"name":     types.NewStringValue([]byte("hoge")),
-		"longname": types.NewStringValue([]byte("longhoge")),
-	})
+	// in field order
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("name", types.NewStringValue([]byte("hoge")))
+	want.Set("longname", types.NewStringValue([]byte("longhoge")))
 	got, err := types.ToValueByReflection(reflect.ValueOf(&untagged{
 		Name:     "hoge",
 		LongName: "longhoge",
@@ -902,7 +903,7 @@ func TestToValueByReflectionConvertsUntaggedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -921,18 +922,18 @@ func TestToValueByReflectionConvertsNestedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
 
 func TestToValueByReflectionConvertsEmbeddedStruct(t *testing.T) {
-	want := types.NewObjectValue(map[string]*types.Value{
-		"field": types.NewIntValue(123),
-		"embeddedinner": types.NewObjectValue(map[string]*types.Value{
-			"anotherfield": types.NewIntValue(456),
-		}),
-	})
+	// in field order
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("field", types.NewIntValue(123))
+	want.Set("embeddedinner", types.NewObjectValue(map[string]*types.Value{
+		"anotherfield": types.NewIntValue(456),
+	}))
 	value := &embedded{
 		Field: 123,
 	}
@@ -941,7 +942,7 @@ func TestToValueByReflectionConvertsEmbeddedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -956,7 +957,7 @@ func TestToValueByReflectionConvertsTaggedStruct(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -972,7 +973,7 @@ func TestToValueByReflectionOmitsPrivateField(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -989,7 +990,7 @@ func TestToValueByReflectionOmitsEmptyFieldTaggedWithOmitempty(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1005,7 +1006,7 @@ func TestToValueByReflectionOmitsFieldTaggedWithHyphen(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1024,7 +1025,7 @@ func TestToValueByReflectionEnbedsFieldTaggedWithInline(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1041,7 +1042,7 @@ func TestToValueByReflectionUsesMarshalWatsonWhenArgImplementsMarshaler(t *testi
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1056,7 +1057,7 @@ func TestToValueByRelectionUsesMarshalWatsonWhenArgImplementsMarshalerEvenIfNotS
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
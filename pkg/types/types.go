@@ -4,6 +4,7 @@ package types
 import (
 	"fmt"
 	"math"
+	"sort"
 )
 
 // Value is an arbitrary value that can be represented as Watson.
@@ -16,6 +17,7 @@ type Value struct {
 	Object map[string]*Value
 	Array  []*Value
 	Bool   bool
+	keys   []string // the keys of Object in the order they were added; use Set and OrderedKeys to access them
 }
 
 // NewIntValue creates a new Value that contains an integer.
@@ -39,8 +41,14 @@ func NewStringValue(val []byte) *Value {
 }
 
 // NewObjectValue creates a new Value that contains an object.
+// Since val has no order, its keys are regarded as if they were added in ascending order.
 func NewObjectValue(val map[string]*Value) *Value {
-	return &Value{Kind: Object, Object: val}
+	keys := make([]string, 0, len(val))
+	for k := range val {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return &Value{Kind: Object, Object: val, keys: keys}
 }
 
 // NewArrayValue creates a new value that contains an array.
@@ -63,6 +71,60 @@ func (v *Value) IsNaN() bool {
 	return v.Kind == Float && math.IsNaN(v.Float)
 }
 
+// Set sets val to v.Object[key].
+// If v does not have the key yet, the key is added to the last. Otherwise its position remains unchanged.
+//
+// A key that is deleted from v.Object directly is added to the last as well when it is set again.
+func (v *Value) Set(key string, val *Value) {
+	if v.Object == nil {
+		v.Object = map[string]*Value{}
+	}
+	if _, ok := v.Object[key]; !ok {
+		if len(v.keys) != len(v.Object) {
+			// v.Object has been modified directly.
+			v.keys = v.OrderedKeys()
+		}
+		v.keys = append(v.keys, key)
+	}
+	v.Object[key] = val
+}
+
+// OrderedKeys returns the keys of v.Object in the order they were added.
+//
+// Keys that are added by modifying v.Object directly come last in ascending order.
+func (v *Value) OrderedKeys() []string {
+	keys, seen := v.listedKeys()
+	if len(keys) == len(v.Object) {
+		return keys
+	}
+	rest := make([]string, 0, len(v.Object)-len(keys))
+	for k := range v.Object {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// listedKeys returns the keys that are both in v.Object and in v.keys in the order of v.keys, and the set of them.
+// If a key appears in v.keys more than once, which can happen when it is deleted from v.Object directly and then set again, the last one is used.
+func (v *Value) listedKeys() ([]string, map[string]bool) {
+	keys := make([]string, 0, len(v.Object))
+	seen := make(map[string]bool, len(v.Object))
+	for i := len(v.keys) - 1; i >= 0; i-- {
+		k := v.keys[i]
+		if _, ok := v.Object[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
+	return keys, seen
+}
+
 // DeepCopy returns a deep copy of v.
 func (v *Value) DeepCopy() *Value {
 	clone := &Value{Kind: v.Kind}
@@ -81,6 +143,10 @@ func (v *Value) DeepCopy() *Value {
 		for k, v := range v.Object {
 			clone.Object[k] = v.DeepCopy()
 		}
+		if v.keys != nil {
+			clone.keys = make([]string, len(v.keys))
+			copy(clone.keys, v.keys)
+		}
 	case Array:
 		clone.Array = make([]*Value, 0, len(v.Array))
 		for _, v := range v.Array {
@@ -7,10 +7,13 @@ import (
 	"github.com/google/go-cmp/cmp"
 )
 
+// cmpOption is the same as typestest.CmpOption, which can not be imported from this package.
+var cmpOption = cmp.AllowUnexported(Value{})
+
 func TestDeepCopyWithInt(t *testing.T) {
 	orig := NewIntValue(123)
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -23,7 +26,7 @@ func TestDeepCopyWithInt(t *testing.T) {
 func TestDeepCopyWithUint(t *testing.T) {
 	orig := NewUintValue(123)
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -36,7 +39,7 @@ func TestDeepCopyWithUint(t *testing.T) {
 func TestDeepCopyWithFloat(t *testing.T) {
 	orig := NewFloatValue(1.23)
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -49,7 +52,7 @@ func TestDeepCopyWithFloat(t *testing.T) {
 func TestDeepCopyString(t *testing.T) {
 	orig := NewStringValue([]byte("hello"))
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -69,47 +72,63 @@ func TestDeepCopyWithObject(t *testing.T) {
 		"hello": NewStringValue([]byte("world")),
 	})
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
 	clone.Object["hello"].String[0] = 0x61 // 'a'
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("clone shares the same reference with its origin")
 	}
 
 	clone.Object["hoge"] = NewStringValue([]byte("fuga"))
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("clone shares the same reference with its origin")
 	}
 
 	clone.Object = map[string]*Value{}
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("DeepCopy returned receiver itself")
 	}
 }
 
+func TestDeepCopyWithObjectCopiesKeys(t *testing.T) {
+	orig := NewObjectValue(map[string]*Value{})
+	orig.Set("b", NewIntValue(1))
+	orig.Set("a", NewIntValue(2))
+	clone := orig.DeepCopy()
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	clone.Set("c", NewIntValue(3))
+	want := []string{"b", "a"}
+	if diff := cmp.Diff(want, orig.OrderedKeys()); diff != "" {
+		t.Errorf("clone shares the same keys with its origin (-want +got):\n%s", diff)
+	}
+}
+
 func TestDeepCopyWithArray(t *testing.T) {
 	orig := NewArrayValue([]*Value{
 		NewStringValue([]byte("shark")),
 	})
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
 	clone.Array[0].String = []byte("shrimp")
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("clone shares the same reference with its origin")
 	}
 
 	clone.Array[0] = NewStringValue([]byte("tako"))
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("clone shares the same reference with its origin")
 	}
 
 	clone.Array = []*Value{}
-	if diff := cmp.Diff(orig, clone); diff == "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff == "" {
 		t.Errorf("DeepCopy returned receiver itself")
 	}
 }
@@ -117,7 +136,7 @@ func TestDeepCopyWithArray(t *testing.T) {
 func TestDeepCopyWithBool(t *testing.T) {
 	orig := NewBoolValue(true)
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -130,7 +149,7 @@ func TestDeepCopyWithBool(t *testing.T) {
 func TestDeepCopyWithNil(t *testing.T) {
 	orig := NewNilValue()
 	clone := orig.DeepCopy()
-	if diff := cmp.Diff(orig, clone); diff != "" {
+	if diff := cmp.Diff(orig, clone, cmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
@@ -139,3 +158,78 @@ func TestDeepCopyWithNil(t *testing.T) {
 		t.Errorf("DeepCopy returned receiver itself")
 	}
 }
+
+func TestNewObjectValueSortsKeys(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{
+		"b": NewIntValue(1),
+		"c": NewIntValue(2),
+		"a": NewIntValue(3),
+	})
+	want := []string{"a", "b", "c"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetAppendsNewKeys(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{})
+	v.Set("b", NewIntValue(1))
+	v.Set("a", NewIntValue(2))
+	want := []string{"b", "a"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetKeepsThePositionOfExistingKeys(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{})
+	v.Set("b", NewIntValue(1))
+	v.Set("a", NewIntValue(2))
+	v.Set("b", NewIntValue(3))
+	want := []string{"b", "a"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if v.Object["b"].Int != 3 {
+		t.Errorf("expected %d but got %d", 3, v.Object["b"].Int)
+	}
+}
+
+func TestOrderedKeysPutsUnorderedKeysLast(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{})
+	v.Set("b", NewIntValue(1))
+	v.Object["z"] = NewIntValue(2)
+	v.Object["y"] = NewIntValue(3)
+	want := []string{"b", "y", "z"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestOrderedKeysIgnoresDeletedKeys(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{})
+	v.Set("b", NewIntValue(1))
+	v.Set("a", NewIntValue(2))
+	delete(v.Object, "b")
+	want := []string{"a"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSetAppendsKeysDeletedDirectly(t *testing.T) {
+	v := NewObjectValue(map[string]*Value{})
+	v.Set("b", NewIntValue(1))
+	v.Set("a", NewIntValue(2))
+	for i := 0; i < 100; i++ {
+		delete(v.Object, "b")
+		v.Set("b", NewIntValue(3))
+	}
+	want := []string{"a", "b"}
+	if diff := cmp.Diff(want, v.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if len(v.keys) != len(v.Object) {
+		t.Errorf("expected deleted keys to be forgotten but got %v", v.keys)
+	}
+}
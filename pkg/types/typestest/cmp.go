@@ -0,0 +1,11 @@
+package typestest
+
+import (
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+// CmpOption makes `cmp.Diff` and `cmp.Equal` compare Values including the order of keys of Objects,
+// which Values keep in an unexported field.
+var CmpOption = cmp.AllowUnexported(types.Value{})
@@ -0,0 +1,223 @@
+// Package typestest provides a generator of random types.Value trees for property-based tests and fuzzing.
+package typestest
+
+import (
+	"math"
+	"math/rand"
+	"unicode/utf8"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+const (
+	DefaultMaxDepth  = 4 // the default maximum nesting depth of Objects and Arrays
+	DefaultMaxLength = 8 // the default maximum number of bytes in Strings and elements in Objects and Arrays
+)
+
+// Generator generates random values.
+// Values generated by a Generator are determined only by its seed and its options.
+type Generator struct {
+	rand        *rand.Rand
+	maxDepth    int
+	maxLength   int
+	kinds       []types.Kind
+	finiteFloat bool
+	validUTF8   bool
+}
+
+// GeneratorOption configures a Generator.
+type GeneratorOption interface {
+	apply(*Generator)
+}
+
+type generatorOption func(*Generator)
+
+func (opt generatorOption) apply(g *Generator) {
+	opt(g)
+}
+
+// WithMaxDepth sets the maximum nesting depth of Objects and Arrays.
+// Values at the maximum depth are never Objects nor Arrays.
+func WithMaxDepth(depth int) GeneratorOption {
+	return generatorOption(func(g *Generator) {
+		g.maxDepth = depth
+	})
+}
+
+// WithMaxLength sets the maximum number of bytes in Strings and elements in Objects and Arrays.
+func WithMaxLength(length int) GeneratorOption {
+	return generatorOption(func(g *Generator) {
+		g.maxLength = length
+	})
+}
+
+// WithKinds restricts values to the given kinds. All kinds are generated by default.
+func WithKinds(kinds ...types.Kind) GeneratorOption {
+	return generatorOption(func(g *Generator) {
+		g.kinds = kinds
+	})
+}
+
+// WithFiniteFloats prevents Floats from being NaN or infinity.
+func WithFiniteFloats() GeneratorOption {
+	return generatorOption(func(g *Generator) {
+		g.finiteFloat = true
+	})
+}
+
+// WithValidUTF8 makes Strings and keys of Objects valid UTF-8.
+func WithValidUTF8() GeneratorOption {
+	return generatorOption(func(g *Generator) {
+		g.validUTF8 = true
+	})
+}
+
+// NewGenerator creates a new Generator.
+func NewGenerator(seed int64, opts ...GeneratorOption) *Generator {
+	g := &Generator{
+		rand:      rand.New(rand.NewSource(seed)),
+		maxDepth:  DefaultMaxDepth,
+		maxLength: DefaultMaxLength,
+		kinds: []types.Kind{
+			types.Int, types.Uint, types.Float, types.String,
+			types.Object, types.Array, types.Bool, types.Nil,
+		},
+	}
+	for _, opt := range opts {
+		opt.apply(g)
+	}
+	return g
+}
+
+// Value returns a new random value.
+func (g *Generator) Value() *types.Value {
+	return g.value(0)
+}
+
+func (g *Generator) value(depth int) *types.Value {
+	kinds := g.kinds
+	if depth >= g.maxDepth {
+		kinds = scalarKinds(kinds)
+		if len(kinds) == 0 {
+			// Containers must be empty here.
+			kinds = g.kinds
+		}
+	}
+	switch kinds[g.rand.Intn(len(kinds))] {
+	case types.Int:
+		return types.NewIntValue(g.Int())
+	case types.Uint:
+		return types.NewUintValue(g.rand.Uint64())
+	case types.Float:
+		return types.NewFloatValue(g.Float())
+	case types.String:
+		return types.NewStringValue(g.Bytes())
+	case types.Object:
+		obj := types.NewObjectValue(map[string]*types.Value{})
+		if depth < g.maxDepth {
+			for i := g.rand.Intn(g.maxLength + 1); i > 0; i-- {
+				obj.Set(string(g.Bytes()), g.value(depth+1))
+			}
+		}
+		return obj
+	case types.Array:
+		arr := make([]*types.Value, 0)
+		if depth < g.maxDepth {
+			for i := g.rand.Intn(g.maxLength + 1); i > 0; i-- {
+				arr = append(arr, g.value(depth+1))
+			}
+		}
+		return types.NewArrayValue(arr)
+	case types.Bool:
+		return types.NewBoolValue(g.rand.Intn(2) == 0)
+	default:
+		return types.NewNilValue()
+	}
+}
+
+// Int returns a random int64. Small numbers and boundary values are more likely to be chosen.
+func (g *Generator) Int() int64 {
+	switch g.rand.Intn(4) {
+	case 0:
+		return g.rand.Int63n(512) - 256
+	case 1:
+		return []int64{0, 1, -1, math.MaxInt64, math.MinInt64, math.MaxInt32, math.MinInt32}[g.rand.Intn(7)]
+	default:
+		return int64(g.rand.Uint64())
+	}
+}
+
+// Float returns a random float64, which can be NaN or infinity unless WithFiniteFloats is given.
+func (g *Generator) Float() float64 {
+	for {
+		var x float64
+		switch g.rand.Intn(4) {
+		case 0:
+			x = g.rand.NormFloat64()
+		case 1:
+			x = []float64{
+				0, math.Copysign(0, -1), 1, -1, math.MaxFloat64, math.SmallestNonzeroFloat64,
+				math.Inf(1), math.Inf(-1), math.NaN(),
+			}[g.rand.Intn(9)]
+		default:
+			x = math.Float64frombits(g.rand.Uint64())
+		}
+		if !g.finiteFloat || !(math.IsNaN(x) || math.IsInf(x, 0)) {
+			return x
+		}
+	}
+}
+
+// Bytes returns random bytes, which are valid UTF-8 if WithValidUTF8 is given.
+func (g *Generator) Bytes() []byte {
+	n := g.rand.Intn(g.maxLength + 1)
+	b := make([]byte, 0, n)
+	for len(b) < n {
+		if !g.validUTF8 {
+			b = append(b, byte(g.rand.Intn(256)))
+			continue
+		}
+		var r rune
+		if g.rand.Intn(2) == 0 {
+			r = rune(g.rand.Intn(0x80))
+		} else {
+			r = rune(g.rand.Intn(utf8.MaxRune + 1))
+		}
+		if !utf8.ValidRune(r) || len(b)+utf8.RuneLen(r) > n {
+			continue
+		}
+		b = append(b, string(r)...)
+	}
+	return b
+}
+
+func scalarKinds(kinds []types.Kind) []types.Kind {
+	scalars := make([]types.Kind, 0, len(kinds))
+	for _, k := range kinds {
+		if k != types.Object && k != types.Array {
+			scalars = append(scalars, k)
+		}
+	}
+	return scalars
+}
+
+// MapScalars returns a copy of v in which each value other than Objects and Arrays is replaced by f.
+// It is useful to describe conversions that change some kinds of values into another, e.g. Ints into Floats.
+func MapScalars(v *types.Value, f func(*types.Value) *types.Value) *types.Value {
+	switch v.Kind {
+	case types.Object:
+		obj := types.NewObjectValue(map[string]*types.Value{})
+		for _, k := range v.OrderedKeys() {
+			obj.Set(k, MapScalars(v.Object[k], f))
+		}
+		return obj
+	case types.Array:
+		arr := make([]*types.Value, 0, len(v.Array))
+		for _, elem := range v.Array {
+			arr = append(arr, MapScalars(elem, f))
+		}
+		return types.NewArrayValue(arr)
+	default:
+		return f(v.DeepCopy())
+	}
+}
@@ -0,0 +1,82 @@
+package typestest
+
+import (
+	"math"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+func TestGeneratorIsDeterminedBySeed(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		a, b := NewGenerator(seed).Value(), NewGenerator(seed).Value()
+		if diff := cmp.Diff(a, b, cmpopts.EquateNaNs(), CmpOption); diff != "" {
+			t.Errorf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+		}
+	}
+}
+
+func TestGeneratorRespectsOptions(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		g := NewGenerator(seed,
+			WithMaxDepth(2), WithMaxLength(3), WithKinds(types.Float, types.String, types.Array),
+			WithFiniteFloats(), WithValidUTF8(),
+		)
+		walk(g.Value(), 0, func(v *types.Value, depth int) {
+			if depth > 2 {
+				t.Errorf("seed %d: too deep: %d", seed, depth)
+			}
+			switch v.Kind {
+			case types.Float:
+				if math.IsNaN(v.Float) || math.IsInf(v.Float, 0) {
+					t.Errorf("seed %d: not finite: %v", seed, v.Float)
+				}
+			case types.String:
+				if len(v.String) > 3 || !utf8.Valid(v.String) {
+					t.Errorf("seed %d: unexpected string: %q", seed, v.String)
+				}
+			case types.Array:
+				if len(v.Array) > 3 {
+					t.Errorf("seed %d: too long: %d", seed, len(v.Array))
+				}
+			default:
+				t.Errorf("seed %d: unexpected kind: %d", seed, v.Kind)
+			}
+		})
+	}
+}
+
+func TestMapScalarsReplacesScalarsAndKeepsKeyOrder(t *testing.T) {
+	v := types.NewObjectValue(map[string]*types.Value{})
+	v.Set("b", types.NewIntValue(1))
+	v.Set("a", types.NewArrayValue([]*types.Value{types.NewIntValue(2), types.NewBoolValue(true)}))
+	got := MapScalars(v, func(v *types.Value) *types.Value {
+		if v.Kind == types.Int {
+			return types.NewFloatValue(float64(v.Int))
+		}
+		return v
+	})
+	want := types.NewObjectValue(map[string]*types.Value{})
+	want.Set("b", types.NewFloatValue(1))
+	want.Set("a", types.NewArrayValue([]*types.Value{types.NewFloatValue(2), types.NewBoolValue(true)}))
+	if diff := cmp.Diff(want, got, CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if v.Object["b"].Kind != types.Int {
+		t.Errorf("the original value is modified: %#v", v)
+	}
+}
+
+func walk(v *types.Value, depth int, f func(*types.Value, int)) {
+	f(v, depth)
+	for _, elem := range v.Array {
+		walk(elem, depth+1, f)
+	}
+	for _, elem := range v.Object {
+		walk(elem, depth+1, f)
+	}
+}
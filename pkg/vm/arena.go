@@ -0,0 +1,82 @@
+package vm
+
+import (
+	"github.com/genkami/watson/pkg/types"
+)
+
+// arenaChunkSize is the number of values that an arena allocates at once.
+const arenaChunkSize = 256
+
+// arena allocates values in chunks and reuses them.
+type arena struct {
+	chunks  [][]types.Value
+	used    int            // the number of values in chunks that are allocated since the last reset
+	free    []*types.Value // values that are no longer referred, which are reused before the ones in chunks
+	dropped []*types.Value // values that are dropped by the current instruction, which become free once it succeeds
+}
+
+// WithArena makes a VM allocate values from an arena and reuse them, which reduces allocations and thus the cost of GC.
+//
+// Ints, Uints, Floats, Strings, Bools and Nils are allocated in chunks instead of one by one.
+// Values that an instruction drops from the stack (e.g. Ints added by Iadd) are reused by the following instructions,
+// and all values allocated from the arena are reused after Reset.
+// Therefore, a value returned by Top is valid only until the next instruction, and a value returned by Pop is valid only until Reset.
+// Values returned by Stack are not affected since they are copies.
+func WithArena() VMOption {
+	return vmOption(func(v *VM) {
+		v.arena = &arena{}
+	})
+}
+
+func (a *arena) alloc() *types.Value {
+	if n := len(a.free); n > 0 {
+		v := a.free[n-1]
+		a.free = a.free[:n-1]
+		*v = types.Value{}
+		return v
+	}
+	c, i := a.used/arenaChunkSize, a.used%arenaChunkSize
+	if c == len(a.chunks) {
+		a.chunks = append(a.chunks, make([]types.Value, arenaChunkSize))
+	}
+	a.used++
+	return &a.chunks[c][i]
+}
+
+// commit makes the values dropped by the last instruction free.
+func (a *arena) commit() {
+	a.free = append(a.free, a.dropped...)
+	a.dropped = a.dropped[:0]
+}
+
+// rollback cancels dropping values since the last instruction failed and they are still on the stack.
+func (a *arena) rollback() {
+	a.dropped = a.dropped[:0]
+}
+
+func (a *arena) reset() {
+	// Values are cleared so as not to keep what they refer (e.g. Strings) from being garbage collected.
+	for i := 0; i < a.used; i++ {
+		a.chunks[i/arenaChunkSize][i%arenaChunkSize] = types.Value{}
+	}
+	a.used = 0
+	a.free = a.free[:0]
+	a.dropped = a.dropped[:0]
+}
+
+// newValue returns a new value of the given kind, which is allocated from the arena if the VM has one.
+func (vm *VM) newValue(kind types.Kind) *types.Value {
+	if vm.arena == nil {
+		return &types.Value{Kind: kind}
+	}
+	v := vm.arena.alloc()
+	v.Kind = kind
+	return v
+}
+
+// drop tells that the current instruction popped v and no longer uses it, so that the arena can reuse it.
+func (vm *VM) drop(v *types.Value, o ownership) {
+	if vm.arena != nil && o == owned {
+		vm.arena.dropped = append(vm.arena.dropped, v)
+	}
+}
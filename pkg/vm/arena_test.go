@@ -0,0 +1,145 @@
+package vm
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestResetEmptiesTheStack(t *testing.T) {
+	for _, opts := range [][]VMOption{nil, {WithArena()}} {
+		vm := NewVM(opts...)
+		err := vm.FeedMulti([]Op{Inew, Snew, Onew})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vm.Reset()
+		if vm.Depth() != 0 {
+			t.Errorf("expected the stack to be empty but got %d values", vm.Depth())
+		}
+		err = vm.FeedMulti([]Op{Bnew, Bneg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*types.Value{types.NewBoolValue(true)}
+		if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+			t.Errorf("mismatch (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestResetClearsUsage(t *testing.T) {
+	vm := NewVM(WithMaxInstructions(2))
+	err := vm.FeedMulti([]Op{Inew, Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Inew)
+	if !errors.Is(err, ErrTooManyInstructions) {
+		t.Fatalf("expected ErrTooManyInstructions but got %v", err)
+	}
+	vm.Reset()
+	err = vm.FeedMulti([]Op{Inew, Inew})
+	if err != nil {
+		t.Errorf("expected no error but got %v", err)
+	}
+}
+
+func TestArenaReusesValuesAfterReset(t *testing.T) {
+	vm := NewVM(WithArena())
+	ops := []Op{Inew, Iinc, Ishl, Iinc, Inew, Iinc, Iadd, Snew, Inew, Iinc, Sadd, Gpop, Finf, Fneg, Bnew, Nnew}
+	allocs := testing.AllocsPerRun(100, func() {
+		vm.Reset()
+		if err := vm.FeedMulti(ops); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// Only Snew and Sadd allocate the bytes of the String.
+	if allocs > 2 {
+		t.Errorf("expected at most 2 allocations but got %v", allocs)
+	}
+}
+
+func TestArenaDoesNotReuseValuesIfInstructionFails(t *testing.T) {
+	vm := NewVM(WithArena())
+	err := vm.FeedMulti([]Op{Snew, Inew, Iinc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Iadd pops 1 and then fails since "" is not an Int.
+	err = vm.Feed(Iadd)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch but got %v", err)
+	}
+	// If 1 were reused, this would overwrite it.
+	err = vm.Feed(Inew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*types.Value{
+		types.NewStringValue([]byte{}),
+		types.NewIntValue(1),
+		types.NewIntValue(0),
+	}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestArenaDoesNotChangeSemantics runs random programs both on a VM with an arena and on another VM without it.
+// The former also reuses the same VM after Reset and executes ops by FeedFused.
+func TestArenaDoesNotChangeSemantics(t *testing.T) {
+	withArena := NewVM(WithStackSize(64), WithMaxAllocatedBytes(1<<14), WithArena())
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		withArena.Reset()
+		plain := NewVM(WithStackSize(64), WithMaxAllocatedBytes(1<<14))
+		for i := 0; i < 100; i++ {
+			ops := make([]Op, 0, 10)
+			for j := r.Intn(10); j >= 0; j-- {
+				ops = append(ops, randomOp(r, plain))
+			}
+			n, err := withArena.FeedFused(ops)
+			wantN, wantErr := feedAll(plain, ops)
+			if n != wantN || (err == nil) != (wantErr == nil) {
+				t.Fatalf("seed %d: %#v: expected (%d, %v) but got (%d, %v)", seed, ops, wantN, wantErr, n, err)
+			}
+			want, got := plain.Stack(), withArena.Stack()
+			if !equalStacks(want, got) {
+				t.Fatalf("seed %d: mismatch (-want +got):\n%s", seed, cmp.Diff(want, got, cmpopts.EquateNaNs(), typestest.CmpOption))
+			}
+		}
+	}
+}
+
+func BenchmarkFeedWithReset(b *testing.B) {
+	ops := benchmarkOps()
+	vm := NewVM()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm.Reset()
+		if _, err := vm.FeedFused(ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFeedWithResetAndArena(b *testing.B) {
+	ops := benchmarkOps()
+	vm := NewVM(WithArena())
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm.Reset()
+		if _, err := vm.FeedFused(ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+// PreviewSize is the maximum number of values in ExecError.Preview.
+const PreviewSize = 3
+
+// ExecError is an error that occurs when a VM fails to execute an Op.
+// It wraps one of ErrStackEmpty, ErrMaximumStackSizeExceeded and ErrTypeMismatch, so it can be checked by `errors.Is`.
+type ExecError struct {
+	Op       Op         // the Op that failed
+	Err      error      // the reason why Op failed
+	Expected types.Kind // the kind of a value that Op expected; this is only meaningful if Err is ErrTypeMismatch
+	Actual   types.Kind // the kind of a value that was actually on the stack; this is only meaningful if Err is ErrTypeMismatch
+
+	// Depth is the number of values on the stack just before the VM executed Op.
+	Depth int
+
+	// Preview is a snapshot of the values on the top of the stack just before the VM executed Op, from the top to the bottom.
+	// It contains at most PreviewSize values.
+	Preview []*types.Value
+}
+
+func (e *ExecError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%#v: %s", e.Op, e.Err.Error())
+	if e.Err == ErrTypeMismatch {
+		fmt.Fprintf(&b, " (expected %#v, got %#v)", e.Expected, e.Actual)
+	}
+	fmt.Fprintf(&b, "; stack depth: %d", e.Depth)
+	if len(e.Preview) > 0 {
+		kinds := make([]string, 0, len(e.Preview))
+		for _, v := range e.Preview {
+			kinds = append(kinds, fmt.Sprintf("%#v", v.Kind))
+		}
+		fmt.Fprintf(&b, ", top: [%s", strings.Join(kinds, ", "))
+		if e.Depth > len(e.Preview) {
+			b.WriteString(", ...")
+		}
+		b.WriteString("]")
+	}
+	return b.String()
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// typeMismatch returns an incomplete ExecError that is completed by VM.Feed.
+func typeMismatch(expected, actual types.Kind) error {
+	return &ExecError{Err: ErrTypeMismatch, Expected: expected, Actual: actual}
+}
+
+// execError completes err as an ExecError that occurred when the VM executed op.
+// This must be called when the stack is the same as the one just before the VM executed op.
+func (vm *VM) execError(op Op, err error) *ExecError {
+	e, ok := err.(*ExecError)
+	if !ok {
+		e = &ExecError{Err: err}
+	}
+	e.Op = op
+	e.Depth = vm.sp + 1
+	e.Preview = make([]*types.Value, 0, PreviewSize)
+	for i := vm.sp; i >= 0 && vm.sp-i < PreviewSize; i-- {
+		e.Preview = append(e.Preview, vm.stack[i].DeepCopy())
+	}
+	return e
+}
@@ -16,16 +16,114 @@ var (
 
 // Top returns a value in the top of the stack.
 // This returns ErrStackEmpty if the stack is empty.
+//
+// If the value shares its contents with other values on the stack, Top replaces it with a deep copy first,
+// so modifying the returned value does not affect the others.
 func (vm *VM) Top() (*types.Value, error) {
 	if vm.sp < 0 {
 		return nil, ErrStackEmpty
 	}
+	if vm.owners[vm.sp] != owned {
+		vm.stack[vm.sp] = vm.stack[vm.sp].DeepCopy()
+		vm.owners[vm.sp] = owned
+	}
 	return vm.stack[vm.sp], nil
 }
 
+// Peek returns the i-th value from the top of the stack, where Peek(0) is the same as Top.
+// This returns ErrStackEmpty if the stack has i or less values, or if i is negative.
+//
+// Unlike Top, the returned value may share its contents with other values on the stack, so it must not be modified.
+func (vm *VM) Peek(i int) (*types.Value, error) {
+	if i < 0 {
+		return nil, ErrStackEmpty
+	}
+	v := vm.peek(i)
+	if v == nil {
+		return nil, ErrStackEmpty
+	}
+	return v, nil
+}
+
+// Pop removes the value on the top of the stack and returns it.
+// Unlike Top, the returned value is no longer referred by the VM, so the caller can modify it freely.
+// This returns ErrStackEmpty if the stack is empty.
+//
+// Note that Pop is not an instruction, so it is neither traced nor limited.
+func (vm *VM) Pop() (*types.Value, error) {
+	v, err := vm.pop()
+	if err != nil {
+		return nil, err
+	}
+	vm.stack[vm.sp+1] = nil
+	vm.owners[vm.sp+1] = owned
+	return v, nil
+}
+
+// Depth returns the number of values on the stack.
+func (vm *VM) Depth() int {
+	return vm.sp + 1
+}
+
+// Stack returns a snapshot of the stack, from the bottom to the top.
+// Values in the snapshot are deep copies, so modifying them does not affect the VM.
+func (vm *VM) Stack() []*types.Value {
+	snapshot := make([]*types.Value, 0, vm.sp+1)
+	for i := 0; i <= vm.sp; i++ {
+		snapshot = append(snapshot, vm.stack[i].DeepCopy())
+	}
+	return snapshot
+}
+
 // Feed takes a op and executes corresponding operation.
 // This can fail in various ways; e.g. type mismatch, stack overflow, etc.
+// In that case, it returns an *ExecError and the stack is left unchanged.
 func (vm *VM) Feed(op Op) error {
+	if vm.tracer == nil {
+		return vm.exec(op)
+	}
+	before := vm.Stack()
+	err := vm.exec(op)
+	vm.tracer(op, before, vm.Stack())
+	return err
+}
+
+// exec executes op atomically, that is, it leaves the stack unchanged if op fails.
+func (vm *VM) exec(op Op) error {
+	var cost int64
+	if vm.limits.enabled() {
+		var err error
+		cost, err = vm.checkLimits(op)
+		if err != nil {
+			return vm.execError(op, err)
+		}
+	}
+	sp := vm.sp
+	err := vm.feed(op)
+	if err != nil {
+		// Popped values are still in the stack since popWithOwnership does not clear them.
+		vm.sp = sp
+		if vm.arena != nil {
+			vm.arena.rollback()
+		}
+		return vm.execError(op, err)
+	}
+	for i := vm.sp + 1; i <= sp; i++ {
+		vm.stack[i] = nil
+		vm.owners[i] = owned
+	}
+	if vm.arena != nil {
+		vm.arena.commit()
+	}
+	if vm.metrics != nil {
+		vm.updateMetrics(op, sp)
+	}
+	vm.usage.instructions++
+	vm.usage.allocatedBytes += cost
+	return nil
+}
+
+func (vm *VM) feed(op Op) error {
 	switch op {
 	case Inew:
 		return vm.feedInew()
@@ -138,11 +236,19 @@ func (vm *VM) feedIsht() error {
 	if err != nil {
 		return err
 	}
+	return vm.pushInt(shift(a, b))
+}
+
+// shift returns a << b if b is positive, and a >> -b otherwise.
+func shift(a, b int64) int64 {
 	if b >= 0 {
-		return vm.pushInt(a << b)
-	} else {
-		return vm.pushInt(a >> -b)
+		return a << b
 	}
+	if b == math.MinInt64 {
+		// -b overflows, so it is treated as any other shift by 64 or more.
+		return a >> 63
+	}
+	return a >> -b
 }
 
 func (vm *VM) feedItof() error {
@@ -186,20 +292,21 @@ func (vm *VM) feedSadd() error {
 	if err != nil {
 		return err
 	}
-	s, err := vm.popString()
+	s, so, err := vm.popMutable(types.String)
 	if err != nil {
 		return err
 	}
-	t := append(s, byte(n))
+	t := append(s.String, byte(n))
+	vm.drop(s, so)
 	return vm.pushString(t)
 }
 
 func (vm *VM) feedOnew() error {
-	return vm.pushObject(map[string]*types.Value{})
+	return vm.push(types.NewObjectValue(map[string]*types.Value{}))
 }
 
 func (vm *VM) feedOadd() error {
-	v, err := vm.pop()
+	v, vo, err := vm.popWithOwnership()
 	if err != nil {
 		return err
 	}
@@ -207,29 +314,29 @@ func (vm *VM) feedOadd() error {
 	if err != nil {
 		return err
 	}
-	o, err := vm.popObject()
+	o, oo, err := vm.popMutable(types.Object)
 	if err != nil {
 		return err
 	}
-	o[string(k)] = v.DeepCopy()
-	return vm.pushObject(o)
+	o.Set(string(k), v)
+	return vm.pushWith(o, combine(oo, vo))
 }
 
 func (vm *VM) feedAnew() error {
-	return vm.pushArray([]*types.Value{})
+	return vm.push(types.NewArrayValue([]*types.Value{}))
 }
 
 func (vm *VM) feedAadd() error {
-	x, err := vm.pop()
+	x, xo, err := vm.popWithOwnership()
 	if err != nil {
 		return err
 	}
-	a, err := vm.popArray()
+	a, ao, err := vm.popMutable(types.Array)
 	if err != nil {
 		return err
 	}
-	a = append(a, x.DeepCopy())
-	return vm.pushArray(a)
+	a.Array = append(a.Array, x)
+	return vm.pushWith(a, combine(ao, xo))
 }
 
 func (vm *VM) feedBnew() error {
@@ -249,36 +356,45 @@ func (vm *VM) feedNnew() error {
 }
 
 func (vm *VM) feedGdup() error {
-	v, err := vm.pop()
+	v, _, err := vm.popWithOwnership()
 	if err != nil {
 		return err
 	}
-	err = vm.push(v)
+	// It checks the stack size first, so as not to mark v as shared if it fails.
+	if len(vm.stack)-2 <= vm.sp {
+		return ErrMaximumStackSizeExceeded
+	}
+	// Both of them are shared instead of being copied, which is done when either of them is modified.
+	err = vm.pushWith(v, shared)
 	if err != nil {
 		return err
 	}
-	return vm.push(v.DeepCopy())
+	return vm.pushWith(v, shared)
 }
 
 func (vm *VM) feedGpop() error {
-	_, err := vm.pop()
-	return err
+	v, o, err := vm.popWithOwnership()
+	if err != nil {
+		return err
+	}
+	vm.drop(v, o)
+	return nil
 }
 
 func (vm *VM) feedGswp() error {
-	a, err := vm.pop()
+	a, ao, err := vm.popWithOwnership()
 	if err != nil {
 		return err
 	}
-	b, err := vm.pop()
+	b, bo, err := vm.popWithOwnership()
 	if err != nil {
 		return err
 	}
-	err = vm.push(a)
+	err = vm.pushWith(a, ao)
 	if err != nil {
 		return err
 	}
-	return vm.push(b)
+	return vm.pushWith(b, bo)
 }
 
 //
@@ -291,113 +407,113 @@ func (vm *VM) push(v *types.Value) error {
 	}
 	vm.sp++
 	vm.stack[vm.sp] = v
+	vm.owners[vm.sp] = owned
 	return nil
 }
 
 func (vm *VM) pushInt(val int64) error {
-	return vm.push(types.NewIntValue(val))
+	v := vm.newValue(types.Int)
+	v.Int = val
+	return vm.push(v)
 }
 
 func (vm *VM) pushUint(val uint64) error {
-	return vm.push(types.NewUintValue(val))
+	v := vm.newValue(types.Uint)
+	v.Uint = val
+	return vm.push(v)
 }
 
 func (vm *VM) pushFloat(val float64) error {
-	return vm.push(types.NewFloatValue(val))
+	v := vm.newValue(types.Float)
+	v.Float = val
+	return vm.push(v)
 }
 
 func (vm *VM) pushString(val []byte) error {
-	return vm.push(types.NewStringValue(val))
+	v := vm.newValue(types.String)
+	v.String = val
+	return vm.push(v)
 }
 
+// pushObject pushes an Object that consists of val.
+// The caller may still refer to val, so the Object is regarded as shared.
 func (vm *VM) pushObject(val map[string]*types.Value) error {
-	return vm.push(types.NewObjectValue(val))
+	return vm.pushWith(types.NewObjectValue(val), shared)
 }
 
+// pushArray pushes an Array that consists of val.
+// The caller may still refer to val, so the Array is regarded as shared.
 func (vm *VM) pushArray(val []*types.Value) error {
-	return vm.push(types.NewArrayValue(val))
+	return vm.pushWith(types.NewArrayValue(val), shared)
 }
 
 func (vm *VM) pushBool(val bool) error {
-	return vm.push(types.NewBoolValue(val))
+	v := vm.newValue(types.Bool)
+	v.Bool = val
+	return vm.push(v)
 }
 
 func (vm *VM) pushNil() error {
-	return vm.push(types.NewNilValue())
+	return vm.push(vm.newValue(types.Nil))
 }
 
+// pop removes the value on the top of the stack and returns it.
+// If the value shares its contents with others, it returns a deep copy instead, so that the caller can modify it.
 func (vm *VM) pop() (*types.Value, error) {
-	if vm.sp < 0 {
-		return nil, ErrStackEmpty
+	v, o, err := vm.popWithOwnership()
+	if err != nil {
+		return nil, err
+	}
+	if o != owned {
+		v = v.DeepCopy()
 	}
-	top := vm.stack[vm.sp]
-	vm.stack[vm.sp] = nil
-	vm.sp--
-	return top, nil
+	return v, nil
 }
 
 func (vm *VM) popInt() (int64, error) {
-	v, err := vm.pop()
+	v, o, err := vm.popWithOwnership()
 	if err != nil {
 		return 0, err
 	}
 	if v.Kind != types.Int {
-		return 0, ErrTypeMismatch
+		return 0, typeMismatch(types.Int, v.Kind)
 	}
+	vm.drop(v, o)
 	return v.Int, nil
 }
 
 func (vm *VM) popFloat() (float64, error) {
-	v, err := vm.pop()
+	v, o, err := vm.popWithOwnership()
 	if err != nil {
 		return 0, err
 	}
 	if v.Kind != types.Float {
-		return 0, ErrTypeMismatch
+		return 0, typeMismatch(types.Float, v.Kind)
 	}
+	vm.drop(v, o)
 	return v.Float, nil
 }
 
 func (vm *VM) popString() ([]byte, error) {
-	v, err := vm.pop()
+	v, o, err := vm.popWithOwnership()
 	if err != nil {
 		return nil, err
 	}
 	if v.Kind != types.String {
-		return nil, ErrTypeMismatch
+		return nil, typeMismatch(types.String, v.Kind)
 	}
+	vm.drop(v, o)
 	return v.String, nil
 }
 
-func (vm *VM) popObject() (map[string]*types.Value, error) {
-	v, err := vm.pop()
-	if err != nil {
-		return nil, err
-	}
-	if v.Kind != types.Object {
-		return nil, ErrTypeMismatch
-	}
-	return v.Object, nil
-}
-
-func (vm *VM) popArray() ([]*types.Value, error) {
-	v, err := vm.pop()
-	if err != nil {
-		return nil, err
-	}
-	if v.Kind != types.Array {
-		return nil, ErrTypeMismatch
-	}
-	return v.Array, nil
-}
-
 func (vm *VM) popBool() (bool, error) {
-	v, err := vm.pop()
+	v, o, err := vm.popWithOwnership()
 	if err != nil {
 		return false, err
 	}
 	if v.Kind != types.Bool {
-		return false, ErrTypeMismatch
+		return false, typeMismatch(types.Bool, v.Kind)
 	}
+	vm.drop(v, o)
 	return v.Bool, nil
 }
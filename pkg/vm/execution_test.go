@@ -1,14 +1,102 @@
 package vm
 
 import (
+	"errors"
 	"math"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
 )
 
+func TestStackReturnsAllValuesFromBottomToTop(t *testing.T) {
+	var err error
+	vm := NewVM()
+	err = vm.pushInt(123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.pushString([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.pushBool(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*types.Value{
+		types.NewIntValue(123),
+		types.NewStringValue([]byte("hello")),
+		types.NewBoolValue(true),
+	}
+	got := vm.Stack()
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStackReturnsEmptySliceWhenStackIsEmpty(t *testing.T) {
+	vm := NewVM()
+	got := vm.Stack()
+	if len(got) != 0 {
+		t.Errorf("expected empty slice but got %#v", got)
+	}
+}
+
+func TestStackReturnsCopies(t *testing.T) {
+	var err error
+	vm := NewVM()
+	err = vm.pushString([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm.Stack()[0].String[0] = 'j'
+	top, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(top.String) != "hello" {
+		t.Errorf("the snapshot shares the same reference with the stack")
+	}
+}
+
+func TestPeekReturnsTheIthValueFromTheTop(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Inew, Snew, Nnew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []types.Kind{types.Nil, types.String, types.Int} {
+		v, err := vm.Peek(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Kind != want {
+			t.Errorf("Peek(%d): expected %#v but got %#v", i, want, v.Kind)
+		}
+	}
+	_, err = vm.Peek(3)
+	if err != ErrStackEmpty {
+		t.Errorf("expected ErrStackEmpty but got %v", err)
+	}
+}
+
+func TestPeekFailsWhenIIsNegative(t *testing.T) {
+	vm := NewVM(WithStackSize(2))
+	err := vm.FeedMulti([]Op{Inew, Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.Peek(-1)
+	if err != ErrStackEmpty {
+		t.Errorf("expected ErrStackEmpty but got %v", err)
+	}
+}
+
 func TestFeedInewPushesZero(t *testing.T) {
 	var err error
 	vm := NewVM()
@@ -27,7 +115,7 @@ func TestFeedInewPushesZero(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -54,7 +142,7 @@ func TestFeedIincIncrementsTheValue(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -67,7 +155,7 @@ func TestFeedIincFailsWhenTypeMismatch(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Iinc)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -76,7 +164,7 @@ func TestFeedIincFailsIfStackIsEmpty(t *testing.T) {
 	var err error
 	vm := NewVM()
 	err = vm.Feed(Iinc)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -106,7 +194,7 @@ func TestFeedIshlShiftsTheTopBy1(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -116,7 +204,7 @@ func TestFeedIshlFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Ishl)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -130,7 +218,7 @@ func TestFeedIshlFailsWhenTypeMismatch(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Ishl)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -162,7 +250,7 @@ func TestFeedIaddAddsTwoIntegers(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -171,7 +259,7 @@ func TestFeedIaddFailsWhenStackIsEmpty(t *testing.T) {
 	var err error
 	vm := NewVM()
 	err = vm.Feed(Iadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -184,7 +272,7 @@ func TestFeedIaddFailsWhenStackIsInsufficiient(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Iadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -202,7 +290,7 @@ func TestFeedIaddFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Iadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -220,7 +308,7 @@ func TestFeedIaddFailsWhenArg2IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Iadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -248,7 +336,7 @@ func TestFeedInegNegatesTheTop(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -258,7 +346,7 @@ func TestFeedInegFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Ineg)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -272,7 +360,7 @@ func TestFeedInegFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Ineg)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -304,7 +392,7 @@ func TestFeedIshtShiftsArg2ToLeftByArg1WhenArg1IsPositive(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -336,7 +424,56 @@ func TestFeedIshtShiftsArg2ToRightByArg1WhenArg1IsNegative(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeedIshtShiftsArg2ToRightWhenArg1IsMinInt64(t *testing.T) {
+	var err error
+	vm := NewVM()
+
+	// "BBubbb...be", where Isht shifts 0 to the right by -math.MinInt64
+	ops := []Op{Inew, Inew, Iinc}
+	for i := 0; i < 63; i++ {
+		ops = append(ops, Ishl)
+	}
+	ops = append(ops, Isht)
+	err = vm.FeedMulti(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := types.NewIntValue(0)
+	got, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	err = vm.pushInt(-0xabcd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.pushInt(math.MinInt64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Isht)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want = types.NewIntValue(-1)
+	got, err = vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -345,7 +482,7 @@ func TestFeedIshtFailsWhenStackIsEmpty(t *testing.T) {
 	var err error
 	vm := NewVM()
 	err = vm.Feed(Isht)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -359,7 +496,7 @@ func TestFeedIshtFailsWhenStackIsInsufficient(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Isht)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -377,7 +514,7 @@ func TestFeedIshtFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Isht)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -395,7 +532,7 @@ func TestFeedIshtFailsWhenArg2IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Isht)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -423,7 +560,7 @@ func TestFeedItofConvertsArg1ToFloat(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -433,7 +570,7 @@ func TestFeedItofFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Itof)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -447,7 +584,7 @@ func TestFeedItofFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Itof)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -475,7 +612,7 @@ func TestFeedItouConvertsArg1ToUint(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -485,7 +622,7 @@ func TestFeedItouFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Itou)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -499,7 +636,7 @@ func TestFeedItouFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Itou)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -523,7 +660,7 @@ func TestFeedFinfPushesPositiveInf(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -574,7 +711,7 @@ func TestFeedFnegNegatesArg1(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -602,7 +739,7 @@ func TestFeedFnegCanNegateInf(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -612,7 +749,7 @@ func TestFeedFnegFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Fneg)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -626,7 +763,7 @@ func TestFeedFnegFailsWhenArg1IsNotFloat(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Fneg)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -649,7 +786,7 @@ func TestFeedSnewPushesEmptyString(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -681,7 +818,7 @@ func TestFeedSaddAddsACharToString(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -690,7 +827,7 @@ func TestFeedSaddFailsWhenStackIsEmpty(t *testing.T) {
 	var err error
 	vm := NewVM()
 	err = vm.Feed(Sadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -703,7 +840,7 @@ func TestFeedSaddFailsWhenStackIsInsufficiient(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Sadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -721,7 +858,7 @@ func TestFeedSaddFailsWhenArg1IsNotInteger(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Sadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -739,7 +876,7 @@ func TestFeedSaddFailsWhenArg2IsNotString(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Sadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -762,7 +899,7 @@ func TestFeedOnewPushesEmptyObject(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -803,7 +940,7 @@ func TestFeedOaddAddsAKeyValuePairToAnObject(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -851,21 +988,57 @@ func TestFeedOaddAddsACopyOfAValue(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
 	got.Object["user"].Object["name"] = types.NewStringValue([]byte("jiro"))
-	if diff := cmp.Diff(addedVal, got.Object["user"].Object); diff == "" {
+	if diff := cmp.Diff(addedVal, got.Object["user"].Object, typestest.CmpOption); diff == "" {
 		t.Errorf("the added value does not seem to be a clone of the value on the stack")
 	}
 }
 
+func TestFeedOaddPreservesTheOrderOfKeys(t *testing.T) {
+	var err error
+	vm := NewVM()
+
+	err = vm.Feed(Onew)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range []string{"b", "a", "b"} {
+		err = vm.pushString([]byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = vm.pushInt(int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = vm.Feed(Oadd)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"b", "a"}
+	if diff := cmp.Diff(want, got.OrderedKeys()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if got.Object["b"].Int != 2 {
+		t.Errorf("expected %d but got %d", 2, got.Object["b"].Int)
+	}
+}
+
 func TestFeedOaddFailsWhenStackIsEmpty(t *testing.T) {
 	var err error
 	vm := NewVM()
 	err = vm.Feed(Oadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -879,7 +1052,7 @@ func TestFeedOaddFailsWhenStackIsInsufficient1(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Oadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -897,7 +1070,7 @@ func TestFeedOaddFailsWhenStackIsInsufficient2(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Oadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -921,7 +1094,7 @@ func TestFeedOaddFailsWhenArg2IsNotString(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Oadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -943,7 +1116,7 @@ func TestFeedOaddFailsWhenArg3IsNotString(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Oadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -966,7 +1139,7 @@ func TestFeedAnewPushesEmptyArray(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1001,7 +1174,7 @@ func TestFeedAaddAppendsArg1ToArg2(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1043,12 +1216,12 @@ func TestFeedAaddAppendsACopyOfAValue(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
 	got.Array[1].Object["name"] = types.NewStringValue([]byte("jiro"))
-	if diff := cmp.Diff(addedVal, got.Array[1].Object); diff == "" {
+	if diff := cmp.Diff(addedVal, got.Array[1].Object, typestest.CmpOption); diff == "" {
 		t.Errorf("the added value does not seem to be a clone of the value on the stack")
 	}
 }
@@ -1058,7 +1231,7 @@ func TestFeedAaddFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Aadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -1072,7 +1245,7 @@ func TestFeedAaddFailsWhenStackIsInsufficient(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Aadd)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatalf("expected ErrStackEmpty but got %v", err)
 	}
 }
@@ -1090,7 +1263,7 @@ func TestFeedAaddFailsIfArg2IsNotArray(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Aadd)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -1113,7 +1286,7 @@ func TestFeedBnewPushesFalse(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1141,7 +1314,7 @@ func TestFeedBnegNegatesTheTop(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1151,7 +1324,7 @@ func TestFeedBnegFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Bneg)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -1165,7 +1338,7 @@ func TestFeedBnegFailsWhenArg1IsNotBool(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Bneg)
-	if err != ErrTypeMismatch {
+	if !errors.Is(err, ErrTypeMismatch) {
 		t.Fatal(err)
 	}
 }
@@ -1188,7 +1361,7 @@ func TestFeedNnewPushesNil(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1215,14 +1388,14 @@ func TestGdupDuplicatesArg1(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, clone); diff != "" {
+	if diff := cmp.Diff(want, clone, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 	orig, err := vm.pop()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, orig); diff != "" {
+	if diff := cmp.Diff(want, orig, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1253,19 +1426,19 @@ func TestGdupPushesACopy(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, clone); diff != "" {
+	if diff := cmp.Diff(want, clone, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 	orig, err := vm.pop()
 	if err != nil {
 		t.Fatal(err)
 	}
-	if diff := cmp.Diff(want, orig); diff != "" {
+	if diff := cmp.Diff(want, orig, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 
 	clone.Object["ebi"] = types.NewStringValue([]byte("shrimp"))
-	if diff := cmp.Diff(clone, orig); diff == "" {
+	if diff := cmp.Diff(clone, orig, typestest.CmpOption); diff == "" {
 		t.Errorf("Gdup does not seem to copy arg1")
 	}
 }
@@ -1275,7 +1448,7 @@ func TestFeedGdupFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Gdup)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -1307,7 +1480,7 @@ func TestFeedGpopPopsOnce(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1317,7 +1490,7 @@ func TestFeedGpopFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Gpop)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -1354,10 +1527,10 @@ func TestGswpSwapsArgs(t *testing.T) {
 		t.Fatalf("stack pointer mismatch: expected %d, got %d", -1, vm.sp)
 	}
 
-	if diff := cmp.Diff(a, a1); diff != "" {
+	if diff := cmp.Diff(a, a1, typestest.CmpOption); diff != "" {
 		t.Errorf("comparing arg1: mismatch (-want +got):\n%s", diff)
 	}
-	if diff := cmp.Diff(b, b1); diff != "" {
+	if diff := cmp.Diff(b, b1, typestest.CmpOption); diff != "" {
 		t.Errorf("comparing arg2: mismatch (-want +got):\n%s", diff)
 	}
 }
@@ -1367,7 +1540,7 @@ func TestFeedGswpFailsWhenStackIsEmpty(t *testing.T) {
 	vm := NewVM()
 
 	err = vm.Feed(Gswp)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -1381,7 +1554,7 @@ func TestFeedGswpFailsWhenStackIsInsufficient(t *testing.T) {
 		t.Fatal(err)
 	}
 	err = vm.Feed(Gswp)
-	if err != ErrStackEmpty {
+	if !errors.Is(err, ErrStackEmpty) {
 		t.Fatal(err)
 	}
 }
@@ -1412,7 +1585,154 @@ func TestFeedMultiExecutesOpsSequentially(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if diff := cmp.Diff(want, got); diff != "" {
+	if diff := cmp.Diff(want, got, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTracerIsCalledWithStacksBeforeAndAfterEachOp(t *testing.T) {
+	type call struct {
+		Op     Op
+		Before []*types.Value
+		After  []*types.Value
+	}
+	calls := make([]call, 0)
+	vm := NewVM(WithTracer(func(op Op, before, after []*types.Value) {
+		calls = append(calls, call{Op: op, Before: before, After: after})
+	}))
+	err := vm.FeedMulti([]Op{Inew, Iinc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []call{
+		{Op: Inew, Before: []*types.Value{}, After: []*types.Value{types.NewIntValue(0)}},
+		{Op: Iinc, Before: []*types.Value{types.NewIntValue(0)}, After: []*types.Value{types.NewIntValue(1)}},
+	}
+	if diff := cmp.Diff(want, calls, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTracerIsCalledEvenIfOpFails(t *testing.T) {
+	var traced []Op
+	vm := NewVM(WithTracer(func(op Op, before, after []*types.Value) {
+		traced = append(traced, op)
+	}))
+	err := vm.Feed(Iinc)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if diff := cmp.Diff([]Op{Iinc}, traced); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeedReturnsExecErrorOnTypeMismatch(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Inew, Snew, Bnew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Iinc)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected *ExecError but got %#v", err)
+	}
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("expected ErrTypeMismatch but got %v", err)
+	}
+	want := &ExecError{
+		Op:       Iinc,
+		Expected: types.Int,
+		Actual:   types.Bool,
+		Depth:    3,
+		Preview: []*types.Value{
+			types.NewBoolValue(false),
+			types.NewStringValue([]byte{}),
+			types.NewIntValue(0),
+		},
+	}
+	if diff := cmp.Diff(want, execErr, cmpopts.IgnoreFields(ExecError{}, "Err"), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeedReturnsExecErrorWithLimitedPreview(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Inew, Inew, Inew, Inew, Fneg})
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected *ExecError but got %#v", err)
+	}
+	if execErr.Depth != 4 {
+		t.Errorf("expected depth 4 but got %d", execErr.Depth)
+	}
+	if len(execErr.Preview) != PreviewSize {
+		t.Errorf("expected %d values in preview but got %d", PreviewSize, len(execErr.Preview))
+	}
+}
+
+func TestFeedReturnsExecErrorWhenStackIsEmpty(t *testing.T) {
+	vm := NewVM()
+	err := vm.Feed(Gpop)
+	var execErr *ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected *ExecError but got %#v", err)
+	}
+	if !errors.Is(err, ErrStackEmpty) {
+		t.Errorf("expected ErrStackEmpty but got %v", err)
+	}
+	if execErr.Op != Gpop || execErr.Depth != 0 || len(execErr.Preview) != 0 {
+		t.Errorf("unexpected error: %#v", execErr)
+	}
+}
+
+func TestFeedLeavesStackUnchangedIfOpFails(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Onew, Inew, Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Oadd)
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Fatalf("expected ErrTypeMismatch but got %v", err)
+	}
+	want := []*types.Value{
+		types.NewObjectValue(map[string]*types.Value{}),
+		types.NewIntValue(0),
+		types.NewIntValue(0),
+	}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeedLeavesStackUnchangedIfStackOverflows(t *testing.T) {
+	vm := NewVM(WithStackSize(2))
+	err := vm.FeedMulti([]Op{Inew, Iinc, Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Gdup)
+	if !errors.Is(err, ErrMaximumStackSizeExceeded) {
+		t.Fatalf("expected ErrMaximumStackSizeExceeded but got %v", err)
+	}
+	want := []*types.Value{types.NewIntValue(1), types.NewIntValue(0)}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
 		t.Errorf("mismatch (-want +got):\n%s", diff)
 	}
 }
+
+func TestDepthReturnsTheNumberOfValues(t *testing.T) {
+	vm := NewVM()
+	if vm.Depth() != 0 {
+		t.Errorf("expected 0 but got %d", vm.Depth())
+	}
+	err := vm.FeedMulti([]Op{Inew, Snew, Gpop, Bnew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.Depth() != 2 {
+		t.Errorf("expected 2 but got %d", vm.Depth())
+	}
+}
@@ -0,0 +1,176 @@
+package vm
+
+import (
+	"github.com/genkami/watson/pkg/types"
+)
+
+// pendingValue is an Int or a String that is being built by FeedFused and is not pushed onto the stack yet.
+type pendingValue struct {
+	kind types.Kind // either Int or String
+	n    int64
+	s    []byte
+}
+
+// FeedFused executes ops sequentially, just like calling Feed for each op.
+// It returns the number of ops that are executed successfully, and an error if one of them fails.
+//
+// Unlike Feed, it recognizes sequences of ops that construct Ints and Strings (e.g. `Inew Iinc Ishl Iadd` or `Snew ... Sadd`)
+// and executes them without allocating intermediate values.
+// The result, including errors and the state of the stack after an error, is exactly the same as the one of Feed.
+//
+// If the VM has a tracer, FeedFused just calls Feed for each op so that the tracer can see every op.
+func (vm *VM) FeedFused(ops []Op) (int, error) {
+	if vm.tracer != nil {
+		for i, op := range ops {
+			if err := vm.Feed(op); err != nil {
+				return i, err
+			}
+		}
+		return len(ops), nil
+	}
+	for i, op := range ops {
+		if vm.fuse(op) {
+			continue
+		}
+		vm.flushPending()
+		if err := vm.Feed(op); err != nil {
+			return i, err
+		}
+	}
+	vm.flushPending()
+	return len(ops), nil
+}
+
+// fuse executes op on the pending values if possible, and reports whether it did.
+// If it returns false, nothing is changed.
+func (vm *VM) fuse(op Op) bool {
+	// The usage is counted in the same way as checkLimits so that Feed can report the error if op exceeds a limit.
+	cost := valueSize
+	if op == Sadd {
+		cost++
+	}
+	if vm.limits.maxInstructions > 0 && vm.usage.instructions >= vm.limits.maxInstructions {
+		return false
+	}
+	if vm.limits.maxAllocatedBytes > 0 && vm.usage.allocatedBytes+cost > vm.limits.maxAllocatedBytes {
+		return false
+	}
+	switch op {
+	case Inew:
+		if !vm.hasRoomForPending() {
+			return false
+		}
+		vm.pending = append(vm.pending, pendingValue{kind: types.Int})
+	case Iinc, Ishl, Ineg:
+		if !vm.pendingInts(1) {
+			return false
+		}
+		top := &vm.pending[len(vm.pending)-1]
+		switch op {
+		case Iinc:
+			top.n++
+		case Ishl:
+			top.n <<= 1
+		case Ineg:
+			top.n = -top.n
+		}
+	case Iadd, Isht:
+		if !vm.pendingInts(2) {
+			return false
+		}
+		b := vm.pending[len(vm.pending)-1].n
+		vm.pending = vm.pending[:len(vm.pending)-1]
+		a := &vm.pending[len(vm.pending)-1]
+		if op == Iadd {
+			a.n += b
+		} else {
+			a.n = shift(a.n, b)
+		}
+	case Snew:
+		if !vm.hasRoomForPending() {
+			return false
+		}
+		vm.pending = append(vm.pending, pendingValue{kind: types.String, s: []byte{}})
+	case Sadd:
+		k := len(vm.pending)
+		if k < 2 || vm.pending[k-1].kind != types.Int || vm.pending[k-2].kind != types.String {
+			return false
+		}
+		s := &vm.pending[k-2]
+		if vm.limits.maxStringLength > 0 && len(s.s) >= vm.limits.maxStringLength {
+			return false
+		}
+		s.s = append(s.s, byte(vm.pending[k-1].n))
+		vm.pending = vm.pending[:k-1]
+	default:
+		return false
+	}
+	vm.usage.instructions++
+	vm.usage.allocatedBytes += cost
+	return true
+}
+
+// hasRoomForPending reports whether the stack has room for another value in addition to the pending values.
+func (vm *VM) hasRoomForPending() bool {
+	return vm.sp+len(vm.pending)+1 < len(vm.stack)
+}
+
+// pendingInts reports whether the top n values are Ints, moving them from the stack to the pending values if necessary.
+func (vm *VM) pendingInts(n int) bool {
+	k := len(vm.pending)
+	for i := 0; i < n && i < k; i++ {
+		if vm.pending[k-1-i].kind != types.Int {
+			return false
+		}
+	}
+	if k >= n {
+		return true
+	}
+	// The rest of them must be on the top of the stack.
+	rest := n - k
+	if vm.sp+1 < rest {
+		return false
+	}
+	for i := 0; i < rest; i++ {
+		if vm.stack[vm.sp-i].Kind != types.Int {
+			return false
+		}
+	}
+	// It does not modify the values on the stack since they may be shared with others (e.g. the caller of Top).
+	adopted := make([]pendingValue, 0, rest+k)
+	for i := rest - 1; i >= 0; i-- {
+		adopted = append(adopted, pendingValue{kind: types.Int, n: vm.stack[vm.sp-i].Int})
+	}
+	for i := 0; i < rest; i++ {
+		if vm.arena != nil && vm.owners[vm.sp] == owned {
+			vm.arena.free = append(vm.arena.free, vm.stack[vm.sp])
+		}
+		vm.stack[vm.sp] = nil
+		vm.owners[vm.sp] = owned
+		vm.sp--
+	}
+	vm.pending = append(adopted, vm.pending...)
+	return true
+}
+
+// flushPending pushes all pending values onto the stack.
+func (vm *VM) flushPending() {
+	for i := range vm.pending {
+		p := &vm.pending[i]
+		v := vm.newValue(p.kind)
+		if p.kind == types.Int {
+			v.Int = p.n
+		} else {
+			v.String = p.s
+		}
+		// This never fails since hasRoomForPending is checked before.
+		vm.sp++
+		vm.stack[vm.sp] = v
+		vm.owners[vm.sp] = owned
+		if vm.metrics != nil {
+			vm.metrics[vm.sp] = leafMetrics(v)
+		}
+		p.s = nil
+	}
+	vm.pending = vm.pending[:0]
+}
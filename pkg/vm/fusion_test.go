@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+// feedAll executes ops one by one with Feed, which is the reference implementation of FeedFused.
+func feedAll(vm *VM, ops []Op) (int, error) {
+	for i, op := range ops {
+		if err := vm.Feed(op); err != nil {
+			return i, err
+		}
+	}
+	return len(ops), nil
+}
+
+// testFeedFusedIsIdenticalToFeed checks that FeedFused behaves exactly the same as Feed when ops are executed after prefix.
+func testFeedFusedIsIdenticalToFeed(t *testing.T, stackSize int, prefix, ops []Op) {
+	t.Helper()
+	testFeedFusedIsIdenticalToFeedWithOptions(t, []VMOption{WithStackSize(stackSize)}, prefix, ops)
+}
+
+func testFeedFusedIsIdenticalToFeedWithOptions(t *testing.T, opts []VMOption, prefix, ops []Op) {
+	t.Helper()
+	want := NewVM(opts...)
+	got := NewVM(opts...)
+	if _, err := feedAll(want, prefix); err != nil {
+		return
+	}
+	if _, err := feedAll(got, prefix); err != nil {
+		t.Fatal(err)
+	}
+	wantN, wantErr := feedAll(want, ops)
+	gotN, gotErr := got.FeedFused(ops)
+	if wantN != gotN {
+		t.Errorf("%#v: expected %d ops to be executed but got %d", ops, wantN, gotN)
+	}
+	if diff := cmp.Diff(wantErr, gotErr, cmpopts.IgnoreFields(ExecError{}, "Err"), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("%#v: error mismatch (-want +got):\n%s", ops, diff)
+	}
+	if wantErr != nil && !errors.Is(gotErr, errors.Unwrap(wantErr)) {
+		t.Errorf("%#v: expected %v but got %v", ops, wantErr, gotErr)
+	}
+	if diff := cmp.Diff(want.Stack(), got.Stack(), cmpopts.EquateNaNs(), typestest.CmpOption); diff != "" {
+		t.Errorf("%#v: stack mismatch (-want +got):\n%s", ops, diff)
+	}
+}
+
+func TestFeedFusedIsIdenticalToFeedForEachOp(t *testing.T) {
+	// These are the situations tested in execution_test.go, i.e. each op is executed on the stack that is empty,
+	// or that has values of the expected kinds, or that has values of unexpected kinds.
+	prefixes := [][]Op{
+		{},
+		{Inew},
+		{Inew, Iinc, Inew, Iinc, Iinc},
+		{Snew},
+		{Snew, Inew, Iinc},
+		{Inew, Snew},
+		{Onew, Snew, Inew},
+		{Anew, Inew},
+		{Bnew},
+		{Nnew},
+		{Finf},
+		{Inew, Ineg, Iinc, Ineg},
+		{Inew, Iinc, Ishl, Ishl, Inew, Iinc, Ineg},
+	}
+	for _, prefix := range prefixes {
+		for _, op := range AllOps() {
+			testFeedFusedIsIdenticalToFeed(t, DefaultStackSize, prefix, []Op{op})
+			testFeedFusedIsIdenticalToFeed(t, DefaultStackSize, nil, append(append([]Op{}, prefix...), op))
+		}
+	}
+}
+
+func TestFeedFusedIsIdenticalToFeedForLiterals(t *testing.T) {
+	for _, ops := range [][]Op{
+		intOps(0),
+		intOps(1),
+		intOps(0xdeadbeef),
+		intOps(-1),
+		append(intOps(1<<62), Itof),
+		append(intOps(12345), Itou),
+		stringOps("hello, world"),
+		stringOps("\xff\x00"),
+		append(append([]Op{Onew}, stringOps("key")...), append(intOps(42), Oadd)...),
+		append(append([]Op{Anew}, intOps(-7)...), Aadd, Gdup, Gswp, Gpop),
+		{Inew, Iinc, Ishl, Ishl, Ishl, Inew, Iinc, Ishl, Isht},
+		{Inew, Iinc, Ishl, Ishl, Ishl, Inew, Iinc, Ineg, Isht},
+		{Inew, Iinc, Inew, Iinc, Ishl, Ishl, Ishl, Ishl, Ishl, Ishl, Isht},
+		append(append(intOps(-0xabcd), intOps(math.MinInt64)...), Isht),
+		{Snew, Snew, Inew, Sadd, Sadd},
+		{Snew, Inew, Iinc, Inew, Sadd},
+	} {
+		testFeedFusedIsIdenticalToFeed(t, DefaultStackSize, nil, ops)
+		testFeedFusedIsIdenticalToFeed(t, DefaultStackSize, []Op{Inew, Iinc}, ops)
+	}
+}
+
+func TestFeedFusedIsIdenticalToFeedWhenStackOverflows(t *testing.T) {
+	for size := 1; size <= 4; size++ {
+		testFeedFusedIsIdenticalToFeed(t, size, nil, []Op{Inew, Inew, Inew, Inew, Inew})
+		testFeedFusedIsIdenticalToFeed(t, size, nil, []Op{Snew, Inew, Snew, Inew, Sadd})
+		testFeedFusedIsIdenticalToFeed(t, size, []Op{Bnew}, []Op{Inew, Iinc, Inew, Iinc, Iadd})
+	}
+}
+
+func TestFeedFusedIsIdenticalToFeedForRandomOps(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	// ops that are used to build literals appear more frequently
+	weighted := []Op{Inew, Inew, Iinc, Iinc, Ishl, Ishl, Iadd, Iadd, Ineg, Isht, Snew, Snew, Sadd, Sadd}
+	weighted = append(weighted, AllOps()...)
+	for i := 0; i < 3000; i++ {
+		ops := make([]Op, r.Intn(40))
+		for j := range ops {
+			ops[j] = weighted[r.Intn(len(weighted))]
+		}
+		split := r.Intn(len(ops) + 1)
+		stackSize := DefaultStackSize
+		if r.Intn(2) == 0 {
+			stackSize = 1 + r.Intn(6)
+		}
+		testFeedFusedIsIdenticalToFeed(t, stackSize, ops[:split], ops[split:])
+	}
+}
+
+func TestFeedFusedDoesNotModifyValuesReturnedByTop(t *testing.T) {
+	vm := NewVM()
+	_, err := vm.FeedFused([]Op{Inew, Iinc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = vm.FeedFused([]Op{Iinc, Ishl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(types.NewIntValue(1), top, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFeedFusedCallsTracerForEachOp(t *testing.T) {
+	var traced []Op
+	vm := NewVM(WithTracer(func(op Op, before, after []*types.Value) {
+		traced = append(traced, op)
+	}))
+	ops := []Op{Inew, Iinc, Snew, Inew, Sadd}
+	_, err := vm.FeedFused(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ops, traced); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// intOps returns ops that build n in the same way as the dumper does.
+func intOps(n int64) []Op {
+	ops := []Op{Inew}
+	u := uint64(n)
+	for shift := 0; u != 0; shift++ {
+		if u%2 == 1 {
+			ops = append(ops, Inew, Iinc)
+			for i := 0; i < shift; i++ {
+				ops = append(ops, Ishl)
+			}
+			ops = append(ops, Iadd)
+		}
+		u >>= 1
+	}
+	return ops
+}
+
+func stringOps(s string) []Op {
+	ops := []Op{Snew}
+	for _, c := range []byte(s) {
+		ops = append(ops, intOps(int64(c))...)
+		ops = append(ops, Sadd)
+	}
+	return ops
+}
+
+// benchmarkOps builds an Array of many Ints and Strings.
+func benchmarkOps() []Op {
+	r := rand.New(rand.NewSource(1))
+	ops := []Op{Anew}
+	for i := 0; i < 1000; i++ {
+		ops = append(ops, intOps(r.Int63())...)
+		ops = append(ops, Aadd)
+		ops = append(ops, stringOps("the quick brown fox")...)
+		ops = append(ops, Aadd)
+	}
+	return ops
+}
+
+func BenchmarkFeed(b *testing.B) {
+	ops := benchmarkOps()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM()
+		if _, err := feedAll(vm, ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFeedFused(b *testing.B) {
+	ops := benchmarkOps()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM()
+		if _, err := vm.FeedFused(ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
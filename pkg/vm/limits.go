@@ -0,0 +1,197 @@
+package vm
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+var (
+	ErrTooManyInstructions   = errors.New("too many instructions")
+	ErrStringTooLong         = errors.New("string too long")
+	ErrCollectionTooLarge    = errors.New("array or object too large")
+	ErrNestingTooDeep        = errors.New("nesting too deep")
+	ErrTooManyBytesAllocated = errors.New("too many bytes allocated")
+)
+
+// limits restricts resources that a VM can use. Zero means unlimited.
+type limits struct {
+	maxInstructions   int64
+	maxStringLength   int
+	maxCollectionSize int
+	maxNestingDepth   int
+	maxAllocatedBytes int64
+}
+
+// usage is the amount of resources that a VM has used.
+type usage struct {
+	instructions   int64
+	allocatedBytes int64
+}
+
+// WithMaxInstructions limits the number of instructions that a VM can execute.
+// If the VM is asked to execute more, it fails with ErrTooManyInstructions.
+func WithMaxInstructions(n int64) VMOption {
+	return vmOption(func(v *VM) {
+		v.limits.maxInstructions = n
+	})
+}
+
+// WithMaxStringLength limits the length of Strings that a VM can build.
+// If Sadd makes a longer String, it fails with ErrStringTooLong.
+func WithMaxStringLength(n int) VMOption {
+	return vmOption(func(v *VM) {
+		v.limits.maxStringLength = n
+	})
+}
+
+// WithMaxCollectionSize limits the number of elements in Arrays and Objects that a VM can build.
+// If Aadd or Oadd makes a larger one, it fails with ErrCollectionTooLarge.
+func WithMaxCollectionSize(n int) VMOption {
+	return vmOption(func(v *VM) {
+		v.limits.maxCollectionSize = n
+	})
+}
+
+// WithMaxNestingDepth limits the depth of Arrays and Objects that a VM can build.
+// The depth of an empty Array or Object is 1, and the depth of others is one more than the maximum depth of their elements.
+// If Aadd or Oadd makes a deeper one, it fails with ErrNestingTooDeep.
+// The depth of an Object whose key is overwritten by Oadd is counted as if it still had the old value.
+func WithMaxNestingDepth(n int) VMOption {
+	return vmOption(func(v *VM) {
+		v.limits.maxNestingDepth = n
+	})
+}
+
+// WithMaxAllocatedBytes limits the total number of bytes that a VM can allocate.
+// If an instruction makes it allocate more, it fails with ErrTooManyBytesAllocated.
+//
+// Note that the number of bytes is an estimate: each instruction that pushes a new value allocates the size of `types.Value`,
+// and instructions that duplicate values (Aadd, Oadd and Gdup) allocate the size of the whole value in addition.
+// Although the VM shares duplicated values instead of copying them, they are counted as if they were copied,
+// so that the limit also bounds the size of the result.
+// The size of an Object whose key is overwritten by Oadd still includes the old value.
+func WithMaxAllocatedBytes(n int64) VMOption {
+	return vmOption(func(v *VM) {
+		v.limits.maxAllocatedBytes = n
+	})
+}
+
+func (l *limits) enabled() bool {
+	return *l != limits{}
+}
+
+// valueSize is the number of bytes allocated for a `types.Value`.
+const valueSize = int64(unsafe.Sizeof(types.Value{}))
+
+// checkLimits checks whether executing op exceeds any limit, and returns the number of bytes that op allocates.
+// It only looks at the stack without modifying it; if op can't be executed (e.g. type mismatch), it leaves the error to op itself.
+func (vm *VM) checkLimits(op Op) (int64, error) {
+	if vm.limits.maxInstructions > 0 && vm.usage.instructions >= vm.limits.maxInstructions {
+		return 0, ErrTooManyInstructions
+	}
+	var cost int64
+	switch op {
+	case Sadd:
+		cost = valueSize + 1
+		if s := vm.peek(1); s != nil && s.Kind == types.String {
+			if vm.limits.maxStringLength > 0 && len(s.String) >= vm.limits.maxStringLength {
+				return 0, ErrStringTooLong
+			}
+		}
+	case Aadd:
+		x, a := vm.peek(0), vm.peek(1)
+		if x == nil || a == nil || a.Kind != types.Array {
+			break
+		}
+		if vm.limits.maxCollectionSize > 0 && len(a.Array) >= vm.limits.maxCollectionSize {
+			return 0, ErrCollectionTooLarge
+		}
+		m := vm.metrics[vm.sp]
+		if vm.limits.maxNestingDepth > 0 && m.depth+1 > vm.limits.maxNestingDepth {
+			return 0, ErrNestingTooDeep
+		}
+		cost = valueSize + m.size
+	case Oadd:
+		v, k, o := vm.peek(0), vm.peek(1), vm.peek(2)
+		if v == nil || k == nil || o == nil || k.Kind != types.String || o.Kind != types.Object {
+			break
+		}
+		if _, ok := o.Object[string(k.String)]; !ok && vm.limits.maxCollectionSize > 0 && len(o.Object) >= vm.limits.maxCollectionSize {
+			return 0, ErrCollectionTooLarge
+		}
+		m := vm.metrics[vm.sp]
+		if vm.limits.maxNestingDepth > 0 && m.depth+1 > vm.limits.maxNestingDepth {
+			return 0, ErrNestingTooDeep
+		}
+		cost = int64(len(k.String)) + m.size
+	case Gdup:
+		if vm.sp >= 0 {
+			cost = vm.metrics[vm.sp].size
+		}
+	case Gpop, Gswp:
+		cost = 0
+	default:
+		cost = valueSize
+	}
+	if vm.limits.maxAllocatedBytes > 0 && vm.usage.allocatedBytes+cost > vm.limits.maxAllocatedBytes {
+		return 0, ErrTooManyBytesAllocated
+	}
+	return cost, nil
+}
+
+// peek returns the i-th value from the top of the stack, or nil if there is no such value.
+func (vm *VM) peek(i int) *types.Value {
+	if vm.sp-i < 0 {
+		return nil
+	}
+	return vm.stack[vm.sp-i]
+}
+
+// metrics is the size and the depth of a value on the stack.
+// They are kept for each slot of the stack and updated by each instruction, so that values are never walked to check the limits;
+// walking them takes exponential time since Gdup makes values share their contents.
+type metrics struct {
+	size  int64 // the number of bytes that a deep copy of the value allocates
+	depth int   // see WithMaxNestingDepth
+}
+
+// leafMetrics returns the metrics of v, which must not contain other values.
+func leafMetrics(v *types.Value) metrics {
+	switch v.Kind {
+	case types.String:
+		return metrics{size: valueSize + int64(len(v.String))}
+	case types.Object, types.Array:
+		return metrics{size: valueSize, depth: 1}
+	default:
+		return metrics{size: valueSize}
+	}
+}
+
+// updateMetrics updates the metrics of the stack after op is executed successfully, where sp is the stack pointer just before op.
+func (vm *VM) updateMetrics(op Op, sp int) {
+	switch op {
+	case Aadd:
+		a, x := vm.metrics[sp-1], vm.metrics[sp]
+		vm.metrics[sp-1] = metrics{size: a.size + x.size, depth: maxInt(a.depth, x.depth+1)}
+	case Oadd:
+		// If the key already exists, the metrics of the old value are not subtracted, so they are upper bounds.
+		o, k, v := vm.metrics[sp-2], vm.metrics[sp-1], vm.metrics[sp]
+		vm.metrics[sp-2] = metrics{size: o.size + k.size - valueSize + v.size, depth: maxInt(o.depth, v.depth+1)}
+	case Gdup:
+		vm.metrics[sp+1] = vm.metrics[sp]
+	case Gswp:
+		vm.metrics[sp-1], vm.metrics[sp] = vm.metrics[sp], vm.metrics[sp-1]
+	case Gpop:
+	default:
+		vm.metrics[vm.sp] = leafMetrics(vm.stack[vm.sp])
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,222 @@
+package vm
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/genkami/watson/pkg/types"
+)
+
+// feedUntilError executes ops and returns the error, checking that the stack is left unchanged by the failed op.
+func feedUntilError(t *testing.T, vm *VM, ops []Op) error {
+	t.Helper()
+	for _, op := range ops {
+		depth := vm.Depth()
+		err := vm.Feed(op)
+		if err != nil {
+			if vm.Depth() != depth {
+				t.Errorf("expected depth %d after the error but got %d", depth, vm.Depth())
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWithMaxInstructionsLimitsTheNumberOfInstructions(t *testing.T) {
+	vm := NewVM(WithMaxInstructions(3))
+	err := feedUntilError(t, vm, []Op{Inew, Iinc, Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, []Op{Iadd})
+	if !errors.Is(err, ErrTooManyInstructions) {
+		t.Errorf("expected %v but got %v", ErrTooManyInstructions, err)
+	}
+}
+
+func TestWithMaxInstructionsDoesNotCountFailedInstructions(t *testing.T) {
+	vm := NewVM(WithMaxInstructions(1))
+	err := feedUntilError(t, vm, []Op{Iinc})
+	if !errors.Is(err, ErrStackEmpty) {
+		t.Fatalf("expected %v but got %v", ErrStackEmpty, err)
+	}
+	err = feedUntilError(t, vm, []Op{Inew})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithMaxStringLengthLimitsTheLengthOfStrings(t *testing.T) {
+	vm := NewVM(WithMaxStringLength(2))
+	err := feedUntilError(t, vm, stringOps("ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, append(intOps('c'), Sadd))
+	if !errors.Is(err, ErrStringTooLong) {
+		t.Errorf("expected %v but got %v", ErrStringTooLong, err)
+	}
+}
+
+func TestWithMaxCollectionSizeLimitsTheSizeOfArrays(t *testing.T) {
+	vm := NewVM(WithMaxCollectionSize(2))
+	err := feedUntilError(t, vm, []Op{Anew, Inew, Aadd, Inew, Aadd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, []Op{Inew, Aadd})
+	if !errors.Is(err, ErrCollectionTooLarge) {
+		t.Errorf("expected %v but got %v", ErrCollectionTooLarge, err)
+	}
+}
+
+func TestWithMaxCollectionSizeLimitsTheSizeOfObjects(t *testing.T) {
+	vm := NewVM(WithMaxCollectionSize(1))
+	ops := []Op{Onew}
+	ops = append(ops, stringOps("a")...)
+	ops = append(ops, Inew, Oadd)
+	err := feedUntilError(t, vm, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// overwriting an existing key does not make the Object larger
+	err = feedUntilError(t, vm, append(stringOps("a"), Bnew, Oadd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, append(stringOps("b"), Inew, Oadd))
+	if !errors.Is(err, ErrCollectionTooLarge) {
+		t.Errorf("expected %v but got %v", ErrCollectionTooLarge, err)
+	}
+}
+
+func TestWithMaxNestingDepthLimitsTheDepthOfValues(t *testing.T) {
+	vm := NewVM(WithMaxNestingDepth(2))
+	err := feedUntilError(t, vm, []Op{Anew, Anew, Inew, Aadd, Aadd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, []Op{Anew, Gswp, Aadd})
+	if !errors.Is(err, ErrNestingTooDeep) {
+		t.Errorf("expected %v but got %v", ErrNestingTooDeep, err)
+	}
+}
+
+func TestWithMaxNestingDepthLimitsTheDepthOfObjects(t *testing.T) {
+	vm := NewVM(WithMaxNestingDepth(2))
+	ops := []Op{Onew}
+	ops = append(ops, stringOps("k")...)
+	ops = append(ops, Onew)
+	err := feedUntilError(t, vm, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, append(stringOps("k"), Anew, Oadd))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = feedUntilError(t, vm, []Op{Oadd})
+	if !errors.Is(err, ErrNestingTooDeep) {
+		t.Errorf("expected %v but got %v", ErrNestingTooDeep, err)
+	}
+}
+
+func TestWithMaxAllocatedBytesLimitsTheNumberOfBytesAllocated(t *testing.T) {
+	vm := NewVM(WithMaxAllocatedBytes(4 * valueSize))
+	err := feedUntilError(t, vm, []Op{Anew, Inew, Aadd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// copying the Array allocates both the Array and its element
+	err = feedUntilError(t, vm, []Op{Gdup})
+	if !errors.Is(err, ErrTooManyBytesAllocated) {
+		t.Errorf("expected %v but got %v", ErrTooManyBytesAllocated, err)
+	}
+	// popping a value allocates nothing
+	err = feedUntilError(t, vm, []Op{Gpop})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFeedFusedIsIdenticalToFeedWithLimits(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	weighted := []Op{Inew, Inew, Iinc, Iinc, Ishl, Iadd, Snew, Sadd, Sadd, Anew, Aadd, Onew, Oadd}
+	weighted = append(weighted, AllOps()...)
+	for i := 0; i < 3000; i++ {
+		ops := make([]Op, r.Intn(60))
+		for j := range ops {
+			ops[j] = weighted[r.Intn(len(weighted))]
+		}
+		opts := []VMOption{
+			WithMaxInstructions(int64(r.Intn(60))),
+			WithMaxStringLength(r.Intn(4)),
+			WithMaxCollectionSize(r.Intn(4)),
+			WithMaxNestingDepth(r.Intn(4)),
+			WithMaxAllocatedBytes(int64(r.Intn(60)) * valueSize),
+		}
+		testFeedFusedIsIdenticalToFeedWithOptions(t, opts, nil, ops)
+	}
+}
+
+func TestLimitsDoNotWalkSharedValues(t *testing.T) {
+	// Each Gdup doubles the size of the Array, which would take exponential time if the limits walked the whole Array.
+	ops := []Op{Anew}
+	for i := 0; i < 100; i++ {
+		ops = append(ops, Gdup, Aadd)
+	}
+	vm := NewVM(WithMaxInstructions(100000))
+	err := feedUntilError(t, vm, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vm = NewVM(WithMaxAllocatedBytes(1 << 20))
+	err = feedUntilError(t, vm, ops)
+	if !errors.Is(err, ErrTooManyBytesAllocated) {
+		t.Errorf("expected %v but got %v", ErrTooManyBytesAllocated, err)
+	}
+}
+
+func TestMetricsAreTheSameAsTheOnesOfValues(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	weighted := []Op{Inew, Iinc, Snew, Sadd, Anew, Aadd, Aadd, Onew, Oadd, Oadd, Gdup, Gdup, Gswp}
+	weighted = append(weighted, AllOps()...)
+	for i := 0; i < 300; i++ {
+		vm := NewVM(WithStackSize(16), WithMaxInstructions(1000))
+		// Overwriting keys makes the metrics larger than the actual ones, so they are the same only until a key is overwritten.
+		exact := true
+		for j := 0; j < 100; j++ {
+			op := weighted[r.Intn(len(weighted))]
+			if k, o := vm.peek(1), vm.peek(2); op == Oadd && k != nil && o != nil && o.Kind == types.Object && k.Kind == types.String {
+				if _, ok := o.Object[string(k.String)]; ok {
+					exact = false
+				}
+			}
+			_ = vm.Feed(op)
+			for k := 0; k <= vm.sp; k++ {
+				want, got := metricsOf(vm.stack[k]), vm.metrics[k]
+				if exact && got != want || got.size < want.size || got.depth < want.depth {
+					t.Fatalf("expected %+v but got %+v", want, got)
+				}
+			}
+		}
+	}
+}
+
+// metricsOf walks v to calculate its metrics.
+func metricsOf(v *types.Value) metrics {
+	m := leafMetrics(v)
+	for k, elem := range v.Object {
+		e := metricsOf(elem)
+		m.size += int64(len(k)) + e.size
+		m.depth = maxInt(m.depth, e.depth+1)
+	}
+	for _, elem := range v.Array {
+		e := metricsOf(elem)
+		m.size += e.size
+		m.depth = maxInt(m.depth, e.depth+1)
+	}
+	return m
+}
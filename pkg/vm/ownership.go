@@ -0,0 +1,85 @@
+package vm
+
+import (
+	"github.com/genkami/watson/pkg/types"
+)
+
+// ownership tells how a value on the stack is referred.
+//
+// Values on the stack are shared instead of being copied (e.g. Gdup pushes the same value twice, and Aadd and Oadd insert values as they are),
+// so a value is copied only when it is going to be modified while it is shared.
+// Values inside Objects and Arrays are never modified in place; only values on the top of the stack are.
+type ownership uint8
+
+const (
+	owned        ownership = iota // only the stack refers to the value and its contents
+	partlyShared                  // only the stack refers to the value, but some of its contents are also referred from elsewhere
+	shared                        // the value may also be referred from elsewhere, e.g. other slots of the stack
+)
+
+func (vm *VM) pushWith(v *types.Value, o ownership) error {
+	err := vm.push(v)
+	if err != nil {
+		return err
+	}
+	vm.owners[vm.sp] = o
+	return nil
+}
+
+// popWithOwnership removes the value on the top of the stack and returns it as it is, along with how it is referred.
+func (vm *VM) popWithOwnership() (*types.Value, ownership, error) {
+	if vm.sp < 0 {
+		return nil, owned, ErrStackEmpty
+	}
+	v, o := vm.stack[vm.sp], vm.owners[vm.sp]
+	vm.sp--
+	return v, o, nil
+}
+
+// popMutable pops a value of the given kind that is going to be modified in place.
+// If the value is shared, it returns a shallow copy instead, so that modifying it does not affect others.
+func (vm *VM) popMutable(kind types.Kind) (*types.Value, ownership, error) {
+	v, o, err := vm.popWithOwnership()
+	if err != nil {
+		return nil, owned, err
+	}
+	if v.Kind != kind {
+		return nil, owned, typeMismatch(kind, v.Kind)
+	}
+	if o != shared {
+		return v, o, nil
+	}
+	v = shallowCopy(v)
+	if kind == types.String {
+		return v, owned, nil
+	}
+	// The copy shares its elements with the original.
+	return v, partlyShared, nil
+}
+
+// shallowCopy copies v without copying values inside it.
+func shallowCopy(v *types.Value) *types.Value {
+	clone := *v
+	switch v.Kind {
+	case types.String:
+		clone.String = append([]byte{}, v.String...)
+	case types.Object:
+		// The order of keys is rebuilt by Set, so that the copy does not share it with the original.
+		obj := &types.Value{Kind: types.Object, Object: make(map[string]*types.Value, len(v.Object)+1)}
+		for _, k := range v.OrderedKeys() {
+			obj.Set(k, v.Object[k])
+		}
+		return obj
+	case types.Array:
+		clone.Array = append(make([]*types.Value, 0, len(v.Array)+1), v.Array...)
+	}
+	return &clone
+}
+
+// combine returns the ownership of a container that contains a value whose ownership is elem.
+func combine(container, elem ownership) ownership {
+	if elem != owned && container == owned {
+		return partlyShared
+	}
+	return container
+}
@@ -0,0 +1,321 @@
+package vm
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/types/typestest"
+)
+
+func TestFeedAaddDoesNotCopyTheValue(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Anew, Onew})
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Aadd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Array[0] != x {
+		t.Errorf("expected Aadd to append the value itself")
+	}
+}
+
+func TestFeedGdupDoesNotCopyTheValue(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Onew, Gdup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm.stack[0] != vm.stack[1] {
+		t.Errorf("expected Gdup to push the value itself")
+	}
+}
+
+func TestFeedSaddDoesNotModifyDuplicatedStrings(t *testing.T) {
+	vm := NewVM()
+	// "a" with some room to append.
+	err := vm.pushString(append(make([]byte, 0, 8), 'a'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = vm.Feed(Gdup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []byte{'b', 'c'} {
+		err = vm.pushInt(int64(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Append c to the top, then swap them to append the next one to the other.
+		err = vm.FeedMulti([]Op{Sadd, Gswp})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []*types.Value{
+		types.NewStringValue([]byte("ac")),
+		types.NewStringValue([]byte("ab")),
+	}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPopReturnsAValueThatIsNotReferredByTheVM(t *testing.T) {
+	vm := NewVM()
+	// [[{}], {}] where both {} are the same value.
+	err := vm.FeedMulti([]Op{Onew, Gdup, Anew, Gswp, Aadd, Gswp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := vm.Stack()
+
+	obj, err := vm.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	obj.Set("key", types.NewNilValue())
+	arr, err := vm.Pop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[0], arr, typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if vm.Depth() != 0 {
+		t.Errorf("expected the stack to be empty but got %d values", vm.Depth())
+	}
+}
+
+func TestPopFailsWhenStackIsEmpty(t *testing.T) {
+	vm := NewVM()
+	_, err := vm.Pop()
+	if err != ErrStackEmpty {
+		t.Errorf("expected ErrStackEmpty but got %v", err)
+	}
+}
+
+func TestTopReturnsAValueThatIsNotShared(t *testing.T) {
+	vm := NewVM()
+	err := vm.FeedMulti([]Op{Onew, Gdup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	top.Set("key", types.NewNilValue())
+
+	want := []*types.Value{
+		types.NewObjectValue(map[string]*types.Value{}),
+		types.NewObjectValue(map[string]*types.Value{"key": types.NewNilValue()}),
+	}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestTopReturnsAValueWhoseContentsAreNotShared(t *testing.T) {
+	vm := NewVM()
+	// [{}, [{}]] where both {} are the same value.
+	err := vm.FeedMulti([]Op{Onew, Gdup, Anew, Gswp, Aadd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := vm.Top()
+	if err != nil {
+		t.Fatal(err)
+	}
+	top.Array[0].Set("key", types.NewNilValue())
+
+	want := []*types.Value{
+		types.NewObjectValue(map[string]*types.Value{}),
+		types.NewArrayValue([]*types.Value{
+			types.NewObjectValue(map[string]*types.Value{"key": types.NewNilValue()}),
+		}),
+	}
+	if diff := cmp.Diff(want, vm.Stack(), typestest.CmpOption); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestSharingDoesNotChangeSemantics runs random programs both on a VM and on another VM that copies all values after each instruction,
+// which is how the VM used to work, and compares their stacks.
+// The number of allocated bytes is limited since Gdup and Aadd can make values grow exponentially.
+func TestSharingDoesNotChangeSemantics(t *testing.T) {
+	opts := []cmp.Option{cmpopts.EquateNaNs(), cmpopts.EquateEmpty(), typestest.CmpOption}
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		shared := NewVM(WithStackSize(64), WithMaxAllocatedBytes(1<<14))
+		copied := NewVM(WithStackSize(64), WithMaxAllocatedBytes(1<<14))
+		for i := 0; i < 500; i++ {
+			if r.Intn(50) == 0 {
+				// The caller of Pop can modify the value without affecting the VM.
+				v, err := shared.Pop()
+				want, wantErr := copied.Pop()
+				if err != wantErr {
+					t.Fatalf("seed %d: expected %v but got %v", seed, wantErr, err)
+				}
+				if diff := cmp.Diff(want, v, opts...); diff != "" {
+					t.Fatalf("seed %d: mismatch (-want +got):\n%s", seed, diff)
+				}
+				if v != nil {
+					scribble(v)
+				}
+			} else {
+				op := randomOp(r, shared)
+				err := shared.Feed(op)
+				wantErr := copied.Feed(op)
+				if (err == nil) != (wantErr == nil) {
+					t.Fatalf("seed %d: %#v: expected %v but got %v", seed, op, wantErr, err)
+				}
+				unshare(copied)
+			}
+			want, got := copied.Stack(), shared.Stack()
+			if !equalStacks(want, got) {
+				t.Fatalf("seed %d: mismatch after %d ops (-want +got):\n%s", seed, i+1, cmp.Diff(want, got, opts...))
+			}
+		}
+	}
+}
+
+// operands tells the kinds of values that each Op takes, from the top of the stack, where -1 matches any kind.
+var operands = map[Op][]types.Kind{
+	Iinc: {types.Int},
+	Ishl: {types.Int},
+	Iadd: {types.Int, types.Int},
+	Ineg: {types.Int},
+	Isht: {types.Int, types.Int},
+	Itof: {types.Int},
+	Itou: {types.Int},
+	Fneg: {types.Float},
+	Sadd: {types.Int, types.String},
+	Oadd: {-1, types.String, types.Object},
+	Aadd: {-1, types.Array},
+	Bneg: {types.Bool},
+	Gdup: {-1},
+	Gpop: {-1},
+	Gswp: {-1, -1},
+}
+
+// randomOp returns a random Op that is likely to succeed, so that programs build nested values more often than not.
+func randomOp(r *rand.Rand, vm *VM) Op {
+	ops := AllOps()
+	op := ops[r.Intn(len(ops))]
+	for i := 0; i < 10 && !canExecute(vm, op); i++ {
+		op = ops[r.Intn(len(ops))]
+	}
+	return op
+}
+
+func canExecute(vm *VM, op Op) bool {
+	for i, k := range operands[op] {
+		v := vm.peek(i)
+		if v == nil || (k >= 0 && v.Kind != k) {
+			return false
+		}
+	}
+	return true
+}
+
+// equalStacks is much faster than cmp.Equal.
+func equalStacks(a, b []*types.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// unshare replaces each value on the stack with its deep copy.
+func unshare(vm *VM) {
+	for i := 0; i <= vm.sp; i++ {
+		vm.stack[i] = vm.stack[i].DeepCopy()
+		vm.owners[i] = owned
+	}
+}
+
+// scribble modifies every part of v.
+func scribble(v *types.Value) {
+	switch v.Kind {
+	case types.String:
+		for i := range v.String {
+			v.String[i] ^= 0xff
+		}
+	case types.Object:
+		for _, elem := range v.Object {
+			scribble(elem)
+		}
+		v.Set("scribbled", types.NewNilValue())
+	case types.Array:
+		for _, elem := range v.Array {
+			scribble(elem)
+		}
+		v.Array = append(v.Array, types.NewNilValue())
+	default:
+		v.Kind = types.Nil
+	}
+}
+
+// nestedArrayOps returns Ops that build an Array nested n times, which used to take O(n^2) time since Aadd copied the whole value.
+func nestedArrayOps(n int) []Op {
+	ops := []Op{Anew}
+	for i := 0; i < n; i++ {
+		ops = append(ops, Anew, Gswp, Aadd)
+	}
+	return ops
+}
+
+// duplicatedArrayOps returns Ops that build an Array of n elements and duplicate it n times, which used to take O(n^2) time.
+func duplicatedArrayOps(n int) []Op {
+	ops := []Op{Anew}
+	for i := 0; i < n; i++ {
+		ops = append(ops, Nnew, Aadd)
+	}
+	for i := 0; i < n; i++ {
+		ops = append(ops, Gdup, Gpop)
+	}
+	return ops
+}
+
+func BenchmarkFeedNestedArrays(b *testing.B) {
+	ops := nestedArrayOps(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM()
+		if err := vm.FeedMulti(ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFeedDuplicatedArrays(b *testing.B) {
+	ops := duplicatedArrayOps(1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := NewVM()
+		if err := vm.FeedMulti(ops); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
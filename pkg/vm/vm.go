@@ -13,8 +13,15 @@ const (
 
 // VM is a virtual machine that consists of a stack of values and a pointer to the top of the stack.
 type VM struct {
-	stack []*types.Value
-	sp    int
+	stack   []*types.Value
+	owners  []ownership // owners[i] tells how stack[i] is referred
+	metrics []metrics   // metrics[i] is the metrics of stack[i]; nil unless the VM has limits
+	sp      int
+	tracer  Tracer
+	pending []pendingValue // values that are being built by FeedFused
+	arena   *arena         // nil unless WithArena is given
+	limits  limits
+	usage   usage
 }
 
 // VMOption provides the way to build VMs with custom configurations.
@@ -38,6 +45,18 @@ func WithStackSize(size int) VMOption {
 	})
 }
 
+// Tracer is called by a VM each time it executes an Op.
+// before and after are snapshots of the stack (from the bottom to the top) just before and after the execution.
+type Tracer func(op Op, before, after []*types.Value)
+
+// WithTracer makes a VM call t each time it executes an Op, including the ones that fail.
+// Since it takes snapshots of the whole stack, it makes the VM considerably slower.
+func WithTracer(t Tracer) VMOption {
+	return vmOption(func(v *VM) {
+		v.tracer = t
+	})
+}
+
 // Returns a new VM with its stack allocated.
 // For more details see VMOption.
 func NewVM(opts ...VMOption) *VM {
@@ -48,9 +67,30 @@ func NewVM(opts ...VMOption) *VM {
 	if len(vm.stack) == 0 {
 		vm.stack = make([]*types.Value, DefaultStackSize)
 	}
+	vm.owners = make([]ownership, len(vm.stack))
+	if vm.limits.enabled() {
+		vm.metrics = make([]metrics, len(vm.stack))
+	}
 	return vm
 }
 
+// Reset empties the stack and clears the usage of the limits, so that the VM can execute another input as if it were new.
+// It keeps the stack and the other buffers, so reusing a VM allocates less than creating a new one.
+//
+// If the VM has an arena, values allocated from it are reused as well. See WithArena for details.
+func (vm *VM) Reset() {
+	for i := 0; i <= vm.sp; i++ {
+		vm.stack[i] = nil
+		vm.owners[i] = owned
+	}
+	vm.sp = -1
+	vm.pending = vm.pending[:0]
+	vm.usage = usage{}
+	if vm.arena != nil {
+		vm.arena.reset()
+	}
+}
+
 // Op is an instruction executed by VM. Each op just manipulates the stack.
 type Op int
 
@@ -107,6 +147,17 @@ func AllOps() []Op {
 	return ops
 }
 
+// ParseOp returns the Op whose name is s, e.g. "Inew".
+// Names are the same as the ones returned by GoString.
+func ParseOp(s string) (Op, error) {
+	for op := Op(0); op < numOps; op++ {
+		if op.GoString() == s {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown op: %s", s)
+}
+
 func (op Op) GoString() string {
 	switch op {
 	case Inew:
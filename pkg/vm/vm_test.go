@@ -31,3 +31,22 @@ func TestGoStringIsDefinedForAllOps(t *testing.T) {
 		op.GoString()
 	}
 }
+
+func TestParseOpIsInverseOfGoString(t *testing.T) {
+	for _, op := range AllOps() {
+		got, err := ParseOp(op.GoString())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != op {
+			t.Errorf("expected %#v but got %#v", op, got)
+		}
+	}
+}
+
+func TestParseOpFailsIfNameIsUnknown(t *testing.T) {
+	_, err := ParseOp("inew")
+	if err == nil {
+		t.Error("expected error but got nil")
+	}
+}
@@ -3,6 +3,8 @@ package watson
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"io"
 
 	"github.com/genkami/watson/pkg/dumper"
@@ -18,9 +20,9 @@ import (
 //   * If v is bool, then v is converted to Bool.
 //   * If v is string, then v is converted to String.
 //   * If v is a struct that implements `types.Marshaler`, then v is converted to Value by calling `v.MarshalWatson()`.
-//   * If v is a struct that does not implement `types.Marshaler`, then v is converted to Object with its keys correspond to the fields of v.
+//   * If v is a struct that does not implement `types.Marshaler`, then v is converted to Object with its keys correspond to the fields of v in the order they are declared.
 //   * If v is a slice or an array, then v is converted to Array with its elements converted by these rules.
-//   * If v is a map, then v is converted to Object with its elements converted by these rules.
+//   * If v is a map, then v is converted to Object with its elements converted by these rules. Its keys are sorted in ascending order.
 //   * If v is a pointer, then v is converted to `Value` by converting `*v` with these rules.
 //
 // Note that you can configure struct fields by adding "watson" tag to fields.
@@ -52,35 +54,107 @@ func Unmarshal(buf []byte, v interface{}) error {
 
 // Encoder writes Watson values to a given io.Writer.
 type Encoder struct {
-	d *dumper.Dumper
+	u             *lexer.Unlexer
+	canonical     bool
+	multiDocument bool
 }
 
 // NewEncoder creates a new Encoder that writes to w.
 func NewEncoder(w io.Writer) *Encoder {
 	return &Encoder{
-		d: dumper.NewDumper(lexer.NewUnlexer(w)),
+		u: lexer.NewUnlexer(w),
 	}
 }
 
+// SetCanonical sets whether the Encoder emits the canonical encoding of values.
+// If it is set to true, equal values are always encoded into the same byte sequence.
+//
+// See watson/pkg/dumper for more details.
+func (e *Encoder) SetCanonical(canonical bool) {
+	e.canonical = canonical
+}
+
+// SetMultiDocument sets whether the Encoder writes a multi-document stream.
+// If it is set to true, each value is followed by `lexer.DocumentSeparator` and a newline, so that the output can be read by a Decoder with SetMultiDocument(true).
+//
+// See "Multi-Document Streams" in the specification for details.
+func (e *Encoder) SetMultiDocument(multiDocument bool) {
+	e.multiDocument = multiDocument
+}
+
 // Encode writes the Watson encoding of v to the underlying io.Writer.
 func (e *Encoder) Encode(v interface{}) error {
+	return e.EncodeContext(context.Background(), v)
+}
+
+// EncodeContext is the same as Encode, but it checks ctx before writing each instruction.
+// Once ctx is done, it stops writing and returns a *dumper.ContextError that wraps `ctx.Err()` and tells how many instructions are written.
+func (e *Encoder) EncodeContext(ctx context.Context, v interface{}) error {
 	val, err := types.ToValue(v)
 	if err != nil {
 		return err
 	}
-	return e.d.Dump(val)
+	err = e.dumper(ctx).Dump(val)
+	if err != nil {
+		return err
+	}
+	if e.multiDocument {
+		err = e.u.EndDocument()
+		if err != nil {
+			return err
+		}
+	}
+	return e.u.Flush()
+}
+
+func (e *Encoder) dumper(ctx context.Context) *dumper.Dumper {
+	opts := make([]dumper.DumperOption, 0, 2)
+	opts = append(opts, dumper.WithContext(ctx))
+	if e.canonical {
+		opts = append(opts, dumper.WithCanonical())
+	}
+	return dumper.NewDumper(e.u, opts...)
+}
+
+// DecodeError is an error that occurs when a Decoder or a Parser fails to execute an instruction, or when a Decoder stops before it because its context is done.
+type DecodeError struct {
+	Token *lexer.Token // the instruction that failed and its position
+	Err   error        // the reason why the instruction failed; this is typically a `*vm.ExecError` or `ctx.Err()`
+}
+
+func (e *DecodeError) Error() string {
+	if e.Token.FileName != "" {
+		return fmt.Sprintf("%s at %#v line %d, column %d", e.Err.Error(), e.Token.FileName, e.Token.Line+1, e.Token.Column+1)
+	}
+	return fmt.Sprintf("%s at line %d, column %d", e.Err.Error(), e.Token.Line+1, e.Token.Column+1)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
 }
 
 // Decoder reads and decodes Watson values from a given io.Reader.
 type Decoder struct {
-	l         *lexer.Lexer
-	stackSize int
+	r                 io.Reader
+	l                 *lexer.Lexer
+	m                 *vm.VM // reused for each document
+	arena             bool
+	stackSize         int
+	maxInstructions   int64
+	maxStringLength   int
+	maxCollectionSize int
+	maxNestingDepth   int
+	maxAllocatedBytes int64
+	multiDocument     bool
+	peeked            bool
+	peekedOp          vm.Op
+	peekErr           error
 }
 
 // NewDecoder creates a new Decoder that reads from r.
 func NewDecoder(r io.Reader) *Decoder {
 	return &Decoder{
-		l: lexer.NewLexer(r),
+		r: r,
 	}
 }
 
@@ -89,22 +163,117 @@ func NewDecoder(r io.Reader) *Decoder {
 // See watson/pkg/vm for more details.
 func (d *Decoder) SetStacksize(size int) {
 	d.stackSize = size
+	d.m = nil
 }
 
-// Decode reads a Watson value from the underlying io.Reader and converts it into v.
-func (d *Decoder) Decode(v interface{}) error {
-	m := vm.NewVM(vm.WithStackSize(d.stackSize))
+// SetMaxInstructions limits the number of instructions that the Decoder executes for each document.
+// Zero means unlimited, which is the default.
+//
+// The limits below are useful for decoding untrusted input. See watson/pkg/vm for more details.
+func (d *Decoder) SetMaxInstructions(n int64) {
+	d.maxInstructions = n
+	d.m = nil
+}
+
+// SetMaxStringLength limits the length of Strings that the Decoder builds.
+// Zero means unlimited, which is the default.
+func (d *Decoder) SetMaxStringLength(n int) {
+	d.maxStringLength = n
+	d.m = nil
+}
+
+// SetMaxCollectionSize limits the number of elements in Arrays and Objects that the Decoder builds.
+// Zero means unlimited, which is the default.
+func (d *Decoder) SetMaxCollectionSize(n int) {
+	d.maxCollectionSize = n
+	d.m = nil
+}
+
+// SetMaxNestingDepth limits the depth of Arrays and Objects that the Decoder builds.
+// Zero means unlimited, which is the default.
+func (d *Decoder) SetMaxNestingDepth(n int) {
+	d.maxNestingDepth = n
+	d.m = nil
+}
+
+// SetMaxAllocatedBytes limits the (estimated) number of bytes that the Decoder allocates for each document.
+// Zero means unlimited, which is the default.
+func (d *Decoder) SetMaxAllocatedBytes(n int64) {
+	d.maxAllocatedBytes = n
+	d.m = nil
+}
+
+// SetArena sets whether the Decoder allocates values from an arena and reuses them for each document, which reduces allocations.
+// It is useful for decoding a lot of small documents, typically by calling Reset for each of them.
+//
+// Values that the Decoder passes to `types.Unmarshaler`s are reused by the next call of Decode, so they must not be kept after UnmarshalWatson returns.
+// Values bound to other go objects are not affected since they are copied. See `vm.WithArena` for details.
+func (d *Decoder) SetArena(arena bool) {
+	d.arena = arena
+	d.m = nil
+}
+
+// SetMultiDocument sets whether the Decoder reads a multi-document stream.
+// If it is set to true, each call of Decode reads only one document, that is, a sequence of instructions that ends with `lexer.DocumentSeparator` or the end of the input.
+// It must be called before the first call of Decode or More.
+//
+// See "Multi-Document Streams" in the specification for details.
+func (d *Decoder) SetMultiDocument(multiDocument bool) {
+	d.multiDocument = multiDocument
+}
+
+// Reset makes the Decoder read from r as if it were newly created by NewDecoder(r) with the same settings.
+// The rest of the previous input is discarded.
+// Since it reuses the internal buffers, decoding many inputs with one Decoder allocates less than creating a new Decoder for each of them.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r = r
+	if d.l != nil {
+		d.l.Reset(r)
+	}
+	d.peeked = false
+	d.peekedOp = 0
+	d.peekErr = nil
+}
+
+// More reports whether there is another document to decode.
+// Empty documents are skipped.
+func (d *Decoder) More() bool {
+	if d.peeked || d.peekErr != nil {
+		return true
+	}
 	for {
-		tok, err := d.l.Next()
-		if err == io.EOF {
-			break
+		op, err := d.lexer().NextOp()
+		if err == lexer.ErrEndOfDocument {
+			continue
+		} else if err == io.EOF {
+			return false
 		} else if err != nil {
-			return err
-		}
-		err = m.Feed(tok.Op)
-		if err != nil {
-			return err
+			// Decode reports the error.
+			d.peekErr = err
+			return true
 		}
+		d.peeked = true
+		d.peekedOp = op
+		return true
+	}
+}
+
+// Decode reads a Watson value from the underlying io.Reader and converts it into v.
+// If the VM fails to execute an instruction, it returns a *DecodeError that tells where the instruction is.
+//
+// If the Decoder reads a multi-document stream, it reads the next non-empty document and returns io.EOF if there is no such document.
+func (d *Decoder) Decode(v interface{}) error {
+	return d.DecodeContext(context.Background(), v)
+}
+
+// DecodeContext is the same as Decode, but it checks ctx after reading each instruction.
+// Once ctx is done, it returns a *DecodeError that wraps `ctx.Err()` and tells the position of the instruction that is not executed yet.
+//
+// Note that it can't interrupt a blocking read of the underlying io.Reader; ctx is checked only when the reader returns.
+func (d *Decoder) DecodeContext(ctx context.Context, v interface{}) error {
+	m, err := d.execute(ctx)
+	if err != nil {
+		return err
 	}
 	top, err := m.Top()
 	if err != nil {
@@ -112,3 +281,110 @@ func (d *Decoder) Decode(v interface{}) error {
 	}
 	return top.Bind(v)
 }
+
+// DecodeAll is almost the same as Decode, but it converts all values left on the stack into v instead of only the top of the stack.
+// The values are regarded as an Array whose first element is the bottom of the stack, so v is typically a pointer to a slice.
+func (d *Decoder) DecodeAll(v interface{}) error {
+	return d.DecodeAllContext(context.Background(), v)
+}
+
+// DecodeAllContext is the same as DecodeAll, but it checks ctx in the same way as DecodeContext.
+func (d *Decoder) DecodeAllContext(ctx context.Context, v interface{}) error {
+	m, err := d.execute(ctx)
+	if err != nil {
+		return err
+	}
+	return types.NewArrayValue(m.Stack()).Bind(v)
+}
+
+// chunkSize is the number of instructions that a Decoder executes at once.
+const chunkSize = 1024
+
+// execute executes a document on an empty VM.
+func (d *Decoder) execute(ctx context.Context) (*vm.VM, error) {
+	if d.multiDocument && !d.More() {
+		return nil, io.EOF
+	}
+	m := d.vm()
+	ops := make([]vm.Op, 0, chunkSize)
+	positions := make([][2]int, 0, chunkSize)
+	done := ctx.Done() // nil if ctx is never canceled
+	for {
+		ops = ops[:0]
+		positions = positions[:0]
+		var lexErr error
+		for len(ops) < chunkSize {
+			op, err := d.next()
+			if err != nil {
+				lexErr = err
+				break
+			}
+			line, column := d.lexer().Position()
+			if done != nil {
+				select {
+				case <-done:
+					tok := &lexer.Token{Op: op, Line: line, Column: column}
+					return nil, &DecodeError{Token: tok, Err: ctx.Err()}
+				default:
+				}
+			}
+			ops = append(ops, op)
+			positions = append(positions, [2]int{line, column})
+		}
+		// Instructions that are read before an error must be executed first, since they may fail as well.
+		n, err := m.FeedFused(ops)
+		if err != nil {
+			tok := &lexer.Token{Op: ops[n], Line: positions[n][0], Column: positions[n][1]}
+			return nil, &DecodeError{Token: tok, Err: err}
+		}
+		if lexErr == io.EOF || lexErr == lexer.ErrEndOfDocument {
+			return m, nil
+		} else if lexErr != nil {
+			return nil, lexErr
+		}
+	}
+}
+
+// vm returns an empty VM, which is created for the first document and reset for the rest of them.
+func (d *Decoder) vm() *vm.VM {
+	if d.m != nil {
+		d.m.Reset()
+		return d.m
+	}
+	opts := []vm.VMOption{
+		vm.WithStackSize(d.stackSize),
+		vm.WithMaxInstructions(d.maxInstructions),
+		vm.WithMaxStringLength(d.maxStringLength),
+		vm.WithMaxCollectionSize(d.maxCollectionSize),
+		vm.WithMaxNestingDepth(d.maxNestingDepth),
+		vm.WithMaxAllocatedBytes(d.maxAllocatedBytes),
+	}
+	if d.arena {
+		opts = append(opts, vm.WithArena())
+	}
+	d.m = vm.NewVM(opts...)
+	return d.m
+}
+
+func (d *Decoder) next() (vm.Op, error) {
+	if d.peeked {
+		d.peeked = false
+		return d.peekedOp, nil
+	} else if d.peekErr != nil {
+		err := d.peekErr
+		d.peekErr = nil
+		return 0, err
+	}
+	return d.lexer().NextOp()
+}
+
+func (d *Decoder) lexer() *lexer.Lexer {
+	if d.l == nil {
+		opts := make([]lexer.LexerOption, 0, 1)
+		if d.multiDocument {
+			opts = append(opts, lexer.WithMultiDocument())
+		}
+		d.l = lexer.NewLexer(d.r, opts...)
+	}
+	return d.l
+}
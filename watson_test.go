@@ -1,13 +1,21 @@
 package watson_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
 	"github.com/genkami/watson"
+	"github.com/genkami/watson/pkg/dumper"
 	"github.com/genkami/watson/pkg/types"
+	"github.com/genkami/watson/pkg/vm"
 )
 
 type User struct {
@@ -58,6 +66,30 @@ func TestEncodeAndDecode(t *testing.T) {
 	}
 }
 
+func TestEncoderWithCanonicalProducesSameOutput(t *testing.T) {
+	in := map[string]interface{}{}
+	for i := 0; i < 100; i++ {
+		in[fmt.Sprintf("key%d", i)] = i
+	}
+	encode := func() []byte {
+		buf := bytes.NewBuffer(nil)
+		enc := watson.NewEncoder(buf)
+		enc.SetCanonical(true)
+		err := enc.Encode(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	want := encode()
+	for i := 0; i < 10; i++ {
+		got := encode()
+		if !bytes.Equal(want, got) {
+			t.Fatalf("expected %s but got %s", want, got)
+		}
+	}
+}
+
 func encodeThenDecode(in interface{}, out interface{}) error {
 	encoded, err := watson.Marshal(in)
 	if err != nil {
@@ -65,3 +97,470 @@ func encodeThenDecode(in interface{}, out interface{}) error {
 	}
 	return watson.Unmarshal(encoded, out)
 }
+
+func TestDecoderWithMultiDocumentReadsEachDocument(t *testing.T) {
+	in := "?SShkShaaaaakShaaaaaak-;\nzo;\n;\nBBuba;\n"
+	dec := watson.NewDecoder(strings.NewReader(in))
+	dec.SetMultiDocument(true)
+	want := []interface{}{"a", true, int64(2)}
+	got := make([]interface{}, 0, len(want))
+	for dec.More() {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	var v interface{}
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("expected io.EOF but got %#v", err)
+	}
+}
+
+func TestDecoderWithMultiDocumentReadsTheLastDocumentWithoutSeparator(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("zo;BBuba"))
+	dec.SetMultiDocument(true)
+	var b bool
+	var n int
+	if err := dec.Decode(&b); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&n); err != nil {
+		t.Fatal(err)
+	}
+	if !b || n != 2 {
+		t.Errorf("expected (true, 2) but got (%#v, %#v)", b, n)
+	}
+	if dec.More() {
+		t.Errorf("expected no more documents")
+	}
+}
+
+func TestDecoderWithoutMultiDocumentIgnoresSeparators(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("zo;BBuba;"))
+	var n int
+	err := dec.Decode(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected %#v but got %#v", 2, n)
+	}
+}
+
+func TestEncoderWithMultiDocumentWritesDocumentsThatCanBeDecoded(t *testing.T) {
+	want := []User{
+		{FullName: "Tanaka Taro", Age: 41},
+		{FullName: "Suzuki Hanako", Age: 28},
+		{FullName: "Sato Jiro", Age: 35},
+	}
+	buf := bytes.NewBuffer(nil)
+	enc := watson.NewEncoder(buf)
+	enc.SetMultiDocument(true)
+	for _, u := range want {
+		err := enc.Encode(&u)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dec := watson.NewDecoder(buf)
+	dec.SetMultiDocument(true)
+	got := make([]User, 0, len(want))
+	for dec.More() {
+		var u User
+		err := dec.Decode(&u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, u)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeAllDecodesTheWholeStack(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("BBuazo?SShk-"))
+	var got []interface{}
+	err := dec.DecodeAll(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{int64(1), true, "\x01"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeAllWithMultiDocumentDecodesEachDocument(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("BBuazo;BBuba"))
+	dec.SetMultiDocument(true)
+	want := [][]interface{}{
+		{int64(1), true},
+		{int64(2)},
+	}
+	got := make([][]interface{}, 0, len(want))
+	for dec.More() {
+		var vals []interface{}
+		err := dec.DecodeAll(&vals)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, vals)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeReturnsDecodeErrorWithPosition(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("BBuba\nBo"))
+	var v interface{}
+	err := dec.Decode(&v)
+	var decErr *watson.DecodeError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("expected *watson.DecodeError but got %#v", err)
+	}
+	if decErr.Token.Op != vm.Bneg || decErr.Token.Line != 1 || decErr.Token.Column != 1 {
+		t.Errorf("unexpected token: %#v", decErr.Token)
+	}
+	var execErr *vm.ExecError
+	if !errors.As(err, &execErr) {
+		t.Fatalf("expected *vm.ExecError but got %#v", err)
+	}
+	if execErr.Expected != types.Bool || execErr.Actual != types.Int {
+		t.Errorf("unexpected kinds: expected %#v, actual %#v", execErr.Expected, execErr.Actual)
+	}
+	if !errors.Is(err, vm.ErrTypeMismatch) {
+		t.Errorf("expected vm.ErrTypeMismatch but got %v", err)
+	}
+}
+
+func TestDecoderWithLimitsRejectsLargeValues(t *testing.T) {
+	buf, err := watson.Marshal(largeUsers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		set func(*watson.Decoder)
+		err error
+	}{
+		{func(d *watson.Decoder) { d.SetMaxInstructions(1000) }, vm.ErrTooManyInstructions},
+		{func(d *watson.Decoder) { d.SetMaxStringLength(5) }, vm.ErrStringTooLong},
+		{func(d *watson.Decoder) { d.SetMaxCollectionSize(100) }, vm.ErrCollectionTooLarge},
+		{func(d *watson.Decoder) { d.SetMaxNestingDepth(1) }, vm.ErrNestingTooDeep},
+		{func(d *watson.Decoder) { d.SetMaxAllocatedBytes(1 << 16) }, vm.ErrTooManyBytesAllocated},
+	} {
+		dec := watson.NewDecoder(bytes.NewReader(buf))
+		tc.set(dec)
+		var v interface{}
+		err := dec.Decode(&v)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("expected %v but got %v", tc.err, err)
+		}
+	}
+}
+
+func TestDecoderWithLimitsAcceptsSmallValues(t *testing.T) {
+	buf, err := watson.Marshal(User{FullName: "Tako", Age: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := watson.NewDecoder(bytes.NewReader(buf))
+	dec.SetMaxInstructions(1000)
+	dec.SetMaxStringLength(10)
+	dec.SetMaxCollectionSize(2)
+	dec.SetMaxNestingDepth(1)
+	dec.SetMaxAllocatedBytes(1 << 16)
+	var got User
+	err = dec.Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(User{FullName: "Tako", Age: 3}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecodeShiftsByMinInt64(t *testing.T) {
+	// 0 >> -math.MinInt64
+	in := "BBu" + strings.Repeat("b", 63) + "e"
+	dec := watson.NewDecoder(strings.NewReader(in))
+	var got int64
+	err := dec.Decode(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Errorf("expected 0 but got %d", got)
+	}
+}
+
+func TestDecoderResetReadsFromTheBeginningOfNewInput(t *testing.T) {
+	for _, arena := range []bool{false, true} {
+		dec := watson.NewDecoder(strings.NewReader("?SShkShaaaaakShaaaaaak-"))
+		dec.SetArena(arena)
+		var s string
+		err := dec.Decode(&s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			want := User{FullName: fmt.Sprintf("Tako %d", i), Age: i}
+			buf, err := watson.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dec.Reset(bytes.NewReader(buf))
+			var got User
+			err = dec.Decode(&got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("arena=%v: mismatch (-want +got):\n%s", arena, diff)
+			}
+		}
+	}
+}
+
+func TestDecoderResetDiscardsTheRestOfPreviousInput(t *testing.T) {
+	dec := watson.NewDecoder(strings.NewReader("zo;BBuba"))
+	dec.SetMultiDocument(true)
+	var v interface{}
+	err := dec.Decode(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec.Reset(strings.NewReader("zo"))
+	err = dec.Decode(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != true {
+		t.Errorf("expected true but got %#v", v)
+	}
+	if dec.More() {
+		t.Errorf("expected no more documents")
+	}
+}
+
+func TestDecoderWithArenaDecodesEachDocument(t *testing.T) {
+	users := largeUsers()
+	var buf bytes.Buffer
+	enc := watson.NewEncoder(&buf)
+	enc.SetMultiDocument(true)
+	for _, u := range users {
+		if err := enc.Encode(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dec := watson.NewDecoder(&buf)
+	dec.SetMultiDocument(true)
+	dec.SetArena(true)
+	got := make([]User, 0, len(users))
+	for dec.More() {
+		var u User
+		if err := dec.Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, u)
+	}
+	if diff := cmp.Diff(users, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDecoderAppliesSettingsChangedAfterDecode(t *testing.T) {
+	buf, err := watson.Marshal(User{FullName: "Tako", Age: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := watson.NewDecoder(bytes.NewReader(buf))
+	var u User
+	err = dec.Decode(&u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec.Reset(bytes.NewReader(buf))
+	dec.SetMaxStringLength(2)
+	err = dec.Decode(&u)
+	if !errors.Is(err, vm.ErrStringTooLong) {
+		t.Errorf("expected %v but got %v", vm.ErrStringTooLong, err)
+	}
+}
+
+// endlessReader is an io.Reader that never returns io.EOF.
+type endlessReader struct {
+	pattern string
+}
+
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.pattern[i%len(r.pattern)]
+	}
+	return len(p) - len(p)%len(r.pattern), nil
+}
+
+func TestDecodeContextStopsReadingEndlessInput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	// Bnew Gpop Bnew Gpop ...
+	dec := watson.NewDecoder(&endlessReader{pattern: "z#"})
+	var v interface{}
+	err := dec.DecodeContext(ctx, &v)
+	var decErr *watson.DecodeError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("expected *watson.DecodeError but got %#v", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestDecodeContextReturnsPositionWhenContextIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dec := watson.NewDecoder(strings.NewReader("BBuba"))
+	var v interface{}
+	err := dec.DecodeContext(ctx, &v)
+	var decErr *watson.DecodeError
+	if !errors.As(err, &decErr) {
+		t.Fatalf("expected *watson.DecodeError but got %#v", err)
+	}
+	if decErr.Token.Op != vm.Inew || decErr.Token.Line != 0 || decErr.Token.Column != 0 {
+		t.Errorf("unexpected token: %#v", decErr.Token)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestEncodeContextStopsWritingWhenContextIsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf := bytes.NewBuffer(nil)
+	enc := watson.NewEncoder(buf)
+	err := enc.EncodeContext(ctx, largeUsers())
+	var ctxErr *dumper.ContextError
+	if !errors.As(err, &ctxErr) {
+		t.Fatalf("expected *dumper.ContextError but got %#v", err)
+	}
+	if ctxErr.Written != 0 || buf.Len() != 0 {
+		t.Errorf("expected nothing to be written but got %d instructions", ctxErr.Written)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+}
+
+// largeUsers builds a value whose encoding is about a few megabytes.
+func largeUsers() []User {
+	users := make([]User, 0, 2000)
+	for i := 0; i < cap(users); i++ {
+		users = append(users, User{FullName: fmt.Sprintf("Tako Ika %d", i), Age: i})
+	}
+	return users
+}
+
+func BenchmarkEncodeLarge(b *testing.B) {
+	users := largeUsers()
+	var buf bytes.Buffer
+	err := watson.NewEncoder(&buf).Encode(users)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(buf.Len()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		err := watson.NewEncoder(&buf).Encode(users)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeLarge(b *testing.B) {
+	var buf bytes.Buffer
+	err := watson.NewEncoder(&buf).Encode(largeUsers())
+	if err != nil {
+		b.Fatal(err)
+	}
+	input := buf.Bytes()
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var users []User
+		err := watson.NewDecoder(bytes.NewReader(input)).Decode(&users)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// smallMessages returns Watson representations of small values, such as the ones that a service receives.
+func smallMessages() [][]byte {
+	msgs := make([][]byte, 0, 100)
+	for i := 0; i < cap(msgs); i++ {
+		buf, err := watson.Marshal(User{FullName: fmt.Sprintf("Tako Ika %d", i), Age: i})
+		if err != nil {
+			panic(err)
+		}
+		msgs = append(msgs, buf)
+	}
+	return msgs
+}
+
+func BenchmarkDecodeSmall(b *testing.B) {
+	msgs := smallMessages()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var u User
+		err := watson.NewDecoder(bytes.NewReader(msgs[i%len(msgs)])).Decode(&u)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeSmallWithReset(b *testing.B) {
+	msgs := smallMessages()
+	dec := watson.NewDecoder(nil)
+	r := bytes.NewReader(nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var u User
+		r.Reset(msgs[i%len(msgs)])
+		dec.Reset(r)
+		err := dec.Decode(&u)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeSmallWithResetAndArena(b *testing.B) {
+	msgs := smallMessages()
+	dec := watson.NewDecoder(nil)
+	dec.SetArena(true)
+	r := bytes.NewReader(nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var u User
+		r.Reset(msgs[i%len(msgs)])
+		dec.Reset(r)
+		err := dec.Decode(&u)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}